@@ -14,6 +14,7 @@
  * Cloud Variables:
  * - doorStatus: Current door status string
  * - distance: Current distance reading in mm
+ * - relayHoldMs: How long pressButton holds the relay, in ms
  */
 
 #include "Particle.h"
@@ -50,6 +51,9 @@ SYSTEM_THREAD(ENABLED);
 // Relay timing
 #define RELAY_PULSE_DURATION 1000    // 1 second
 
+// Status publishing
+#define STATUS_REPUBLISH_INTERVAL 600000  // Re-publish door/status every 10 minutes
+
 // Global objects
 Adafruit_SSD1306 display(SCREEN_WIDTH, SCREEN_HEIGHT, &Wire, OLED_RESET);
 VL53L4CD sensor(&Wire, VL53L4CD_XSHUT);
@@ -57,6 +61,7 @@ VL53L4CD sensor(&Wire, VL53L4CD_XSHUT);
 // Global state variables
 char doorStatus[20] = "unknown";
 uint16_t distance = 0;
+int relayHoldMs = RELAY_PULSE_DURATION;
 unsigned long lastSensorRead = 0;
 unsigned long lastDisplayUpdate = 0;
 bool relayActive = false;
@@ -92,6 +97,7 @@ void setup() {
     // Register cloud variables
     Particle.variable("doorStatus", doorStatus);
     Particle.variable("distance", distance);
+    Particle.variable("relayHoldMs", relayHoldMs);
 
     Serial.println("Setup complete!");
 
@@ -214,8 +220,10 @@ void readSensor() {
         if (results.range_status == 0) {
             distance = results.distance_mm;
 
-            // Determine door status
-            const char* oldStatus = doorStatus;
+            // Determine door status, keeping a copy of the old one to
+            // compare against
+            char oldStatus[sizeof(doorStatus)];
+            strcpy(oldStatus, doorStatus);
 
             if (distance < DOOR_CLOSED_THRESHOLD) {
                 strcpy(doorStatus, "closed");
@@ -225,11 +233,17 @@ void readSensor() {
                 strcpy(doorStatus, "moving");
             }
 
-            // Publish status change
+            // Publish status changes, and the unchanged status periodically
+            // so webhook subscribers know it is still current
+            static unsigned long lastStatusPublish = 0;
             if (strcmp(oldStatus, doorStatus) != 0) {
                 Particle.publish("door/status", doorStatus, PRIVATE);
+                lastStatusPublish = millis();
                 Serial.printlnf("Door status changed: %s -> %s (distance: %d mm)",
                                 oldStatus, doorStatus, distance);
+            } else if (millis() - lastStatusPublish >= STATUS_REPUBLISH_INTERVAL) {
+                Particle.publish("door/status", doorStatus, PRIVATE);
+                lastStatusPublish = millis();
             }
 
             // Publish distance periodically
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// userAccess maps an Alexa user ID to the door names it may use, with "*"
+// meaning every door. It is loaded from ALLOWED_USERS; when nil, everyone
+// may use every door.
+var userAccess map[string][]string
+
+// loadUserAccess parses ALLOWED_USERS, e.g.
+// {"amzn1.ask.account.AAA":["*"],"amzn1.ask.account.BBB":["workshop"]}
+func loadUserAccess(raw string) (map[string][]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var access map[string][]string
+	if err := json.Unmarshal([]byte(raw), &access); err != nil {
+		return nil, fmt.Errorf("error parsing ALLOWED_USERS: %w", err)
+	}
+	return access, nil
+}
+
+// userCanAccess reports whether a user may query or operate a device. Door
+// names in ALLOWED_USERS are the ones in DEVICE_MAP; friendly names don't
+// count.
+func userCanAccess(userID, deviceID string) bool {
+	if userAccess == nil {
+		return true
+	}
+
+	for _, name := range userAccess[userID] {
+		if name == "*" {
+			return true
+		}
+		if device, ok := configuredDevice(name); ok && device.ID == deviceID {
+			return true
+		}
+	}
+	return false
+}
+
+// requireAccountLink is set by REQUIRE_ACCOUNT_LINKING for skills that use
+// Alexa account linking
+var requireAccountLink bool
+
+// linkedIntents are the intents that change something, which need a linked
+// account when requireAccountLink is set. Status questions don't.
+var linkedIntents = map[string]bool{
+	"PressButtonIntent": true,
+	"AcknowledgeIntent": true,
+	"DelayAlertIntent":  true,
+	"RenameDoorIntent":  true,
+	"SnoozeIntent":      true,
+	"ResetStateIntent":  true,
+}
+
+// requestAccessToken returns the account linking token, which Alexa sends in
+// the session and, for requests outside a session, only in the context
+func requestAccessToken(request AlexaRequest) string {
+	if token := request.Session.User.AccessToken; token != "" {
+		return token
+	}
+	return request.Context.System.User.AccessToken
+}
+
+// needsAccountLink reports whether a request must be refused until the user
+// links their account
+func needsAccountLink(request AlexaRequest) bool {
+	return requireAccountLink && linkedIntents[request.Request.Intent.Name] && requestAccessToken(request) == ""
+}
+
+// buildLinkAccountResponse asks the user to link their account, with the
+// LinkAccount card that takes them to linking in the Alexa app
+func buildLinkAccountResponse() AlexaResponse {
+	response := buildResponse("To control your garage door, please link your account. I've sent a card to the Alexa app to help you do that.", true)
+	response.Response.Card = &Card{Type: "LinkAccount"}
+	return response
+}
@@ -0,0 +1,94 @@
+package main
+
+import "encoding/json"
+
+// aplInterface is the supportedInterfaces key for screen devices that render APL
+const aplInterface = "Alexa.Presentation.APL"
+
+// AlexaContext is the part of the request context the skill reads
+type AlexaContext struct {
+	System struct {
+		User struct {
+			AccessToken string           `json:"accessToken,omitempty"`
+			Permissions *UserPermissions `json:"permissions,omitempty"` // See permissions.go
+		} `json:"user"`
+		Device struct {
+			DeviceID            string                     `json:"deviceId"`
+			SupportedInterfaces map[string]json.RawMessage `json:"supportedInterfaces"`
+		} `json:"device"`
+		Application struct {
+			ApplicationID string `json:"applicationId"`
+		} `json:"application"`
+	} `json:"System"`
+}
+
+// supportsAPL reports whether the requesting device has a screen that renders APL
+func supportsAPL(request AlexaRequest) bool {
+	_, ok := request.Context.System.Device.SupportedInterfaces[aplInterface]
+	return ok
+}
+
+// statusDocument is an APL document showing the door status in large, colored
+// text with an optional detail line underneath. Values come from the
+// "status" datasource.
+var statusDocument = map[string]interface{}{
+	"type":    "APL",
+	"version": "1.8",
+	"mainTemplate": map[string]interface{}{
+		"parameters": []string{"payload"},
+		"items": []interface{}{
+			map[string]interface{}{
+				"type":           "Container",
+				"width":          "100vw",
+				"height":         "100vh",
+				"justifyContent": "center",
+				"alignItems":     "center",
+				"items": []interface{}{
+					map[string]interface{}{
+						"type":      "Text",
+						"text":      "${payload.status.name}",
+						"fontSize":  "32dp",
+						"textAlign": "center",
+					},
+					map[string]interface{}{
+						"type":       "Text",
+						"text":       "${payload.status.label}",
+						"color":      "${payload.status.color}",
+						"fontSize":   "96dp",
+						"fontWeight": "bold",
+						"textAlign":  "center",
+					},
+					map[string]interface{}{
+						"type":      "Text",
+						"text":      "${payload.status.detail}",
+						"fontSize":  "28dp",
+						"textAlign": "center",
+					},
+				},
+			},
+		},
+	},
+}
+
+// buildStatusDirective renders a door status for screen devices, e.g. a
+// red "OPEN" over "Open for 2 hours"
+func buildStatusDirective(name, status, detail string, loc speechLocale) Directive {
+	color := "#2E7D32" // Green for closed
+	if status == "open" {
+		color = "#C62828"
+	}
+
+	return Directive{
+		Type:     "Alexa.Presentation.APL.RenderDocument",
+		Token:    "doorStatus",
+		Document: statusDocument,
+		Datasources: map[string]interface{}{
+			"status": map[string]string{
+				"name":   capitalize(name),
+				"label":  loc.statusLabel(status),
+				"color":  color,
+				"detail": detail,
+			},
+		},
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// Without a door sensor there is no real status to report. With
+// ASSUME_STATE_FROM_PRESSES=true each successful press flips an assumed
+// status on DoorState, and status requests report it with a caveat when the
+// sensor gives no reading. Any real reading clears the assumption. Opt-in,
+// since a press that didn't move the door, or the wall button, throws it off.
+
+var assumeFromPresses bool
+
+// nextAssumedStatus is the assumed status after a press. Without an
+// assumption it starts from the last real reading, and a door that has never
+// been read is taken to have been closed.
+func nextAssumedStatus(state *DoorState) string {
+	current := state.AssumedStatus
+	if current == "" {
+		current = state.Status
+	}
+	if current == "open" {
+		return "closed"
+	}
+	return "open"
+}
+
+// assumedStatusSpeech reports the assumed status, for when the sensor gives
+// no reading
+func assumedStatusSpeech(ctx context.Context, deviceID string, loc speechLocale) (string, bool) {
+	if !assumeFromPresses {
+		return "", false
+	}
+
+	state, err := getDoorState(ctx, deviceID)
+	if err != nil || state == nil || state.AssumedStatus == "" {
+		return "", false
+	}
+
+	name, status := loc.doorName(deviceID), state.AssumedStatus
+	speech := loc.sentence("assumed", fmt.Sprintf("I believe %s is %s, based on the last button press", name, status),
+		name, loc.describe(statusReading{Status: status}))
+	if state.LastButtonPress > 0 {
+		mins := (now().Unix() - state.LastButtonPress) / 60
+		speech += loc.sentence("assumedAgo", fmt.Sprintf(" %s ago", humanizeDuration(mins)), loc.plainDuration(mins))
+	}
+	return speech + loc.sentence("assumedCaveat", ". Without a sensor I can't be sure, so check it if it matters."), true
+}
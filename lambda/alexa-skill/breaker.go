@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// During a Particle outage every call would wait out its full timeout. After
+// PARTICLE_BREAKER_THRESHOLD consecutive failed calls (network errors or 5xx
+// responses) the breaker opens, and calls fail at once with
+// errParticleUnavailable for PARTICLE_BREAKER_COOLDOWN_SECONDS. Then one
+// probe call is let through: if it works the breaker closes, otherwise it
+// opens for another cooldown. The state lives in the container, so it
+// carries over to later warm invocations.
+
+var errParticleUnavailable = errors.New("particle cloud unavailable")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen // A probe call is in flight
+)
+
+// circuitBreaker counts consecutive failures; a zero threshold disables it
+type circuitBreaker struct {
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+
+	threshold int
+	cooldown  time.Duration
+}
+
+var particleBreaker = &circuitBreaker{}
+
+// allow reports whether a call may go ahead, letting one probe through once
+// the cooldown is over
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		fmt.Println("Particle breaker half-open - probing")
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+// record notes the outcome of a call that was allowed
+func (b *circuitBreaker) record(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ok {
+		if b.state != breakerClosed {
+			fmt.Println("Particle breaker closed - calls are working again")
+		}
+		b.state, b.failures = breakerClosed, 0
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || (b.threshold > 0 && b.failures >= b.threshold) {
+		if b.state != breakerOpen {
+			fmt.Printf("Particle breaker open after %d consecutive failures - failing calls for %s\n", b.failures, b.cooldown)
+		}
+		b.state, b.openedAt = breakerOpen, time.Now()
+	}
+}
+
+// release hands back a call that finished without an outcome, so a probe
+// can be tried again
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen
+	}
+}
+
+// breakerTransport guards Particle round trips with the breaker
+type breakerTransport struct {
+	base    http.RoundTripper
+	breaker *circuitBreaker
+}
+
+func (t breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.breaker.threshold <= 0 {
+		return t.base.RoundTrip(req)
+	}
+	if !t.breaker.allow() {
+		return nil, fmt.Errorf("%w: breaker open after repeated failures", errParticleUnavailable)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if errors.Is(req.Context().Err(), context.Canceled) {
+		// The caller gave up; that says nothing about Particle
+		t.breaker.release()
+		return resp, err
+	}
+	t.breaker.record(err == nil && resp.StatusCode < http.StatusInternalServerError)
+	return resp, err
+}
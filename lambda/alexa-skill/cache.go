@@ -0,0 +1,193 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// cachedValue holds a single value with an expiry. It is safe for concurrent
+// use, since one invocation can read it from several goroutines, e.g. the
+// per-door fetches of an all-doors summary, and refreshes are single-flight:
+// when the value expires, only one caller runs the fetch while the others
+// wait for and share its result.
+type cachedValue[T any] struct {
+	mu        sync.RWMutex
+	value     T
+	fetchedAt time.Time
+	valid     bool
+	ttl       time.Duration
+
+	// refreshMu serializes fetches so a stampede of reads after expiry
+	// triggers a single upstream call
+	refreshMu sync.Mutex
+}
+
+// newCachedValue creates an empty cache whose entries live for ttl
+func newCachedValue[T any](ttl time.Duration) *cachedValue[T] {
+	return &cachedValue[T]{ttl: ttl}
+}
+
+// Peek returns the cached value and when it was fetched, if it hasn't expired
+func (c *cachedValue[T]) Peek() (T, time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.valid || time.Since(c.fetchedAt) >= c.ttl {
+		var zero T
+		return zero, time.Time{}, false
+	}
+	return c.value, c.fetchedAt, true
+}
+
+// Get returns the cached value and when it was fetched, calling fetch to
+// refresh it if it is missing or expired. Fetch errors are returned as-is
+// and nothing is cached.
+func (c *cachedValue[T]) Get(fetch func() (T, error)) (T, time.Time, error) {
+	return c.GetIf(fetch, nil)
+}
+
+// GetIf is Get, but a fetched value is only cached if keep approves it; a
+// nil keep caches every value
+func (c *cachedValue[T]) GetIf(fetch func() (T, error), keep func(T) bool) (T, time.Time, error) {
+	if value, fetchedAt, ok := c.Peek(); ok {
+		return value, fetchedAt, nil
+	}
+
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	// Another caller may have refreshed while we waited
+	if value, fetchedAt, ok := c.Peek(); ok {
+		return value, fetchedAt, nil
+	}
+
+	value, err := fetch()
+	if err != nil {
+		var zero T
+		return zero, time.Time{}, err
+	}
+
+	if keep == nil || keep(value) {
+		c.Set(value)
+	}
+	return value, time.Now(), nil
+}
+
+// Set stores a value, restarting its expiry
+func (c *cachedValue[T]) Set(value T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.value = value
+	c.fetchedAt = time.Now()
+	c.valid = true
+}
+
+// Invalidate drops the cached value so the next Get fetches again
+func (c *cachedValue[T]) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero T
+	c.value = zero
+	c.valid = false
+}
+
+// keyedCache is a set of cachedValues sharing a ttl, e.g. one per device
+type keyedCache[K comparable, V any] struct {
+	mu      sync.Mutex
+	entries map[K]*cachedValue[V]
+	ttl     time.Duration
+	pruned  time.Time // Last time expired entries were dropped
+}
+
+// newKeyedCache creates an empty keyed cache whose entries live for ttl
+func newKeyedCache[K comparable, V any](ttl time.Duration) *keyedCache[K, V] {
+	return &keyedCache[K, V]{
+		entries: make(map[K]*cachedValue[V]),
+		ttl:     ttl,
+	}
+}
+
+// For returns the cache for key, creating it on first use. Expired entries
+// are dropped at most once per ttl, so keys that stop being used, such as
+// past users, don't pile up for the life of the container.
+func (c *keyedCache[K, V]) For(key K) *cachedValue[V] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.pruned) >= c.ttl {
+		c.prune()
+	}
+
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = newCachedValue[V](c.ttl)
+		c.entries[key] = entry
+	}
+	return entry
+}
+
+// prune drops expired entries, except any being refreshed right now, whose
+// callers are still waiting on them. c.mu must be held.
+func (c *keyedCache[K, V]) prune() {
+	for key, entry := range c.entries {
+		if _, _, ok := entry.Peek(); ok || !entry.refreshMu.TryLock() {
+			continue
+		}
+		delete(c.entries, key)
+		entry.refreshMu.Unlock()
+	}
+	c.pruned = time.Now()
+}
+
+// InvalidateWhere invalidates every entry whose key matches
+func (c *keyedCache[K, V]) InvalidateWhere(match func(K) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, entry := range c.entries {
+		if match(key) {
+			entry.Invalidate()
+		}
+	}
+}
+
+// responseCacheKey scopes a cached response to one user, so a response is
+// only ever replayed to the user it was built for
+type responseCacheKey struct {
+	DeviceID string
+	UserID   string
+	Screen   bool   // Screen devices get an extra APL directive
+	Locale   string // The open duration is worded per locale
+}
+
+// responseCache holds formatted status responses, when RESPONSE_CACHE_SECONDS
+// is set
+var responseCache *keyedCache[responseCacheKey, AlexaResponse]
+
+// cachedResponse serves a user's recent status response for a device, or
+// builds a new one. Only answers from a live reading are cached, so an error
+// or a fallback answer isn't replayed after the door is reachable again.
+// Callers must check access first.
+func cachedResponse(deviceID, userID string, screen bool, locale string, build func() (AlexaResponse, error)) (AlexaResponse, error) {
+	if responseCache == nil || userID == "" {
+		return build()
+	}
+
+	key := responseCacheKey{DeviceID: deviceID, UserID: userID, Screen: screen, Locale: locale}
+	response, _, err := responseCache.For(key).GetIf(build, func(response AlexaResponse) bool {
+		return response.live && !response.failed
+	})
+	return response, err
+}
+
+// invalidateResponses drops every user's cached responses for a device
+func invalidateResponses(deviceID string) {
+	if responseCache == nil {
+		return
+	}
+	responseCache.InvalidateWhere(func(key responseCacheKey) bool {
+		return key.DeviceID == deviceID
+	})
+}
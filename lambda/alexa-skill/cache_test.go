@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useResponseCache turns on the response cache and ALLOWED_USERS for the
+// length of the test, with the single door dev1 reporting status
+func useResponseCache(t *testing.T, access map[string][]string, status func() (int, string)) *int32 {
+	t.Helper()
+	var calls int32
+	fakeParticle(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		code, body := status()
+		w.WriteHeader(code)
+		io.WriteString(w, body)
+	})
+
+	deviceID, cache, users, stored := particleDeviceID, responseCache, userAccess, storedStatusMaxAge
+	particleDeviceID, responseCache, userAccess, storedStatusMaxAge = "dev1", newKeyedCache[responseCacheKey, AlexaResponse](time.Minute), access, 0
+	t.Cleanup(func() {
+		particleDeviceID, responseCache, userAccess, storedStatusMaxAge = deviceID, cache, users, stored
+	})
+	return &calls
+}
+
+// statusRequest is a GetStatusIntent request from userID
+func statusRequest(userID string) AlexaRequest {
+	var request AlexaRequest
+	request.Session.User.UserID = userID
+	request.Request.Type = "IntentRequest"
+	request.Request.Locale = "en-US"
+	request.Request.Intent = Intent{Name: "GetStatusIntent"}
+	return request
+}
+
+// spoken returns what a response says, whether plain text or SSML
+func spoken(response AlexaResponse) string {
+	if response.Response.OutputSpeech == nil {
+		return ""
+	}
+	return response.Response.OutputSpeech.Text + response.Response.OutputSpeech.SSML
+}
+
+func TestResponseCacheUnauthorizedUser(t *testing.T) {
+	calls := useResponseCache(t, map[string][]string{"owner": {"*"}}, func() (int, string) {
+		return 200, `{"result":"open"}`
+	})
+	ctx := context.Background()
+
+	owner, err := handleDeviceIntent(ctx, statusRequest("owner"))
+	if err != nil || !strings.Contains(spoken(owner), "open") {
+		t.Fatalf("owner's answer = %q, %v; want the status", spoken(owner), err)
+	}
+	// An open door is also checked for obstructions, so count from here
+	built := atomic.LoadInt32(calls)
+	if _, err := handleDeviceIntent(ctx, statusRequest("owner")); err != nil || atomic.LoadInt32(calls) != built {
+		t.Fatalf("owner's second answer made %d more Particle calls, want none (a cache hit)", atomic.LoadInt32(calls)-built)
+	}
+
+	stranger, err := handleDeviceIntent(ctx, statusRequest("stranger"))
+	if err != nil {
+		t.Fatalf("handleDeviceIntent: %v", err)
+	}
+	if got := spoken(stranger); got == spoken(owner) || !strings.Contains(got, "don't have access") {
+		t.Errorf("stranger heard %q, want an access refusal", got)
+	}
+	if _, _, hit := responseCache.For(responseCacheKey{DeviceID: "dev1", UserID: "stranger", Locale: "en-US"}).Peek(); hit {
+		t.Error("stranger has a cached response")
+	}
+	if n := atomic.LoadInt32(calls); n != built {
+		t.Errorf("stranger's request made %d Particle calls, want none", n-built)
+	}
+}
+
+func TestResponseCacheSkipsFailures(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	calls := useResponseCache(t, nil, func() (int, string) {
+		if failing.Load() {
+			return 500, `oops`
+		}
+		return 200, `{"result":"closed"}`
+	})
+	ctx := context.Background()
+
+	first, err := handleDeviceIntent(ctx, statusRequest("owner"))
+	if err != nil || !first.failed {
+		t.Fatalf("first answer = %q, %v; want a failure", spoken(first), err)
+	}
+
+	failing.Store(false)
+	second, err := handleDeviceIntent(ctx, statusRequest("owner"))
+	if err != nil || second.failed || !strings.Contains(spoken(second), "closed") {
+		t.Fatalf("second answer = %q, %v; want the live status, not the cached failure", spoken(second), err)
+	}
+	if n := atomic.LoadInt32(calls); n != 2 {
+		t.Errorf("Particle calls = %d, want 2", n)
+	}
+}
+
+func TestCachedResponseKeepsOnlyLiveAnswers(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   AlexaResponse
+		wantBuilds int
+	}{
+		{name: "live", response: AlexaResponse{live: true}, wantBuilds: 1},
+		{name: "not live", response: AlexaResponse{}, wantBuilds: 2},
+		{name: "failed", response: AlexaResponse{live: true, failed: true}, wantBuilds: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := responseCache
+			responseCache = newKeyedCache[responseCacheKey, AlexaResponse](time.Minute)
+			defer func() { responseCache = saved }()
+
+			builds := 0
+			build := func() (AlexaResponse, error) {
+				builds++
+				return tt.response, nil
+			}
+			cachedResponse("dev1", "owner", false, "en-US", build)
+			cachedResponse("dev1", "owner", false, "en-US", build)
+			if builds != tt.wantBuilds {
+				t.Errorf("builds = %d, want %d", builds, tt.wantBuilds)
+			}
+		})
+	}
+}
+
+func TestKeyedCachePrunesExpiredEntries(t *testing.T) {
+	cache := newKeyedCache[string, int](10 * time.Millisecond)
+	cache.For("old").Set(1)
+	time.Sleep(20 * time.Millisecond)
+
+	cache.For("new").Set(2)
+	if _, ok := cache.entries["old"]; ok {
+		t.Error("expired entry was kept")
+	}
+	if _, ok := cache.entries["new"]; !ok {
+		t.Error("new entry is missing")
+	}
+}
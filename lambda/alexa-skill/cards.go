@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Card styles. Simple cards carry text only; Standard cards add an image and
+// put their text in "text" rather than "content".
+const (
+	cardStyleSimple   = "Simple"
+	cardStyleStandard = "Standard"
+)
+
+// Status card images, from STATUS_OPEN_IMAGE_URL and STATUS_CLOSED_IMAGE_URL.
+// cardStyle is Standard only when both are set to https URLs, which Alexa
+// requires for card images.
+var (
+	openImageURL   string
+	closedImageURL string
+	cardStyle      = cardStyleSimple
+)
+
+// CardImage is the image on a Standard card. Alexa picks the size to show
+// from the device; both may be the same URL.
+type CardImage struct {
+	SmallImageURL string `json:"smallImageUrl,omitempty"`
+	LargeImageURL string `json:"largeImageUrl,omitempty"`
+}
+
+// configureCardStyle picks the card style from the image URLs
+func configureCardStyle() {
+	if openImageURL == "" && closedImageURL == "" {
+		return
+	}
+	if !strings.HasPrefix(openImageURL, "https://") || !strings.HasPrefix(closedImageURL, "https://") {
+		fmt.Println("WARNING: STATUS_OPEN_IMAGE_URL and STATUS_CLOSED_IMAGE_URL must both be https URLs - using Simple cards")
+		return
+	}
+	cardStyle = cardStyleStandard
+}
+
+// buildStatusCard builds the card for a status response, with an open or
+// closed icon when the Standard style is configured
+func buildStatusCard(text, status string, loc speechLocale) *Card {
+	imageURL := map[string]string{"open": openImageURL, "closed": closedImageURL}[status]
+	if cardStyle != cardStyleStandard || imageURL == "" {
+		return &Card{Type: cardStyleSimple, Title: loc.CardTitle, Content: text}
+	}
+
+	return &Card{
+		Type:  cardStyleStandard,
+		Title: loc.CardTitle,
+		Text:  text,
+		Image: &CardImage{SmallImageURL: imageURL, LargeImageURL: imageURL},
+	}
+}
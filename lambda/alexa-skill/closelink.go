@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Close links let the open-door notification close the door. The monitor
+// signs deviceId|expires|nonce with CLOSE_LINK_SECRET and stores the nonce on
+// DoorState; this function's URL checks the signature and expiry and consumes
+// the nonce, so each link works once.
+
+var errCloseLinkUsed = errors.New("close link already used")
+
+// signCloseLink computes the signature for a close link. It must match the
+// monitor's copy.
+func signCloseLink(deviceID string, expires int64, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(closeLinkSecret))
+	fmt.Fprintf(mac, "%s|%d|%s", deviceID, expires, nonce)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// handleHTTPRequest serves requests to the function URL: Particle webhooks on
+// /webhook and close links on /close. For close links, GET shows a
+// confirmation page and only its POST closes the door, so link previews in
+// messaging apps can't trigger it.
+func handleHTTPRequest(ctx context.Context, request events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+	if webhookSecret != "" && request.RawPath == "/webhook" {
+		return handleWebhook(ctx, request)
+	}
+	if closeLinkSecret == "" || request.RawPath != "/close" {
+		return htmlResponse(http.StatusNotFound, "Not found."), nil
+	}
+
+	deviceID, nonce, err := verifyCloseLink(request.QueryStringParameters, now())
+	if err != nil {
+		fmt.Printf("Rejected close link: %v\n", err)
+		return htmlResponse(http.StatusForbidden, "This link is invalid or has expired."), nil
+	}
+
+	switch request.RequestContext.HTTP.Method {
+	case http.MethodGet:
+		body := fmt.Sprintf(`<p>Close %s?</p><form method="post"><button type="submit">Close the door</button></form>`,
+			html.EscapeString(spokenName(deviceID)))
+		return htmlResponse(http.StatusOK, body), nil
+	case http.MethodPost:
+		return closeFromLink(ctx, deviceID, nonce)
+	default:
+		return htmlResponse(http.StatusMethodNotAllowed, "Method not allowed."), nil
+	}
+}
+
+// verifyCloseLink checks a link's signature and expiry, returning the device
+// and nonce it was issued for
+func verifyCloseLink(params map[string]string, current time.Time) (string, string, error) {
+	deviceID, nonce := params["device"], params["nonce"]
+	expires, err := strconv.ParseInt(params["expires"], 10, 64)
+	if deviceID == "" || nonce == "" || err != nil {
+		return "", "", fmt.Errorf("missing link parameters")
+	}
+
+	expected := signCloseLink(deviceID, expires, nonce)
+	if !hmac.Equal([]byte(expected), []byte(params["sig"])) {
+		return "", "", fmt.Errorf("bad signature")
+	}
+	if current.Unix() > expires {
+		return "", "", fmt.Errorf("link expired at %d", expires)
+	}
+
+	return deviceID, nonce, nil
+}
+
+// closeFromLink consumes the link and closes the door if it is still open
+func closeFromLink(ctx context.Context, deviceID, nonce string) (events.LambdaFunctionURLResponse, error) {
+	if err := consumeCloseLink(ctx, deviceID, nonce); err != nil {
+		if errors.Is(err, errCloseLinkUsed) {
+			return htmlResponse(http.StatusGone, "This link has already been used."), nil
+		}
+		fmt.Printf("Error consuming close link: %v\n", err)
+		return htmlResponse(http.StatusInternalServerError, "Something went wrong. Please try again."), nil
+	}
+
+	name := spokenName(deviceID)
+
+	// The button toggles the door, so pressing it on a closed door would open it
+	reading, err := fetchDoorStatus(ctx, deviceID, StatusOptions{})
+	if err != nil {
+		fmt.Printf("Error getting status: %v\n", err)
+		return htmlResponse(http.StatusBadGateway, "I couldn't reach the controller, so nothing was pressed."), nil
+	}
+	if reading.Status != "open" {
+		return htmlResponse(http.StatusOK, fmt.Sprintf("%s is %s, so nothing was pressed.",
+			html.EscapeString(capitalize(name)), html.EscapeString(reading.Status))), nil
+	}
+
+	success, err := callParticleFunction(ctx, deviceID, "pressButton", "")
+	if err != nil || !success {
+		fmt.Printf("Error pressing button from close link: %v\n", err)
+		return htmlResponse(http.StatusBadGateway, "I couldn't press the button. Please try again from the app."), nil
+	}
+
+	if statusCache != nil {
+		statusCache.For(deviceID).Invalidate()
+	}
+	invalidateResponses(deviceID)
+	if err := updateButtonPress(ctx, deviceID); err != nil {
+		fmt.Printf("Error updating button press in DynamoDB: %v\n", err)
+	}
+
+	return htmlResponse(http.StatusOK, fmt.Sprintf("Closing %s.", html.EscapeString(name))), nil
+}
+
+// consumeCloseLink removes the nonce from the door state, failing with
+// errCloseLinkUsed if it is no longer the current one
+func consumeCloseLink(ctx context.Context, deviceID, nonce string) error {
+	_, err := dynamoClient.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(doorStateTable),
+		Key:                 stateKey(deviceID),
+		UpdateExpression:    aws.String("REMOVE closeLinkNonce"),
+		ConditionExpression: aws.String("closeLinkNonce = :nonce"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":nonce": {S: aws.String(nonce)},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return errCloseLinkUsed
+		}
+		return fmt.Errorf("error updating item in DynamoDB: %w", err)
+	}
+	return nil
+}
+
+func htmlResponse(status int, body string) events.LambdaFunctionURLResponse {
+	return events.LambdaFunctionURLResponse{
+		StatusCode: status,
+		Headers: map[string]string{
+			"Content-Type":  "text/html; charset=utf-8",
+			"Cache-Control": "no-store",
+		},
+		Body: "<!DOCTYPE html><html><body>" + body + "</body></html>",
+	}
+}
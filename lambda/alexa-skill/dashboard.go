@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// DirectCommand is the payload for invoking the function directly (e.g. from
+// a dashboard or `aws lambda invoke`) rather than through Alexa
+type DirectCommand struct {
+	Action   string `json:"action"`
+	DeviceID string `json:"deviceId,omitempty"` // Defaults to the primary device
+}
+
+// DoorStateView is the stored DoorState plus values derived from it at read
+// time, for dashboards that shouldn't have to recompute them
+type DoorStateView struct {
+	DoorState
+	IsOpen              bool  `json:"isOpen"`
+	OpenDurationSeconds int64 `json:"openDurationSeconds"`
+	ThresholdMinutes    int   `json:"thresholdMinutes"`
+	// NotificationPending means the door has been open past the threshold
+	// but the monitor hasn't sent the alert yet
+	NotificationPending bool `json:"notificationPending"`
+}
+
+// StatusView is a door status reading returned to direct callers
+type StatusView struct {
+	DeviceID string `json:"deviceId"`
+	Status   string `json:"status"`
+	Position *int   `json:"position,omitempty"` // Percent open, for position sensors
+	Source   string `json:"source"`
+	AsOf     int64  `json:"asOf"` // Unix timestamp of the reading
+}
+
+// newStatusView flattens a reading for JSON
+func newStatusView(deviceID string, reading statusReading) StatusView {
+	view := StatusView{
+		DeviceID: deviceID,
+		Status:   reading.Status,
+		Source:   reading.Source,
+		AsOf:     reading.AsOf.Unix(),
+	}
+	if reading.HasPosition {
+		position := reading.Position
+		view.Position = &position
+	}
+	return view
+}
+
+// HandleInvocation routes a raw Lambda payload to the Alexa handler, the
+// direct command handler or, for function URL requests, the HTTP handler
+func HandleInvocation(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	ctx = withRetryBudget(ctx)
+
+	var probe struct {
+		Action         string          `json:"action"`
+		Request        json.RawMessage `json:"request"`
+		RequestContext json.RawMessage `json:"requestContext"`
+	}
+	if err := json.Unmarshal(payload, &probe); err != nil {
+		return nil, fmt.Errorf("error unmarshaling payload: %w", err)
+	}
+
+	if probe.RequestContext != nil {
+		var request events.LambdaFunctionURLRequest
+		if err := json.Unmarshal(payload, &request); err != nil {
+			return nil, fmt.Errorf("error unmarshaling HTTP request: %w", err)
+		}
+		return handleHTTPRequest(ctx, request)
+	}
+
+	if probe.Action != "" && probe.Request == nil {
+		var command DirectCommand
+		if err := json.Unmarshal(payload, &command); err != nil {
+			return nil, fmt.Errorf("error unmarshaling command: %w", err)
+		}
+		return handleDirectCommand(ctx, command)
+	}
+
+	var request AlexaRequest
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return nil, fmt.Errorf("error unmarshaling Alexa request: %w", err)
+	}
+	return HandleRequest(ctx, request)
+}
+
+func handleDirectCommand(ctx context.Context, command DirectCommand) (interface{}, error) {
+	fmt.Printf("Direct command: %s\n", command.Action)
+
+	deviceID := command.DeviceID
+	if deviceID == "" {
+		deviceID = defaultDeviceID()
+	}
+
+	switch command.Action {
+	case "state":
+		state, err := getDoorState(ctx, deviceID)
+		if err != nil {
+			return nil, err
+		}
+		if state == nil {
+			state = &DoorState{
+				DeviceID: deviceID,
+				Status:   "unknown",
+			}
+		}
+		return newDoorStateView(*state, now()), nil
+	case "status":
+		// Dashboards act on what they show, so always read the sensor
+		reading, err := fetchDoorStatus(ctx, deviceID, StatusOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return newStatusView(deviceID, reading), nil
+	case "warmup":
+		// Sent by the keep-warm schedule to keep a container and its
+		// Particle connection ready
+		warmParticleConnection(ctx)
+		return map[string]string{"status": "warm"}, nil
+	default:
+		return nil, fmt.Errorf("unknown action: %s", command.Action)
+	}
+}
+
+// newDoorStateView computes the derived fields as of now. The open duration
+// comes from LastOpenedTime rather than the persisted DurationOpenMins, which
+// is only as fresh as the last monitor run.
+func newDoorStateView(state DoorState, current time.Time) DoorStateView {
+	view := DoorStateView{
+		DoorState:        state,
+		IsOpen:           state.Status == "open",
+		ThresholdMinutes: thresholdMinutes,
+	}
+	if state.AlertThresholdMins > 0 {
+		view.ThresholdMinutes = state.AlertThresholdMins
+	}
+
+	if view.IsOpen && state.LastOpenedTime > 0 {
+		view.OpenDurationSeconds = current.Unix() - state.LastOpenedTime
+		if view.OpenDurationSeconds < 0 {
+			view.OpenDurationSeconds = 0
+		}
+		view.NotificationPending = !state.NotificationSent &&
+			view.OpenDurationSeconds >= int64(view.ThresholdMinutes)*60
+	}
+
+	return view
+}
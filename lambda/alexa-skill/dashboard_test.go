@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewDoorStateView(t *testing.T) {
+	current := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) int64 { return current.Add(-d).Unix() }
+
+	saved := thresholdMinutes
+	thresholdMinutes = 30
+	defer func() { thresholdMinutes = saved }()
+
+	tests := []struct {
+		name          string
+		state         DoorState
+		wantOpen      bool
+		wantSeconds   int64
+		wantThreshold int
+		wantPending   bool
+	}{
+		{
+			name:          "open under the threshold",
+			state:         DoorState{Status: "open", LastOpenedTime: ago(10 * time.Minute)},
+			wantOpen:      true,
+			wantSeconds:   600,
+			wantThreshold: 30,
+		},
+		{
+			name:          "open past the threshold, alert not sent",
+			state:         DoorState{Status: "open", LastOpenedTime: ago(45 * time.Minute)},
+			wantOpen:      true,
+			wantSeconds:   2700,
+			wantThreshold: 30,
+			wantPending:   true,
+		},
+		{
+			name:          "open past the threshold, alert sent",
+			state:         DoorState{Status: "open", LastOpenedTime: ago(45 * time.Minute), NotificationSent: true},
+			wantOpen:      true,
+			wantSeconds:   2700,
+			wantThreshold: 30,
+		},
+		{
+			name:          "door's own threshold",
+			state:         DoorState{Status: "open", LastOpenedTime: ago(45 * time.Minute), AlertThresholdMins: 60},
+			wantOpen:      true,
+			wantSeconds:   2700,
+			wantThreshold: 60,
+		},
+		{
+			// Exactly at the threshold counts as past it, as the monitor does
+			name:          "open exactly at the threshold",
+			state:         DoorState{Status: "open", LastOpenedTime: ago(30 * time.Minute)},
+			wantOpen:      true,
+			wantSeconds:   1800,
+			wantThreshold: 30,
+			wantPending:   true,
+		},
+		{
+			// A clock behind the stored open time isn't a negative duration
+			name:          "opened in the future",
+			state:         DoorState{Status: "open", LastOpenedTime: current.Add(time.Minute).Unix()},
+			wantOpen:      true,
+			wantThreshold: 30,
+		},
+		{
+			name:          "open without an open time",
+			state:         DoorState{Status: "open"},
+			wantOpen:      true,
+			wantThreshold: 30,
+		},
+		{
+			// Closed since 20 minutes ago; the old open time isn't a duration
+			name:          "closed",
+			state:         DoorState{Status: "closed", LastOpenedTime: ago(2 * time.Hour), LastClosedTime: ago(20 * time.Minute)},
+			wantThreshold: 30,
+		},
+		{
+			name:          "unknown",
+			state:         DoorState{Status: "unknown", LastOpenedTime: ago(2 * time.Hour)},
+			wantThreshold: 30,
+		},
+		{
+			// A status guessed from presses isn't a reading, so it isn't shown as open
+			name:          "assumed open",
+			state:         DoorState{AssumedStatus: "open", LastButtonPress: ago(time.Hour)},
+			wantThreshold: 30,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.state.DeviceID = "dev1"
+			view := newDoorStateView(tt.state, current)
+			if view.IsOpen != tt.wantOpen || view.OpenDurationSeconds != tt.wantSeconds ||
+				view.ThresholdMinutes != tt.wantThreshold || view.NotificationPending != tt.wantPending {
+				t.Errorf("view = open %t for %ds, threshold %d, pending %t; want open %t for %ds, threshold %d, pending %t",
+					view.IsOpen, view.OpenDurationSeconds, view.ThresholdMinutes, view.NotificationPending,
+					tt.wantOpen, tt.wantSeconds, tt.wantThreshold, tt.wantPending)
+			}
+			if !reflect.DeepEqual(view.DoorState, tt.state) {
+				t.Errorf("view state = %+v, want the stored state unchanged", view.DoorState)
+			}
+		})
+	}
+}
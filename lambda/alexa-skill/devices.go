@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Device is one door controller from the device map
+type Device struct {
+	Name       string // Name the user says for the Door slot, e.g. "workshop"
+	ID         string // Particle device ID
+	SpokenName string // How responses refer to the door, e.g. "the workshop roll-up"
+	SortOrder  int    // Position in all-door summaries; 0 sorts after numbered doors
+}
+
+// deviceMapEntry is the object form of a DEVICE_MAP value
+type deviceMapEntry struct {
+	ID         string `json:"id"`
+	SpokenName string `json:"spokenName"`
+	SortOrder  int    `json:"sortOrder"`
+}
+
+// defaultSpokenName is used when no friendly name is configured
+const defaultSpokenName = "the garage door"
+
+// devices is loaded from DEVICE_MAP. When it is empty the skill controls the
+// single PARTICLE_DEVICE_ID.
+var devices []Device
+
+// loadDeviceMap parses DEVICE_MAP, a JSON object of door name to either a
+// Particle device ID or an object with the ID and a spoken name, e.g.
+// {"garage":"e00fce68...","workshop":{"id":"e00fce69...","spokenName":"the workshop roll-up"}}
+func loadDeviceMap(raw string) ([]Device, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var byName map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &byName); err != nil {
+		return nil, fmt.Errorf("error parsing DEVICE_MAP: %w", err)
+	}
+
+	loaded := make([]Device, 0, len(byName))
+	for name, value := range byName {
+		var entry deviceMapEntry
+		if err := json.Unmarshal(value, &entry.ID); err != nil {
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return nil, fmt.Errorf("error parsing DEVICE_MAP entry %q: %w", name, err)
+			}
+		}
+		if entry.ID == "" {
+			return nil, fmt.Errorf("DEVICE_MAP entry %q has no device ID", name)
+		}
+		loaded = append(loaded, Device{
+			Name:       strings.ToLower(name),
+			ID:         entry.ID,
+			SpokenName: entry.SpokenName,
+			SortOrder:  entry.SortOrder,
+		})
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].Name < loaded[j].Name })
+
+	return loaded, nil
+}
+
+// defaultDeviceID is the device used when a request doesn't name a door
+func defaultDeviceID() string {
+	if particleDeviceID == "" && len(devices) > 0 {
+		return devices[0].ID
+	}
+	return particleDeviceID
+}
+
+// Friendly names set by voice are stored on DoorState and remembered here
+// once read, so spokenName doesn't need a DynamoDB read of its own
+var (
+	friendlyNamesMu sync.RWMutex
+	friendlyNames   = map[string]string{} // Device ID to stored name; "" if it has none
+)
+
+// rememberFriendlyName records the stored name read for a device
+func rememberFriendlyName(deviceID, name string) {
+	friendlyNamesMu.Lock()
+	defer friendlyNamesMu.Unlock()
+	friendlyNames[deviceID] = name
+}
+
+// storedFriendlyName returns a device's stored name; known is false if its
+// state hasn't been read yet
+func storedFriendlyName(deviceID string) (name string, known bool) {
+	friendlyNamesMu.RLock()
+	defer friendlyNamesMu.RUnlock()
+	name, known = friendlyNames[deviceID]
+	return name, known
+}
+
+// loadFriendlyName reads a device's state once per container so responses
+// use its stored name
+func loadFriendlyName(ctx context.Context, deviceID string) {
+	if _, known := storedFriendlyName(deviceID); known || doorStateTable == "" {
+		return
+	}
+	// getDoorState remembers the name
+	if _, err := getDoorState(ctx, deviceID); err != nil {
+		fmt.Printf("Error loading friendly name: %v\n", err)
+	}
+}
+
+// spokenName is how responses refer to a device, e.g. "the workshop door".
+// A name stored by RenameDoorIntent wins over DEVICE_MAP.
+func spokenName(deviceID string) string {
+	if name, _ := storedFriendlyName(deviceID); name != "" {
+		return name
+	}
+	for _, device := range devices {
+		if device.ID != deviceID {
+			continue
+		}
+		if device.SpokenName != "" {
+			return device.SpokenName
+		}
+		if strings.HasSuffix(device.Name, "door") {
+			return "the " + device.Name
+		}
+		return "the " + device.Name + " door"
+	}
+	return defaultSpokenName
+}
+
+// capitalize upper-cases the first letter so a spoken name can start a sentence
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// findDevice looks up a door by its name in DEVICE_MAP or else its stored
+// friendly name
+func findDevice(name string) (Device, bool) {
+	if device, ok := configuredDevice(name); ok {
+		return device, true
+	}
+
+	name = bareDoorName(name)
+	for _, device := range devices {
+		if friendly, _ := storedFriendlyName(device.ID); friendly != "" && bareDoorName(friendly) == name {
+			return device, true
+		}
+	}
+	return Device{}, false
+}
+
+// configuredDevice looks up a door by its name in DEVICE_MAP only. Anyone
+// who can use a door can rename it, so a friendly name must not decide
+// anything about access.
+func configuredDevice(name string) (Device, bool) {
+	name = bareDoorName(name)
+
+	for _, device := range devices {
+		if device.Name == name || bareDoorName(device.Name) == name {
+			return device, true
+		}
+	}
+	return Device{}, false
+}
+
+// doorNameTaken reports whether renaming deviceID to name would clash with
+// a door name in DEVICE_MAP or another door's friendly name
+func doorNameTaken(ctx context.Context, deviceID, name string) bool {
+	if _, ok := configuredDevice(name); ok {
+		return true
+	}
+
+	name = bareDoorName(name)
+	for _, device := range devices {
+		if device.ID == deviceID {
+			continue
+		}
+		loadFriendlyName(ctx, device.ID)
+		if friendly, _ := storedFriendlyName(device.ID); friendly != "" && bareDoorName(friendly) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// bareDoorName strips "the" and "door" so "the workshop door" matches "workshop"
+func bareDoorName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.TrimPrefix(name, "the ")
+	return strings.TrimSuffix(name, " door")
+}
+
+// resolveDevice picks the device an intent refers to. If the Door slot is
+// missing and there are several doors, it uses the user's last operated door
+// with DEFAULT_TO_LAST_DOOR, or else returns a response asking which one; the
+// caller must return that response as-is.
+func resolveDevice(ctx context.Context, intent Intent, userID string) (string, *AlexaResponse) {
+	if len(devices) == 0 {
+		return particleDeviceID, nil
+	}
+
+	name := slotValue(intent, "Door")
+	if name == "" {
+		if len(devices) == 1 {
+			return devices[0].ID, nil
+		}
+		if deviceID, ok := lastOperatedDevice(ctx, userID); ok {
+			fmt.Printf("No door named - using %s, last operated by this user\n", deviceID)
+			return deviceID, nil
+		}
+
+		speech := fmt.Sprintf("Which door? You can say %s.", doorNameList())
+		response := buildElicitSlotResponse(speech, "Door", intent)
+		return "", &response
+	}
+
+	device, ok := findDevice(name)
+	if !ok {
+		speech := fmt.Sprintf("I don't know a door called %s. You can say %s.", name, doorNameList())
+		response := buildElicitSlotResponse(speech, "Door", intent)
+		return "", &response
+	}
+
+	return device.ID, nil
+}
+
+// doorNameList renders the configured door names as "garage or workshop"
+func doorNameList() string {
+	names := make([]string, len(devices))
+	for i, device := range devices {
+		names[i] = device.Name
+	}
+
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return names[0]
+	default:
+		return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+	}
+}
+
+// particleIDPattern matches a Particle device ID, 24 hex characters
+var particleIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{24}$`)
+
+// normalizeDeviceID checks that PARTICLE_DEVICE_ID is a device ID rather than
+// a device name, which otherwise only shows up as 404s from Particle. With
+// resolve set, a name is looked up in the account's device list and the
+// resolved ID is returned for init() to keep for the life of the container.
+func normalizeDeviceID(value string, resolve bool) string {
+	value = strings.TrimSpace(value)
+	if value == "" || particleIDPattern.MatchString(value) {
+		return strings.ToLower(value)
+	}
+
+	if !resolve {
+		fmt.Printf("ERROR: PARTICLE_DEVICE_ID %q is not a 24-character device ID. Use the ID from the Particle console, or set PARTICLE_RESOLVE_DEVICE_NAME=true to look it up by name.\n", value)
+		return value
+	}
+
+	id, err := resolveDeviceName(value)
+	if err != nil {
+		fmt.Printf("ERROR: could not resolve Particle device name %q: %v\n", value, err)
+		return value
+	}
+
+	fmt.Printf("Resolved Particle device name %q to ID %s\n", value, id)
+	return id
+}
+
+// resolveDeviceName finds a device ID by name in the Particle device list
+func resolveDeviceName(name string) (string, error) {
+	// Runs in init(), so keep it from dragging out a cold start
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", particleAPIBase+"/devices", nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", particleAccessToken))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("particle API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var list []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return "", fmt.Errorf("error unmarshaling response: %w", err)
+	}
+
+	for _, device := range list {
+		if strings.EqualFold(device.Name, name) {
+			return device.ID, nil
+		}
+	}
+	return "", fmt.Errorf("no device named %q on this account", name)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// useDevices sets DEVICE_MAP to garage (dev1) and workshop (dev2) for the
+// length of the test, with friendly giving their stored names
+func useDevices(t *testing.T, friendly map[string]string) {
+	t.Helper()
+	saved := devices
+	devices = []Device{{Name: "garage", ID: "dev1"}, {Name: "workshop", ID: "dev2"}}
+
+	friendlyNamesMu.Lock()
+	savedNames := friendlyNames
+	friendlyNames = map[string]string{"dev1": "", "dev2": ""}
+	for id, name := range friendly {
+		friendlyNames[id] = name
+	}
+	friendlyNamesMu.Unlock()
+
+	t.Cleanup(func() {
+		devices = saved
+		friendlyNamesMu.Lock()
+		friendlyNames = savedNames
+		friendlyNamesMu.Unlock()
+	})
+}
+
+func TestRenameDoorRejectsTakenNames(t *testing.T) {
+	useDevices(t, map[string]string{"dev2": "the shed door"})
+	fakeDoorState(t, `{"deviceId":{"S":"dev1"}}`)
+
+	tests := []struct {
+		newName string
+		taken   bool
+	}{
+		{"workshop", true},          // Another door's DEVICE_MAP name
+		{"the workshop door", true}, // The same, as it would be normalized
+		{"garage", true},            // This door's own DEVICE_MAP name
+		{"shed", true},              // Another door's friendly name
+		{"side", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.newName, func(t *testing.T) {
+			intent := Intent{Name: "RenameDoorIntent", Slots: map[string]Slot{"NewName": {Name: "NewName", Value: tt.newName}}}
+			response, err := handleRenameDoor(context.Background(), "dev1", intent)
+			if err != nil {
+				t.Fatalf("handleRenameDoor: %v", err)
+			}
+
+			friendly, _ := storedFriendlyName("dev1")
+			if tt.taken {
+				if !strings.Contains(spoken(response), "already a door called") {
+					t.Errorf("response = %q, want the name refused", spoken(response))
+				}
+				if friendly != "" {
+					t.Errorf("friendly name = %q, want none saved", friendly)
+				}
+				return
+			}
+			if friendly != "the side door" {
+				t.Errorf("friendly name = %q, want the side door", friendly)
+			}
+		})
+	}
+}
+
+// TestAccessIgnoresFriendlyNames gives dev1 a friendly name matching dev2's
+// DEVICE_MAP name, as a rename could before names were checked. A user
+// allowed on workshop must still only reach dev2.
+func TestAccessIgnoresFriendlyNames(t *testing.T) {
+	useDevices(t, map[string]string{"dev1": "the workshop door"})
+	saved := userAccess
+	userAccess = map[string][]string{"worker": {"workshop"}}
+	defer func() { userAccess = saved }()
+
+	if userCanAccess("worker", "dev1") {
+		t.Error("friendly name gave access to dev1")
+	}
+	if !userCanAccess("worker", "dev2") {
+		t.Error("DEVICE_MAP name didn't give access to dev2")
+	}
+	if device, ok := findDevice("workshop"); !ok || device.ID != "dev2" {
+		t.Errorf("findDevice(workshop) = %+v, want dev2 by its DEVICE_MAP name", device)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Some openers only complete a cycle when the button is pressed a second
+// time shortly after the first. With DOUBLE_PULSE=true the skill presses,
+// waits DOUBLE_PULSE_GAP_MS, checks whether the door already moved, and
+// presses again only if it didn't, since a second press on a moving door
+// would stop it.
+
+var (
+	doublePulse    bool
+	doublePulseGap time.Duration
+)
+
+// doublePulseMargin is left before the invocation deadline after the gap,
+// for the status check, the second press and the response
+const doublePulseMargin = 3 * time.Second
+
+// secondPulseSpeech follows a successful first press: it waits out the gap,
+// presses again if the door hasn't moved from before, and describes the
+// two-step press
+func secondPulseSpeech(ctx context.Context, deviceID, before string) string {
+	name := spokenName(deviceID)
+	outOfTime := fmt.Sprintf("I pressed the button for %s once, but ran out of time for the second press. It may not have moved.", name)
+
+	// The relay must have released or the second press is refused as
+	// already active
+	gap := doublePulseGap
+	if hold := relayHold(ctx, deviceID) + 250*time.Millisecond; hold > gap {
+		gap = hold
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline)-doublePulseMargin < gap {
+		fmt.Printf("No time left for the second pulse on %s\n", deviceID)
+		return outOfTime
+	}
+
+	select {
+	case <-time.After(gap):
+	case <-ctx.Done():
+		return outOfTime
+	}
+
+	if reading, err := fetchDoorStatus(ctx, deviceID, StatusOptions{}); err != nil {
+		fmt.Printf("Error checking status between pulses (pressing again): %v\n", err)
+	} else if before != "" && reading.Status != before && reading.Status != "unknown" {
+		fmt.Printf("Door moved after the first pulse (%s -> %s) - skipping the second\n", before, reading.Status)
+		return fmt.Sprintf("I pressed the button for %s once and it started moving, so I didn't press it again.", name)
+	}
+
+	success, err := callParticleFunction(ctx, deviceID, "pressButton", "")
+	if err != nil || !success {
+		fmt.Printf("Second pulse failed for %s: success=%t err=%v\n", deviceID, success, err)
+		return fmt.Sprintf("I pressed the button for %s once, but the second press didn't go through. It may not have moved.", name)
+	}
+
+	// The press was recorded after the first pulse. Both pulses are one
+	// command, so recording it again would undo the assumed status flip.
+	noteSummary(ctx, func(s *RequestSummary) { s.Action = "pressed_twice" })
+	return fmt.Sprintf("I pressed the button for %s twice, %s apart, to run it through a full cycle.", name, spokenHold(gap))
+}
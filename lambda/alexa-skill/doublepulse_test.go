@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestDoublePulseAssumesOnce runs DOUBLE_PULSE with ASSUME_STATE_FROM_PRESSES
+// on a door without a sensor. Each command presses twice but is one trip of
+// the door, so the assumed status flips once per command.
+func TestDoublePulseAssumesOnce(t *testing.T) {
+	fixClock(t, time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC))
+	fakeDoorTable(t)
+	var presses int32
+	fakeParticle(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/pressButton"):
+			atomic.AddInt32(&presses, 1)
+			io.WriteString(w, `{"connected":true,"return_value":1}`)
+		case strings.HasSuffix(r.URL.Path, "/relayHoldMs"):
+			io.WriteString(w, `{"result":10}`)
+		default:
+			w.WriteHeader(http.StatusNotFound) // No sensor
+		}
+	})
+
+	pulse, gap, assume := doublePulse, doublePulseGap, assumeFromPresses
+	doublePulse, doublePulseGap, assumeFromPresses = true, time.Millisecond, true
+	defer func() { doublePulse, doublePulseGap, assumeFromPresses = pulse, gap, assume }()
+
+	for _, want := range []string{"open", "closed", "open"} {
+		response, err := handlePressButton(context.Background(), "dev1")
+		if err != nil || !strings.Contains(spoken(response), "twice") {
+			t.Fatalf("press = %q, %v; want both pulses", spoken(response), err)
+		}
+		state, err := getDoorState(context.Background(), "dev1")
+		if err != nil || state == nil {
+			t.Fatalf("getDoorState = %+v, %v", state, err)
+		}
+		if state.AssumedStatus != want {
+			t.Errorf("assumed status = %q, want %q", state.AssumedStatus, want)
+		}
+	}
+	if n := atomic.LoadInt32(&presses); n != 6 {
+		t.Errorf("presses = %d, want two per command", n)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import "fmt"
+
+// When Alexa can't match what was said to a command she sends
+// AMAZON.FallbackIntent. By default the skill answers "I don't understand
+// that command." and ends the session. FALLBACK_MESSAGE replaces the
+// message, and with FALLBACK_KEEP_OPEN=true the session stays open and the
+// user is offered the commands, so a misheard phrase can just be said again.
+
+const defaultFallbackMessage = "I don't understand that command."
+
+var (
+	fallbackMessage  = defaultFallbackMessage
+	fallbackKeepOpen bool
+)
+
+// handleFallback answers a request the skill has no handler for
+func handleFallback(intentName string) (AlexaResponse, error) {
+	fmt.Printf("No handler for %s - answering with the fallback response\n", intentName)
+	if !fallbackKeepOpen {
+		return buildResponse(fallbackMessage, true), nil
+	}
+
+	response := buildResponse(fallbackMessage+" "+helpSpeech, false)
+	response.Response.Reprompt = &Reprompt{
+		OutputSpeech: OutputSpeech{Type: "PlainText", Text: helpSpeech},
+	}
+	return response, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// openSession is one stretch of the door being open, from a pair of events
+type openSession struct {
+	Opened    time.Time
+	Closed    time.Time // When it closed, or now if StillOpen
+	StillOpen bool
+}
+
+// Duration is how long the session lasted, or has lasted so far
+func (s openSession) Duration() time.Duration {
+	return s.Closed.Sub(s.Opened)
+}
+
+// queryDoorEvents returns a device's events since a time, oldest first
+func queryDoorEvents(ctx context.Context, deviceID string, since time.Time) ([]DoorEvent, error) {
+	var events []DoorEvent
+	var unmarshalErr error
+
+	err := dynamoClient.QueryPagesWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(eventsTable),
+		KeyConditionExpression: aws.String("deviceId = :id AND #ts >= :since"),
+		ExpressionAttributeNames: map[string]*string{
+			"#ts": aws.String("timestamp"), // A reserved word
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":id":    {S: aws.String(deviceID)},
+			":since": {N: aws.String(fmt.Sprint(since.Unix()))},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		var pageEvents []DoorEvent
+		if err := dynamodbattribute.UnmarshalListOfMaps(page.Items, &pageEvents); err != nil {
+			unmarshalErr = err
+			return false
+		}
+		events = append(events, pageEvents...)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error querying events from DynamoDB: %w", err)
+	}
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("error unmarshaling events: %w", unmarshalErr)
+	}
+	return events, nil
+}
+
+// pairOpenSessions pairs each open event with the close that follows it.
+// A close with no open before it in the window started before the window,
+// so its length isn't known and it is skipped. Repeated opens keep the
+// first, and an open with no close yet is still open as of now.
+func pairOpenSessions(events []DoorEvent, current time.Time) []openSession {
+	var sessions []openSession
+	var opened time.Time
+	for _, event := range events {
+		switch event.Status {
+		case "open":
+			if opened.IsZero() {
+				opened = time.Unix(event.Timestamp, 0)
+			}
+		case "closed":
+			if !opened.IsZero() {
+				sessions = append(sessions, openSession{Opened: opened, Closed: time.Unix(event.Timestamp, 0)})
+				opened = time.Time{}
+			}
+		}
+	}
+	if !opened.IsZero() {
+		sessions = append(sessions, openSession{Opened: opened, Closed: current, StillOpen: true})
+	}
+	return sessions
+}
+
+// handleGetLongestOpen reports the longest the door was open in the last
+// LONGEST_OPEN_LOOKBACK_DAYS, from the events table
+func handleGetLongestOpen(ctx context.Context, deviceID string) (AlexaResponse, error) {
+	name := spokenName(deviceID)
+	if eventsTable == "" {
+		return buildResponse("I don't keep a history of the door, so I can't tell.", true), nil
+	}
+
+	current := now()
+	since := current.AddDate(0, 0, -longestOpenDays)
+	events, err := queryDoorEvents(ctx, deviceID, since)
+	if err != nil {
+		fmt.Printf("Error getting door events: %v\n", err)
+		return buildErrorResponse("Sorry, I couldn't look up the door's history. Please try again."), nil
+	}
+
+	sessions := pairOpenSessions(events, current)
+
+	// A door left open since before the lookback has no open event in it
+	if len(events) == 0 {
+		if state, err := getDoorState(ctx, deviceID); err != nil {
+			fmt.Printf("Error getting door state: %v\n", err)
+		} else if state != nil && state.Status == "open" && state.LastOpenedTime > 0 && state.LastOpenedTime < since.Unix() {
+			sessions = append(sessions, openSession{Opened: time.Unix(state.LastOpenedTime, 0), Closed: current, StillOpen: true})
+		}
+	}
+	if len(sessions) == 0 {
+		speech := fmt.Sprintf("I don't have a record of %s being opened in the last %d days.", name, longestOpenDays)
+		return buildResponse(speech, true), nil
+	}
+
+	longest := sessions[0]
+	for _, session := range sessions[1:] {
+		if session.Duration() > longest.Duration() {
+			longest = session
+		}
+	}
+
+	duration := humanizeDuration(int64(longest.Duration().Minutes()))
+	if longest.StillOpen {
+		speech := fmt.Sprintf("It's right now: %s has been open for %s, the longest in the last %d days.", name, duration, longestOpenDays)
+		return buildResponse(speech, true), nil
+	}
+	speech := fmt.Sprintf("The longest %s stayed open recently was %s, %s.", name, duration, spokenDayPart(longest.Opened, current))
+	return buildResponse(speech, true), nil
+}
+
+// spokenDayPart describes roughly when something happened, e.g. "this
+// morning", "yesterday evening" or "last Tuesday afternoon". The small hours
+// belong to the night before, so 2 AM today is "last night".
+func spokenDayPart(t, current time.Time) string {
+	local := t.In(localTimezone)
+	today := current.In(localTimezone)
+
+	// day is the date the part of the day started on
+	day := local
+	var part string
+	switch hour := local.Hour(); {
+	case hour < 5:
+		part = "night"
+		day = local.AddDate(0, 0, -1)
+	case hour < 12:
+		part = "morning"
+	case hour < 17:
+		part = "afternoon"
+	case hour < 21:
+		part = "evening"
+	default:
+		part = "night"
+	}
+
+	startOfDay := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, localTimezone)
+	}
+	days := int(startOfDay(today).Sub(startOfDay(day)).Hours()+12) / 24
+
+	switch {
+	case days == 0 && part == "night":
+		return "tonight"
+	case days == 0:
+		return "this " + part
+	case days == 1 && part == "night":
+		return "last night"
+	case days == 1:
+		return "yesterday " + part
+	case days == 2 && part == "night":
+		return "the night before last"
+	case days < 7:
+		return fmt.Sprintf("last %s %s", day.Weekday(), part)
+	default:
+		return fmt.Sprintf("on %s", local.Format("January 2"))
+	}
+}
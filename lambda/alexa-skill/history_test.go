@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpokenDayPart(t *testing.T) {
+	saved := localTimezone
+	localTimezone = time.UTC
+	defer func() { localTimezone = saved }()
+
+	// A Friday
+	current := time.Date(2026, 10, 16, 23, 30, 0, 0, time.UTC)
+	at := func(day, hour int) time.Time { return time.Date(2026, 10, day, hour, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		when time.Time
+		want string
+	}{
+		{at(16, 22), "tonight"},
+		{at(16, 2), "last night"},
+		{at(15, 22), "last night"},
+		{at(15, 2), "the night before last"},
+		{at(14, 22), "the night before last"},
+		{at(16, 9), "this morning"},
+		{at(15, 14), "yesterday afternoon"},
+		{at(13, 19), "last Tuesday evening"},
+		{at(13, 3), "last Monday night"},
+		{at(1, 9), "on October 1"},
+	}
+
+	for _, tt := range tests {
+		if got := spokenDayPart(tt.when, current); got != tt.want {
+			t.Errorf("spokenDayPart(%s) = %q, want %q", tt.when.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// fakeDoorState points the DynamoDB client at a test server for the length
+// of the test. GetItem returns item, in DynamoDB's JSON form; every write
+// succeeds and is ignored.
+func fakeDoorState(t *testing.T, item string) {
+	t.Helper()
+	fakeDynamo(t, func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		if strings.HasSuffix(r.Header.Get("X-Amz-Target"), ".GetItem") {
+			fmt.Fprintf(w, `{"Item":%s}`, item)
+			return
+		}
+		io.WriteString(w, `{}`)
+	})
+}
+
+// fakeDynamo points the DynamoDB client at a test server running handler for
+// the length of the test
+func fakeDynamo(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+
+	client, table := dynamoClient, doorStateTable
+	dynamoClient = dynamodb.New(session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("test", "test", ""),
+		MaxRetries:  aws.Int(0),
+	})))
+	doorStateTable = "door-state"
+	t.Cleanup(func() {
+		server.Close()
+		dynamoClient, doorStateTable = client, table
+	})
+}
+
+// fixClock stops the clock at t for the length of the test
+func fixClock(t *testing.T, at time.Time) {
+	t.Helper()
+	saved := now
+	now = func() time.Time { return at }
+	t.Cleanup(func() { now = saved })
+}
+
+// localeRequest is an intent request in a locale from a device with a screen
+func localeRequest(intent, locale string) AlexaRequest {
+	var request AlexaRequest
+	request.Session.User.UserID = "owner"
+	request.Request.Type = "IntentRequest"
+	request.Request.Locale = locale
+	request.Request.Intent = Intent{Name: intent}
+	request.Context.System.Device.SupportedInterfaces = map[string]json.RawMessage{aplInterface: json.RawMessage(`{}`)}
+	return request
+}
+
+// TestStatusLocaleMatrix asks for the status of a door open 90 minutes in
+// each locale and checks that the speech, reprompt, card and screen all use
+// that locale's wording, in German as well as English
+func TestStatusLocaleMatrix(t *testing.T) {
+	current := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	fixClock(t, current)
+	fakeParticle(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/"+statusVariable) {
+			io.WriteString(w, `{"result":"open"}`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound) // No obstruction sensor
+	})
+	fakeDoorState(t, fmt.Sprintf(`{"deviceId":{"S":"dev1"},"status":{"S":"open"},"lastChecked":{"N":"%d"},"lastOpenedTime":{"N":"%d"}}`,
+		current.Unix(), current.Add(-90*time.Minute).Unix()))
+
+	savedDevice, savedVerbosity := particleDeviceID, responseVerbosity
+	particleDeviceID, responseVerbosity = "dev1", verbosityNormal
+	defer func() { particleDeviceID, responseVerbosity = savedDevice, savedVerbosity }()
+
+	// The status sentence, card title and screen label and detail
+	type wording struct{ status, title, label, detail string }
+	english := wording{
+		"The garage door is open right now.", "Garage Door Status", `"label":"OPEN"`, `"detail":"Open for 1 hour and 30 minutes"`,
+	}
+	german := wording{
+		"Das Garagentor ist gerade offen.", "Garagentor-Status", `"label":"OFFEN"`, `"detail":"Seit einer Stunde und 30 Minuten offen"`,
+	}
+	tests := []struct {
+		locale  string
+		openFor string // The locale's sentence, in speech and on the card
+		want    wording
+	}{
+		{"en-US", "It has been open for 1 hour and 30 minutes.", english},
+		{"en-GB", "It's been open for 1 hour and 30 minutes.", english},
+		{"en-IN", "It has been open for 1 hour and 30 minutes.", english}, // Nearest English wording
+		{"de-DE", "Es ist seit einer Stunde und 30 Minuten offen.", german},
+		{"de-AT", "Es ist seit einer Stunde und 30 Minuten offen.", german}, // Nearest German wording
+		{"fr-FR", "It has been open for 1 hour and 30 minutes.", english},   // Falls back to en-US
+		{"", "It has been open for 1 hour and 30 minutes.", english},
+	}
+
+	for _, tt := range tests {
+		t.Run("locale "+tt.locale, func(t *testing.T) {
+			response, err := HandleRequest(context.Background(), localeRequest("GetStatusIntent", tt.locale))
+			if err != nil {
+				t.Fatalf("HandleRequest: %v", err)
+			}
+			body := response.Response
+
+			speech := body.OutputSpeech
+			if speech == nil || speech.Type != "SSML" {
+				t.Fatalf("speech = %+v, want SSML", speech)
+			}
+			spokenText := strings.NewReplacer(`<say-as interpret-as="cardinal">`, "", "</say-as>", "").Replace(speech.SSML)
+			if !strings.Contains(spokenText, tt.want.status) || !strings.Contains(spokenText, tt.openFor) {
+				t.Errorf("speech = %s, want %q and %q", speech.SSML, tt.want.status, tt.openFor)
+			}
+
+			// A status answer ends the session, so there is nothing to re-ask
+			if body.Reprompt != nil {
+				t.Errorf("reprompt = %+v, want none", body.Reprompt)
+			}
+
+			if body.Card == nil || body.Card.Title != tt.want.title || !strings.Contains(body.Card.Content, tt.want.status) || !strings.Contains(body.Card.Content, tt.openFor) {
+				t.Errorf("card = %+v, want %q, %q and %q", body.Card, tt.want.title, tt.want.status, tt.openFor)
+			}
+
+			if len(body.Directives) != 1 {
+				t.Fatalf("directives = %d, want the status screen", len(body.Directives))
+			}
+			screen, err := json.Marshal(body.Directives[0].Datasources)
+			if err != nil {
+				t.Fatalf("marshaling datasources: %v", err)
+			}
+			if !strings.Contains(string(screen), tt.want.label) || !strings.Contains(string(screen), tt.want.detail) {
+				t.Errorf("screen = %s, want %s and %s", screen, tt.want.label, tt.want.detail)
+			}
+		})
+	}
+}
+
+// TestFallbackLocaleMatrix checks the reprompt, the one part a status
+// answer doesn't have, through the kept-open fallback response
+func TestFallbackLocaleMatrix(t *testing.T) {
+	fallbackKeepOpen = true
+	defer func() { fallbackKeepOpen = false }()
+
+	for _, locale := range []string{"en-US", "en-GB", "en-IN", "de-DE", "fr-FR"} {
+		t.Run("locale "+locale, func(t *testing.T) {
+			response, err := HandleRequest(context.Background(), localeRequest("AMAZON.FallbackIntent", locale))
+			if err != nil {
+				t.Fatalf("HandleRequest: %v", err)
+			}
+			body := response.Response
+			if body.ShouldEndSession || body.Reprompt == nil || body.Reprompt.OutputSpeech.Text != helpSpeech {
+				t.Fatalf("response = %+v, want the session kept open with the commands as a reprompt", body)
+			}
+			if !strings.HasPrefix(body.OutputSpeech.Text, fallbackMessage) {
+				t.Errorf("speech = %q, want the fallback message first", body.OutputSpeech.Text)
+			}
+			if body.Card != nil || len(body.Directives) > 0 {
+				t.Errorf("fallback has a card or directives: %+v", body)
+			}
+		})
+	}
+}
+
+// TestGermanStatusWithoutSensor checks the de-DE wording of the answers that
+// don't come straight from the sensor, for a door named in DEVICE_MAP
+func TestGermanStatusWithoutSensor(t *testing.T) {
+	current := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	fixClock(t, current)
+	useDevices(t, nil)
+
+	savedAssume, savedMaxAge, savedMsg := assumeFromPresses, storedStatusMaxAge, unknownStatusMsg
+	assumeFromPresses, storedStatusMaxAge, unknownStatusMsg = true, 60, defaultUnknownStatusMsg
+	defer func() { assumeFromPresses, storedStatusMaxAge, unknownStatusMsg = savedAssume, savedMaxAge, savedMsg }()
+
+	tests := []struct {
+		name   string
+		result int    // Particle's HTTP status for the status variable
+		item   string // The stored door state
+		want   string
+	}{
+		{
+			name:   "stored reading",
+			result: http.StatusInternalServerError,
+			item:   fmt.Sprintf(`{"deviceId":{"S":"dev2"},"status":{"S":"closed"},"lastChecked":{"N":"%d"}}`, current.Add(-20*time.Minute).Unix()),
+			want:   "Ich kann die Steuerung gerade nicht erreichen. Das Tor workshop war vor 20 Minuten noch geschlossen.",
+		},
+		{
+			name:   "assumed from a press",
+			result: http.StatusInternalServerError,
+			item:   fmt.Sprintf(`{"deviceId":{"S":"dev2"},"assumedStatus":{"S":"open"},"lastButtonPress":{"N":"%d"}}`, current.Add(-time.Minute).Unix()),
+			want:   "Ich nehme an, das Tor workshop ist offen, nach dem letzten Tastendruck vor einer Minute. Ohne Sensor kann ich das nicht sicher sagen, sieh also nach, wenn es wichtig ist.",
+		},
+		{
+			name:   "no reading",
+			result: http.StatusOK,
+			item:   `{"deviceId":{"S":"dev2"}}`,
+			want:   "Ich konnte den Türsensor nicht lesen. Die Steuerung ist vielleicht offline, oder der Sensor ist nicht angeschlossen.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeParticle(t, func(w http.ResponseWriter, r *http.Request) {
+				if !strings.HasSuffix(r.URL.Path, "/"+statusVariable) {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.WriteHeader(tt.result)
+				io.WriteString(w, `{"result":"unknown"}`)
+			})
+			fakeDoorState(t, tt.item)
+
+			response, err := handleGetStatus(context.Background(), "dev2", true, false, "de-DE")
+			if err != nil {
+				t.Fatalf("handleGetStatus: %v", err)
+			}
+			if got := spoken(response); got != tt.want {
+				t.Errorf("speech = %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,50 +3,154 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"os"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	lambdasvc "github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/sns"
 )
 
+// particleAPIBase is the Particle cloud API root. PARTICLE_API_BASE overrides
+// it, e.g. to point at a mock server or proxy.
+var particleAPIBase = "https://api.particle.io/v1"
+
 // Particle API configuration
 const (
-	particleAPIBase = "https://api.particle.io/v1"
+	// A handshake this recent suggests the controller just reconnected
+	recentReconnectWindow = 15 * time.Minute
 )
 
+// defaultUnknownStatusMsg is said when the sensor gives no reading and
+// UNKNOWN_STATUS_MESSAGE isn't set
+const defaultUnknownStatusMsg = "I couldn't read the door sensor. The garage controller may be offline, or the sensor may be disconnected."
+
+// httpClient is shared by all Particle calls so warm invocations reuse its
+// pooled connections and TLS sessions
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
 // Environment variables
 var (
 	particleAccessToken string
 	particleDeviceID    string
 	doorStateTable      string
+	eventsTable         string
+	eventRetryQueueSize int
+	notifyDedupWindow   int64
+	unknownStatusMsg    string
+	statusVariable      string
+	openPositionMin     int
+	thresholdMinutes    int
+	snoozeMinutes       int64
+	snoozeMorningHour   int
+	minSpeakDuration    int64 // MIN_SPEAK_DURATION_MINS
+	longestOpenDays     int
+	maxDeviceCalls      int // MAX_CONCURRENT_DEVICE_CALLS
+	autoCloseMinutes    int64
+	autoCloseWarnMins   int64 // AUTO_CLOSE_WARN_MINUTES
+	confirmPress        bool
+	localTimezone       *time.Location
+	logVerbose          bool
+	alexaSkillID        string
+	closeLinkSecret     string
+	alertsConfigured    bool
+	verifyAfterPress    bool
+	includeRefInErrors  bool
+	verifyDelay         time.Duration
+	logRedact           bool
+	statusCache         *keyedCache[string, string]
+	statusCacheTTL      time.Duration
+	storedStatusMaxAge  int64
 	dynamoClient        *dynamodb.DynamoDB
 )
 
+// alexaIdentifierPattern matches Alexa user, session, device and request IDs
+var alexaIdentifierPattern = regexp.MustCompile(`amzn1\.[a-z-]+\.[a-z-]+\.[A-Za-z0-9._-]+`)
+
+// accessTokenPattern matches bearer tokens Alexa embeds in the request context
+var accessTokenPattern = regexp.MustCompile(`"(apiAccessToken|accessToken)"\s*:\s*"[^"]*"`)
+
 // DoorState represents the state stored in DynamoDB
 type DoorState struct {
-	DeviceID         string `json:"deviceId"`
-	Status           string `json:"status"`
-	LastChecked      int64  `json:"lastChecked"`
-	LastOpenedTime   int64  `json:"lastOpenedTime,omitempty"`
-	LastClosedTime   int64  `json:"lastClosedTime,omitempty"`
-	LastButtonPress  int64  `json:"lastButtonPress,omitempty"`
-	NotificationSent bool   `json:"notificationSent"`
+	DeviceID           string `json:"deviceId"`
+	Status             string `json:"status"`
+	LastChecked        int64  `json:"lastChecked"`
+	LastOpenedTime     int64  `json:"lastOpenedTime,omitempty"`
+	LastClosedTime     int64  `json:"lastClosedTime,omitempty"`
+	LastButtonPress    int64  `json:"lastButtonPress,omitempty"`
+	NotificationSent   bool   `json:"notificationSent"`
+	DurationOpenMins   int64  `json:"durationOpenMins"`
+	EventLogGapSince   int64  `json:"eventLogGapSince,omitempty"`
+	UnknownSince       int64  `json:"unknownSince,omitempty"`
+	SensorAlertSent    bool   `json:"sensorAlertSent,omitempty"`
+	LastNotifiedKey    string `json:"lastNotifiedKey,omitempty"`
+	SnoozeUntil        int64  `json:"snoozeUntil,omitempty"`
+	SuppressAlertUntil int64  `json:"suppressAlertUntil,omitempty"`
+
+	// Added in schema version 1; see applyStateDefaults
+	SchemaVersion      int  `json:"schemaVersion,omitempty"`
+	AlertThresholdMins int  `json:"alertThresholdMins,omitempty"`
+	MaintenanceMode    bool `json:"maintenanceMode,omitempty"`
+
+	CloseLinkNonce string `json:"closeLinkNonce,omitempty"`
+
+	RecipientsNotified map[string]bool `json:"recipientsNotified,omitempty"`
+
+	AutoCloseAttempts        int   `json:"autoCloseAttempts,omitempty"`
+	LastAutoCloseAttempt     int64 `json:"lastAutoCloseAttempt,omitempty"`
+	ManualInterventionNeeded bool  `json:"manualInterventionNeeded,omitempty"`
+
+	RelayAlreadyActiveCount int64 `json:"relayAlreadyActiveCount,omitempty"`
+
+	FriendlyName string `json:"friendlyName,omitempty"`
+
+	ObstructionAlertSent bool `json:"obstructionAlertSent,omitempty"`
+
+	AutoCloseDeferredSince int64 `json:"autoCloseDeferredSince,omitempty"`
+
+	AwayAlertSent bool `json:"awayAlertSent,omitempty"`
+
+	AllClearPending bool `json:"allClearPending,omitempty"` // Sent by the monitor
+
+	PushedAt int64 `json:"pushedAt,omitempty"` // Last status pushed by the Particle webhook
+
+	OpenAnnounced bool `json:"openAnnounced,omitempty"` // Sent by the monitor
+
+	AssumedStatus string `json:"assumedStatus,omitempty"` // Guessed from presses; see ASSUME_STATE_FROM_PRESSES
+
+	// Sent by the monitor
+	PendingStatus string `json:"pendingStatus,omitempty"`
+	PendingSince  int64  `json:"pendingSince,omitempty"`
+	PendingRuns   int    `json:"pendingRuns,omitempty"`
+	AlertSeverity string `json:"alertSeverity,omitempty"`
 }
 
 // Alexa Request structures
 type AlexaRequest struct {
-	Version string      `json:"version"`
-	Session Session     `json:"session"`
-	Request Request     `json:"request"`
-	Context interface{} `json:"context"`
+	Version string       `json:"version"`
+	Session Session      `json:"session"`
+	Request Request      `json:"request"`
+	Context AlexaContext `json:"context"`
 }
 
 type Session struct {
@@ -56,7 +160,8 @@ type Session struct {
 		ApplicationID string `json:"applicationId"`
 	} `json:"application"`
 	User struct {
-		UserID string `json:"userId"`
+		UserID      string `json:"userId"`
+		AccessToken string `json:"accessToken,omitempty"` // Present once the account is linked
 	} `json:"user"`
 }
 
@@ -69,8 +174,9 @@ type Request struct {
 }
 
 type Intent struct {
-	Name  string                 `json:"name"`
-	Slots map[string]interface{} `json:"slots,omitempty"`
+	Name               string          `json:"name"`
+	ConfirmationStatus string          `json:"confirmationStatus,omitempty"` // NONE, CONFIRMED or DENIED
+	Slots              map[string]Slot `json:"slots,omitempty"`
 }
 
 // Alexa Response structures
@@ -78,174 +184,1356 @@ type AlexaResponse struct {
 	Version  string            `json:"version"`
 	Response ResponseBody      `json:"response"`
 	Session  map[string]string `json:"sessionAttributes,omitempty"`
+
+	// failed marks responses to errors; see buildErrorResponse
+	failed bool
+
+	// live marks status responses built from a live sensor reading, the
+	// only ones cachedResponse keeps
+	live bool
 }
 
 type ResponseBody struct {
-	OutputSpeech     OutputSpeech `json:"outputSpeech"`
-	Card             *Card        `json:"card,omitempty"`
-	ShouldEndSession bool         `json:"shouldEndSession"`
+	OutputSpeech     *OutputSpeech `json:"outputSpeech,omitempty"` // Unset for responses that don't speak
+	Card             *Card         `json:"card,omitempty"`
+	Reprompt         *Reprompt     `json:"reprompt,omitempty"`
+	Directives       []Directive   `json:"directives,omitempty"`
+	ShouldEndSession bool          `json:"shouldEndSession"`
 }
 
 type OutputSpeech struct {
 	Type string `json:"type"`
-	Text string `json:"text"`
+	Text string `json:"text,omitempty"` // PlainText
+	SSML string `json:"ssml,omitempty"` // SSML; see ssml.go
 }
 
 type Card struct {
-	Type    string `json:"type"`
-	Title   string `json:"title"`
-	Content string `json:"content"`
+	Type        string     `json:"type"`
+	Title       string     `json:"title,omitempty"`
+	Content     string     `json:"content,omitempty"`     // Simple cards
+	Text        string     `json:"text,omitempty"`        // Standard cards
+	Image       *CardImage `json:"image,omitempty"`       // Standard cards
+	Permissions []string   `json:"permissions,omitempty"` // AskForPermissionsConsent cards
 }
 
+type Reprompt struct {
+	OutputSpeech OutputSpeech `json:"outputSpeech"`
+}
+
+// Directive is a response directive, e.g. Dialog.ElicitSlot
+type Directive struct {
+	Type          string  `json:"type"`
+	SlotToElicit  string  `json:"slotToElicit,omitempty"`
+	UpdatedIntent *Intent `json:"updatedIntent,omitempty"`
+
+	// APL RenderDocument fields
+	Token       string      `json:"token,omitempty"`
+	Document    interface{} `json:"document,omitempty"`
+	Datasources interface{} `json:"datasources,omitempty"`
+}
+
+// errDeviceNotResponding means Particle answered but the device didn't, which
+// Particle reports as a 200 with an error field, e.g. {"error":"Timed out."}
+var errDeviceNotResponding = errors.New("device did not respond")
+
 // Particle API structures
 type ParticleFunctionRequest struct {
 	Arg string `json:"arg"`
 }
 
-type ParticleFunctionResponse struct {
-	ID            string `json:"id"`
-	Name          string `json:"name"`
-	LastApp       string `json:"last_app"`
-	Connected     bool   `json:"connected"`
-	ReturnValue   int    `json:"return_value"`
-	ExecutionTime int    `json:"execution_time"`
+type ParticleFunctionResponse struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	LastApp       string `json:"last_app"`
+	Connected     bool   `json:"connected"`
+	ReturnValue   int    `json:"return_value"`
+	ExecutionTime int    `json:"execution_time"`
+	Error         string `json:"error,omitempty"`
+}
+
+// ParticleDeviceInfo is the subset of the device info endpoint we use
+type ParticleDeviceInfo struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	Connected       bool      `json:"connected"`
+	LastHeard       time.Time `json:"last_heard"`
+	LastHandshakeAt time.Time `json:"last_handshake_at"`
+}
+
+func init() {
+	if raw := os.Getenv("PARTICLE_API_BASE"); raw != "" {
+		if base, err := parseAPIBase(raw); err != nil {
+			fmt.Printf("WARNING: %v - using %s\n", err, particleAPIBase)
+		} else {
+			particleAPIBase = base
+			fmt.Printf("Particle API base: %s\n", particleAPIBase)
+		}
+	}
+	particleAccessToken = os.Getenv("PARTICLE_ACCESS_TOKEN")
+	if err := configureProxy(os.Getenv("PARTICLE_PROXY_URL")); err != nil {
+		fmt.Printf("WARNING: %v\n", err)
+	}
+	httpClient.Transport = breakerTransport{base: timedTransport{base: httpClient.Transport}, breaker: particleBreaker}
+	particleBreaker.threshold = 5
+	if n, err := strconv.Atoi(os.Getenv("PARTICLE_BREAKER_THRESHOLD")); err == nil && n >= 0 {
+		particleBreaker.threshold = n
+	}
+	particleBreaker.cooldown = 30 * time.Second
+	if secs, err := strconv.Atoi(os.Getenv("PARTICLE_BREAKER_COOLDOWN_SECONDS")); err == nil && secs > 0 {
+		particleBreaker.cooldown = time.Duration(secs) * time.Second
+	}
+	particleDeviceID = normalizeDeviceID(os.Getenv("PARTICLE_DEVICE_ID"), os.Getenv("PARTICLE_RESOLVE_DEVICE_NAME") == "true")
+	doorStateTable = os.Getenv("DOOR_STATE_TABLE")
+	if name := os.Getenv("STATE_KEY_NAME"); name != "" {
+		stateKeyName = name
+	}
+	eventsTable = os.Getenv("EVENTS_TABLE")
+	eventRetryQueueSize, _ = strconv.Atoi(os.Getenv("EVENT_RETRY_QUEUE_SIZE"))
+	retryBudgetTotal = 2 * time.Second
+	if ms, err := strconv.Atoi(os.Getenv("RETRY_BUDGET_MS")); err == nil && ms >= 0 {
+		retryBudgetTotal = time.Duration(ms) * time.Millisecond
+	}
+	dynamoMaxRetries = client.DefaultRetryerMaxNumRetries
+	if n, err := strconv.Atoi(os.Getenv("DYNAMODB_MAX_RETRIES")); err == nil && n >= 0 {
+		dynamoMaxRetries = n
+	}
+	dynamoMaxThrottleDelay = time.Second
+	if ms, err := strconv.Atoi(os.Getenv("DYNAMODB_MAX_THROTTLE_DELAY_MS")); err == nil && ms > 0 {
+		dynamoMaxThrottleDelay = time.Duration(ms) * time.Millisecond
+	}
+
+	notifyDedupWindow = 300
+	if secs, err := strconv.ParseInt(os.Getenv("NOTIFY_DEDUP_WINDOW_SECONDS"), 10, 64); err == nil && secs >= 0 {
+		notifyDedupWindow = secs
+	}
+
+	if particleAccessToken == "" {
+		fmt.Println("WARNING: PARTICLE_ACCESS_TOKEN not set")
+	}
+	var err error
+	devices, err = loadDeviceMap(os.Getenv("DEVICE_MAP"))
+	if err != nil {
+		fmt.Printf("WARNING: ignoring DEVICE_MAP: %v\n", err)
+	}
+	userAccess, err = loadUserAccess(os.Getenv("ALLOWED_USERS"))
+	if err != nil {
+		// Fail closed rather than open up every door
+		fmt.Printf("WARNING: denying all users: %v\n", err)
+		userAccess = map[string][]string{}
+	}
+	requireAccountLink = os.Getenv("REQUIRE_ACCOUNT_LINKING") == "true"
+
+	stuckRelayThreshold = 3
+	if count, err := strconv.ParseInt(os.Getenv("STUCK_RELAY_THRESHOLD"), 10, 64); err == nil && count >= 0 {
+		stuckRelayThreshold = count
+	}
+	stuckRelayTopicARN = os.Getenv("STUCK_RELAY_TOPIC_ARN")
+	relayActiveGrace = 5 * time.Second
+	if secs, err := strconv.Atoi(os.Getenv("RELAY_ACTIVE_GRACE_SECONDS")); err == nil && secs >= 0 {
+		relayActiveGrace = time.Duration(secs) * time.Second
+	}
+	relayActiveMessage = os.Getenv("RELAY_ACTIVE_MESSAGE")
+	if relayActiveMessage == "" {
+		relayActiveMessage = "I just activated {name}. Give it a moment."
+	}
+	if particleDeviceID == "" && len(devices) == 0 {
+		fmt.Println("WARNING: PARTICLE_DEVICE_ID not set")
+	}
+	if doorStateTable == "" {
+		fmt.Println("WARNING: DOOR_STATE_TABLE not set")
+	}
+
+	openImageURL = os.Getenv("STATUS_OPEN_IMAGE_URL")
+	closedImageURL = os.Getenv("STATUS_CLOSED_IMAGE_URL")
+	configureCardStyle()
+
+	obstructionVariable = "obstructed"
+	if name, ok := os.LookupEnv("OBSTRUCTION_VAR"); ok {
+		obstructionVariable = name
+	}
+
+	statusVariable = os.Getenv("PARTICLE_STATUS_VAR")
+	if statusVariable == "" {
+		statusVariable = "doorStatus"
+	}
+	openPositionMin, _ = strconv.Atoi(os.Getenv("OPEN_POSITION_THRESHOLD"))
+	if statusMap, err = loadStatusMap(os.Getenv("STATUS_MAP")); err != nil {
+		fmt.Printf("WARNING: ignoring STATUS_MAP: %v\n", err)
+	}
+
+	thresholdMinutes = 120 // Default 2 hours, matching the monitor
+	if mins, err := strconv.Atoi(os.Getenv("THRESHOLD_MINUTES")); err == nil {
+		thresholdMinutes = mins
+	}
+
+	snoozeMinutes = 60
+	snoozeMorningHour = 7
+	if hour, err := strconv.Atoi(os.Getenv("SNOOZE_MORNING_HOUR")); err == nil && hour >= 0 && hour < 24 {
+		snoozeMorningHour = hour
+	}
+	if raw := os.Getenv("RESPONSE_VERBOSITY"); raw != "" {
+		level, err := parseVerbosity(raw)
+		if err != nil {
+			fmt.Printf("WARNING: %v - using normal\n", err)
+		}
+		responseVerbosity = level
+	}
+	minSpeakDuration = 1
+	if mins, err := strconv.ParseInt(os.Getenv("MIN_SPEAK_DURATION_MINS"), 10, 64); err == nil && mins > 0 {
+		minSpeakDuration = mins
+	}
+
+	maxDeviceCalls = 3
+	if n, err := strconv.Atoi(os.Getenv("MAX_CONCURRENT_DEVICE_CALLS")); err == nil && n > 0 {
+		maxDeviceCalls = n
+	}
+	longestOpenDays = 7
+	if days, err := strconv.Atoi(os.Getenv("LONGEST_OPEN_LOOKBACK_DAYS")); err == nil && days > 0 {
+		longestOpenDays = days
+	}
+	if mins, err := strconv.ParseInt(os.Getenv("SNOOZE_MINUTES"), 10, 64); err == nil && mins > 0 {
+		snoozeMinutes = mins
+	}
+
+	autoCloseMinutes, _ = strconv.ParseInt(os.Getenv("AUTO_CLOSE_MINUTES"), 10, 64)
+	autoCloseWarnMins = 5
+	if mins, err := strconv.ParseInt(os.Getenv("AUTO_CLOSE_WARN_MINUTES"), 10, 64); err == nil && mins >= 0 {
+		autoCloseWarnMins = mins
+	}
+
+	storedStatusMaxAge = 60
+	if mins, err := strconv.ParseInt(os.Getenv("STORED_STATUS_MAX_AGE_MINUTES"), 10, 64); err == nil && mins >= 0 {
+		storedStatusMaxAge = mins
+	}
+
+	verifyAfterPress = os.Getenv("VERIFY_AFTER_PRESS") == "true"
+	detectSuccessByStatus = os.Getenv("DETECT_SUCCESS_BY_STATUS") == "true"
+	if msg := strings.TrimSpace(os.Getenv("FALLBACK_MESSAGE")); msg != "" {
+		fallbackMessage = msg
+	}
+	fallbackKeepOpen = os.Getenv("FALLBACK_KEEP_OPEN") == "true"
+	assumeFromPresses = os.Getenv("ASSUME_STATE_FROM_PRESSES") == "true"
+	confirmPress = os.Getenv("CONFIRM_PRESS") == "true"
+	defaultToLastDoor = os.Getenv("DEFAULT_TO_LAST_DOOR") == "true"
+	doublePulse = os.Getenv("DOUBLE_PULSE") == "true"
+	doublePulseGap = 1500 * time.Millisecond
+	if ms, err := strconv.Atoi(os.Getenv("DOUBLE_PULSE_GAP_MS")); err == nil && ms > 0 {
+		doublePulseGap = time.Duration(ms) * time.Millisecond
+	}
+	verifyDelay = 4 * time.Second
+	if secs, err := strconv.Atoi(os.Getenv("VERIFY_DELAY_SECONDS")); err == nil && secs >= 0 {
+		verifyDelay = time.Duration(secs) * time.Second
+	}
+
+	unknownStatusMsg = os.Getenv("UNKNOWN_STATUS_MESSAGE")
+	if unknownStatusMsg == "" {
+		unknownStatusMsg = defaultUnknownStatusMsg
+	}
+
+	logVerbose = os.Getenv("LOG_VERBOSE") == "true"
+	alexaSkillID = os.Getenv("ALEXA_SKILL_ID")
+	closeLinkSecret = os.Getenv("CLOSE_LINK_SECRET")
+	webhookSecret = os.Getenv("PARTICLE_WEBHOOK_SECRET")
+	pushedStatusMaxAge = 15 * time.Minute
+	if mins, err := strconv.Atoi(os.Getenv("PUSHED_STATUS_MAX_AGE_MINUTES")); err == nil && mins >= 0 {
+		pushedStatusMaxAge = time.Duration(mins) * time.Minute
+	}
+	monitorFunction = os.Getenv("MONITOR_FUNCTION_NAME")
+	// Only used to report whether the monitor has somewhere to send alerts
+	alertsConfigured = os.Getenv("NOTIFICATION_TOPIC_ARN") != "" || os.Getenv("NOTIFICATION_RECIPIENTS") != ""
+	logRedact = os.Getenv("LOG_REDACT") == "true"
+	includeRefInErrors = os.Getenv("INCLUDE_REF_IN_ERRORS") == "true"
+
+	// Status caching is off unless STATUS_CACHE_SECONDS is set
+	if secs, err := strconv.Atoi(os.Getenv("STATUS_CACHE_SECONDS")); err == nil && secs > 0 {
+		statusCacheTTL = time.Duration(secs) * time.Second
+		statusCache = newKeyedCache[string, string](statusCacheTTL)
+		fmt.Printf("Door status cache enabled: %d seconds\n", secs)
+	}
+
+	// Likewise the formatted response cache and RESPONSE_CACHE_SECONDS
+	if secs, err := strconv.Atoi(os.Getenv("RESPONSE_CACHE_SECONDS")); err == nil && secs > 0 {
+		responseCache = newKeyedCache[responseCacheKey, AlexaResponse](time.Duration(secs) * time.Second)
+		fmt.Printf("Status response cache enabled: %d seconds\n", secs)
+	}
+
+	localTimezone = time.UTC
+	if tz := os.Getenv("NOTIFICATION_TZ"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			fmt.Printf("WARNING: invalid NOTIFICATION_TZ %q, using UTC: %v\n", tz, err)
+		} else {
+			localTimezone = loc
+		}
+	}
+
+	streaksEnabled = os.Getenv("STREAKS_ENABLED") == "true"
+	for name, value := range map[string]*int{"OVERNIGHT_START": &overnightStart, "OVERNIGHT_END": &overnightEnd} {
+		if raw := os.Getenv(name); raw != "" {
+			if mins, err := parseClock(raw); err != nil {
+				fmt.Printf("WARNING: ignoring %s: %v\n", name, err)
+			} else {
+				*value = mins
+			}
+		}
+	}
+	if overnightStart == overnightEnd {
+		fmt.Println("WARNING: OVERNIGHT_START and OVERNIGHT_END are the same - using 22:00 to 06:00")
+		overnightStart, overnightEnd = 22*60, 6*60
+	}
+
+	// Initialize AWS DynamoDB client
+	sess := session.Must(session.NewSession(request.WithRetryer(
+		&aws.Config{EnforceShouldRetryCheck: aws.Bool(true)},
+		budgetRetryer{client.DefaultRetryer{NumMaxRetries: client.DefaultRetryerMaxNumRetries}},
+	)))
+	dynamoClient = dynamodb.New(sess, dynamoRetryConfig())
+	timeDynamoCalls(dynamoClient.Client)
+	snsClient = sns.New(sess)
+	lambdaClient = lambdasvc.New(sess)
+	eventBusName = os.Getenv("EVENT_BUS_NAME")
+	if eventBusName != "" {
+		eventBridgeClient = eventbridge.New(sess)
+	}
+
+	if os.Getenv("PARTICLE_WARMUP") == "true" {
+		warmParticleConnection(context.Background())
+	}
+
+	tracingEnabled = os.Getenv("ENABLE_XRAY") == "true"
+	if tracingEnabled {
+		clients := []*client.Client{dynamoClient.Client, snsClient.Client, lambdaClient.Client}
+		if eventBridgeClient != nil {
+			clients = append(clients, eventBridgeClient.Client)
+		}
+		enableTracing(clients...)
+	}
+
+	flagsTTL := time.Minute
+	if secs, err := strconv.Atoi(os.Getenv("FLAGS_TTL_SECONDS")); err == nil && secs > 0 {
+		flagsTTL = time.Duration(secs) * time.Second
+	}
+	featureFlags = newCachedValue[FeatureFlags](flagsTTL)
+	warmFeatureFlags()
+}
+
+func main() {
+	lambda.Start(HandleInvocation)
+}
+
+// HandleRequest is the main Lambda handler
+func HandleRequest(ctx context.Context, request AlexaRequest) (response AlexaResponse, err error) {
+	fmt.Printf("Request Type: %s\n", request.Request.Type)
+	ctx, summary := withRequestSummary(ctx, request)
+	start := time.Now()
+	defer func() { summary.log(ctx, start, response, err) }()
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("PANIC handling %s %s: %v\n%s", request.Request.Type, request.Request.Intent.Name, r, debug.Stack())
+			noteSummary(ctx, func(s *RequestSummary) { s.Error = fmt.Sprintf("panic: %v", r) })
+			response = withReferenceCode(request, buildErrorResponse("Sorry, something went wrong. Please try again."))
+			err = nil
+		}
+	}()
+	if logVerbose {
+		logRequest(request)
+	}
+
+	if err := verifyApplication(request); err != nil {
+		return AlexaResponse{}, err
+	}
+	if isPlaybackRequest(request.Request.Type) {
+		fmt.Printf("Ignoring %s\n", request.Request.Type)
+		return buildEmptyResponse(), nil
+	}
+	if request.Session.New {
+		beginSession(request)
+	}
+
+	// Replay event writes that failed in an earlier invocation first
+	eventLogRecovered = flushPendingEvents(ctx)
+
+	switch request.Request.Type {
+	case "LaunchRequest":
+		response, err = handleLaunch(request)
+	case "IntentRequest":
+		response, err = handleIntent(ctx, request)
+	case "SessionEndedRequest":
+		response, err = handleSessionEnded(request)
+	default:
+		response = buildResponse("I don't understand that request.", true)
+	}
+
+	return withReferenceCode(request, response), err
+}
+
+// isPlaybackRequest reports request types Alexa sends about audio playback
+// or a failed response rather than on behalf of the user. They must not be
+// answered with speech, and the skill doesn't play audio, so they are
+// acknowledged and otherwise ignored.
+func isPlaybackRequest(requestType string) bool {
+	return strings.HasPrefix(requestType, "AudioPlayer.") ||
+		strings.HasPrefix(requestType, "PlaybackController.") ||
+		requestType == "System.ExceptionEncountered"
+}
+
+// withReferenceCode adds the request's reference code to a failed response,
+// with INCLUDE_REF_IN_ERRORS
+func withReferenceCode(request AlexaRequest, response AlexaResponse) AlexaResponse {
+	if includeRefInErrors && response.failed && response.Response.OutputSpeech != nil {
+		code := referenceCode(request.Request.RequestID)
+		fmt.Printf("Reference code %s for request %s\n", code, request.Request.RequestID)
+		// Copy first, since a cached response shares its speech
+		speech := *response.Response.OutputSpeech
+		appendSpeech(&speech, fmt.Sprintf("Reference code %s.", spokenCode(code)))
+		response.Response.OutputSpeech = &speech
+	}
+	return response
+}
+
+// beginSession runs once per session, before the first request is handled.
+// A one-shot invocation ("Alexa, tell garage door to open") starts a session
+// with an IntentRequest rather than a LaunchRequest, so this can't live in
+// handleLaunch. The launch greeting itself stays there, so one-shot
+// requests go straight to the answer.
+func beginSession(request AlexaRequest) {
+	if request.Request.Type == "IntentRequest" {
+		fmt.Printf("New one-shot session: %s\n", request.Request.Intent.Name)
+	} else {
+		fmt.Println("New session")
+	}
+}
+
+// verifyApplication logs which skill and Echo device a request came from and
+// checks its application ID. The ID appears in both the session and the
+// context; they must agree, and with ALEXA_SKILL_ID set must match it.
+// Requests outside a session only carry the context copy.
+func verifyApplication(request AlexaRequest) error {
+	sessionApp := request.Session.Application.ApplicationID
+	contextApp := request.Context.System.Application.ApplicationID
+	fmt.Printf("Request context: application=%s device=%s\n",
+		redactID(contextApp), redactID(request.Context.System.Device.DeviceID))
+
+	if sessionApp != "" && contextApp != "" && sessionApp != contextApp {
+		fmt.Printf("Rejecting request whose session application %s doesn't match its context application %s\n", redactID(sessionApp), redactID(contextApp))
+		return fmt.Errorf("mismatched application IDs")
+	}
+	if alexaSkillID == "" {
+		return nil
+	}
+
+	appID := contextApp
+	if appID == "" {
+		appID = sessionApp
+	}
+	if appID != alexaSkillID {
+		fmt.Printf("Rejecting request from unexpected application %s\n", redactID(appID))
+		return fmt.Errorf("request from unexpected application ID")
+	}
+	return nil
+}
+
+func handleLaunch(request AlexaRequest) (AlexaResponse, error) {
+	speech := "Garage door controller ready. Say 'press button' to activate the garage door."
+	return buildResponse(speech, false), nil
+}
+
+func handleIntent(ctx context.Context, request AlexaRequest) (AlexaResponse, error) {
+	intentName := request.Request.Intent.Name
+	fmt.Printf("Intent: %s\n", intentName)
+
+	// The relay is a toggle, so repeated presses would just stutter the door
+	if count, ok := slotInt(request.Request.Intent, "Count"); ok && count > 1 {
+		fmt.Printf("Refusing %s with Count=%d\n", intentName, count)
+		speech := "I can only operate the door one step at a time. Ask me again once it has finished moving."
+		return buildResponse(speech, true), nil
+	}
+
+	if needsAccountLink(request) {
+		fmt.Printf("Account not linked - refusing %s\n", intentName)
+		return buildLinkAccountResponse(), nil
+	}
+
+	switch intentName {
+	case "PressButtonIntent", "GetStatusIntent", "GetStatusLiveIntent", "GetUptimeIntent", "AcknowledgeIntent", "GetAutoCloseETAIntent", "DelayAlertIntent", "RenameDoorIntent", "SnoozeIntent", "GetLongestOpenIntent", "GetStreakIntent", "ResetStateIntent":
+		return handleDeviceIntent(ctx, request)
+	case "GetAllStatusIntent":
+		return handleGetAllStatus(ctx, request)
+	case "GetConfigIntent":
+		return handleGetConfig(ctx)
+	case "TestNotificationIntent":
+		return handleTestNotification(ctx)
+	case "EnableNotificationsIntent":
+		return handleEnableNotifications(request)
+	case "AMAZON.HelpIntent":
+		return handleHelp()
+	case "AMAZON.CancelIntent", "AMAZON.StopIntent", "AMAZON.NavigateHomeIntent":
+		return handleStop()
+	default:
+		return handleFallback(intentName)
+	}
+}
+
+// handleDeviceIntent resolves which door an intent is about, then runs it
+func handleDeviceIntent(ctx context.Context, request AlexaRequest) (AlexaResponse, error) {
+	intent := request.Request.Intent
+
+	userID := request.Session.User.UserID
+	deviceID, prompt := resolveDevice(ctx, intent, userID)
+	if prompt != nil {
+		return *prompt, nil
+	}
+	noteSummary(ctx, func(s *RequestSummary) { s.Device = deviceID })
+
+	// Check access before anything, including cached responses, is served
+	if !userCanAccess(userID, deviceID) {
+		fmt.Printf("User %s is not allowed to use %s\n", redactID(userID), deviceID)
+		speech := fmt.Sprintf("Sorry, you don't have access to %s.", spokenName(deviceID))
+		return buildResponse(speech, true), nil
+	}
+
+	loadFriendlyName(ctx, deviceID)
+
+	switch intent.Name {
+	case "PressButtonIntent":
+		if flagOr(currentFlags(ctx).ConfirmationRequired, confirmPress) {
+			if intent.ConfirmationStatus == "DENIED" {
+				return buildResponse("Okay, I won't press the button.", true), nil
+			}
+			if intent.ConfirmationStatus != "CONFIRMED" {
+				prompt := fmt.Sprintf("Do you want me to press the button for %s?", spokenName(deviceID))
+				return buildConfirmIntentResponse(prompt, intent), nil
+			}
+		}
+		response, err := handlePressButton(ctx, deviceID)
+		if err == nil && !response.failed {
+			rememberLastOperated(ctx, userID, deviceID)
+		}
+		return response, err
+	case "GetStatusIntent":
+		return cachedResponse(deviceID, userID, supportsAPL(request), request.Request.Locale, func() (AlexaResponse, error) {
+			return handleGetStatus(ctx, deviceID, false, supportsAPL(request), request.Request.Locale)
+		})
+	case "GetStatusLiveIntent":
+		return handleGetStatus(ctx, deviceID, true, supportsAPL(request), request.Request.Locale)
+	case "GetUptimeIntent":
+		return handleGetUptime(ctx, deviceID)
+	case "AcknowledgeIntent":
+		return handleAcknowledge(ctx, deviceID)
+	case "GetAutoCloseETAIntent":
+		return handleGetAutoCloseETA(ctx, deviceID)
+	case "DelayAlertIntent":
+		return handleDelayAlert(ctx, deviceID, intent)
+	case "RenameDoorIntent":
+		return handleRenameDoor(ctx, deviceID, intent)
+	case "SnoozeIntent":
+		return handleSnooze(ctx, deviceID, intent)
+	case "GetLongestOpenIntent":
+		return handleGetLongestOpen(ctx, deviceID)
+	case "GetStreakIntent":
+		return handleGetStreak(ctx, deviceID)
+	case "ResetStateIntent":
+		return handleResetState(ctx, deviceID, userID, intent)
+	default:
+		return buildResponse("I don't understand that command.", true), nil
+	}
+}
+
+func handleSessionEnded(request AlexaRequest) (AlexaResponse, error) {
+	return buildResponse("Goodbye", true), nil
+}
+
+func handlePressButton(ctx context.Context, deviceID string) (AlexaResponse, error) {
+	fmt.Printf("Pressing garage door button for %s...\n", deviceID)
+	name := spokenName(deviceID)
+
+	// Note where the door started so the verification can tell if it moved
+	var before string
+	if verifyAfterPress || doublePulse || detectSuccessByStatus {
+		if reading, err := fetchDoorStatus(ctx, deviceID, defaultStatusOptions()); err == nil {
+			before = reading.Status
+		}
+	}
+
+	// Call Particle cloud function
+	success, err := callParticleFunction(ctx, deviceID, "pressButton", "")
+	if err != nil {
+		fmt.Printf("Error calling Particle function: %v\n", err)
+		if errors.Is(err, errDeviceNotResponding) {
+			return buildErrorResponse(notRespondingSpeech(name)), nil
+		}
+		if errors.Is(err, errParticleUnavailable) {
+			return buildErrorResponse(particleUnavailableSpeech(name)), nil
+		}
+		speech := fmt.Sprintf("Sorry, I couldn't communicate with the opener for %s. Please try again.", name)
+		return buildErrorResponse(speech), nil
+	}
+
+	// The return value isn't trusted in this mode; the status change decides
+	if detectSuccessByStatus && !doublePulse && before != "" {
+		return confirmPressByStatus(ctx, deviceID, before), nil
+	}
+
+	if success {
+		noteSummary(ctx, func(s *RequestSummary) { s.Action = "pressed" })
+
+		// The door is about to move, so any cached status is stale
+		if statusCache != nil {
+			statusCache.For(deviceID).Invalidate()
+		}
+		invalidateResponses(deviceID)
+
+		// Verbose confirmations mention the previous press, so read it first
+		var lastPress string
+		if verboseResponses() {
+			if state, err := getDoorState(ctx, deviceID); err == nil && state != nil && state.LastButtonPress > 0 {
+				lastPress = phrase("lastPress", "ago", humanizeDuration((now().Unix()-state.LastButtonPress)/60))
+			}
+		}
+
+		// Update DynamoDB with button press time
+		err = updateButtonPress(ctx, deviceID)
+		if err != nil {
+			fmt.Printf("Error updating button press in DynamoDB: %v\n", err)
+			// Continue anyway - don't fail the request
+		}
+
+		if doublePulse {
+			return buildResponse(secondPulseSpeech(ctx, deviceID, before), true), nil
+		}
+		if verifyAfterPress {
+			return buildResponse(verifyPressSpeech(ctx, deviceID, before), true), nil
+		}
+
+		speech := phrase("pressed", "Door", capitalize(strings.TrimPrefix(name, "the ")),
+			"hold", spokenHold(relayHold(ctx, deviceID)), "lastPress", lastPress)
+		return buildResponse(speech, true), nil
+	}
+
+	noteSummary(ctx, func(s *RequestSummary) { s.Action = "relay_already_active" })
+	return buildResponse(relayAlreadyActiveSpeech(ctx, deviceID), true), nil
+}
+
+// verifyPressSpeech waits for the door to start moving, re-reads its status
+// and describes whether it changed from before
+func verifyPressSpeech(ctx context.Context, deviceID, before string) string {
+	name := spokenName(deviceID)
+	reading, err := statusAfterPress(ctx, deviceID)
+	if err != nil {
+		return fmt.Sprintf("I pressed the button, but I couldn't check whether %s moved.", name)
+	}
+	return pressOutcomeSpeech(name, before, reading)
+}
+
+// statusAfterPress waits VERIFY_DELAY_SECONDS for the door to start moving,
+// then reads and records its status. The wait is cut short so the response
+// still beats the invocation deadline.
+func statusAfterPress(ctx context.Context, deviceID string) (statusReading, error) {
+	delay := verifyDelay
+	if deadline, ok := ctx.Deadline(); ok {
+		// Leave time for the status read and the state write afterwards
+		if remaining := time.Until(deadline) - 3*time.Second; remaining < delay {
+			delay = remaining
+		}
+	}
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
+	reading, err := fetchDoorStatus(ctx, deviceID, StatusOptions{})
+	if err != nil {
+		fmt.Printf("Error verifying press: %v\n", err)
+		return statusReading{}, err
+	}
+	fmt.Printf("Status after press: %s\n", reading.Status)
+
+	if err := updateDoorStatus(ctx, deviceID, reading.Status); err != nil {
+		fmt.Printf("Error updating status in DynamoDB: %v\n", err)
+	}
+	return reading, nil
+}
+
+// pressOutcomeSpeech describes whether the door's status changed from before
+func pressOutcomeSpeech(name, before string, reading statusReading) string {
+	after := reading.Status
+	switch {
+	case after == "moving" && before == "closed":
+		return fmt.Sprintf("I pressed the button and %s is now opening.", name)
+	case after == "moving" && before == "open":
+		return fmt.Sprintf("I pressed the button and %s is now closing.", name)
+	case after == "moving":
+		return fmt.Sprintf("I pressed the button and %s is moving.", name)
+	case after == "unknown" || after == "":
+		return fmt.Sprintf("I pressed the button, but I couldn't read whether %s moved.", name)
+	case after == before:
+		return fmt.Sprintf("I pressed the button, but %s still reports %s.", name, reading.describe())
+	default:
+		return fmt.Sprintf("I pressed the button and %s is now %s.", name, reading.describe())
+	}
+}
+
+// handleGetStatus reports the door status; forceLive skips the status cache
+// for users who ask for a reading "right now", and screen adds an APL visual
+func handleGetStatus(ctx context.Context, deviceID string, forceLive, screen bool, locale string) (AlexaResponse, error) {
+	fmt.Printf("Getting garage door status for %s...\n", deviceID)
+	loc := localeFor(locale)
+	name := loc.doorName(deviceID)
+
+	opts := defaultStatusOptions()
+	if forceLive {
+		opts = StatusOptions{}
+	}
+	reading, err := fetchDoorStatus(ctx, deviceID, opts)
+	if err != nil {
+		fmt.Printf("Error getting status: %v\n", err)
+		if speech, ok := storedStatusSpeech(ctx, deviceID, loc); ok {
+			return buildResponse(speech, true), nil
+		}
+		if speech, ok := assumedStatusSpeech(ctx, deviceID, loc); ok {
+			return buildResponse(speech, true), nil
+		}
+		if errors.Is(err, errDeviceNotResponding) {
+			return buildErrorResponse(loc.sentence("notResponding", notRespondingSpeech(name), name)), nil
+		}
+		if errors.Is(err, errParticleUnavailable) {
+			return buildErrorResponse(loc.sentence("particleUnavailable", particleUnavailableSpeech(name), name)), nil
+		}
+		speech := loc.sentence("statusFailed", fmt.Sprintf("Sorry, I couldn't get the status of %s. Please try again.", name), name)
+		return buildErrorResponse(speech), nil
+	}
+	status := reading.Status
+
+	// Only live readings are recorded; a cached one was recorded when fetched
+	if reading.Source == sourceLive {
+		err = updateDoorStatus(ctx, deviceID, status)
+		if err != nil {
+			fmt.Printf("Error updating status in DynamoDB: %v\n", err)
+			// Continue anyway - don't fail the request
+		}
+	}
+
+	// The sensor didn't give a reading, so suggest a remedy instead
+	if status == "unknown" || status == "" {
+		if speech, ok := assumedStatusSpeech(ctx, deviceID, loc); ok {
+			return buildResponse(speech, true), nil
+		}
+		// UNKNOWN_STATUS_MESSAGE is said as written, in any locale
+		if unknownStatusMsg == defaultUnknownStatusMsg {
+			return buildResponse(loc.sentence("unknownStatus", unknownStatusMsg), true), nil
+		}
+		return buildResponse(unknownStatusMsg, true), nil
+	}
+
+	// Get additional info from DynamoDB if door is open
+	var openMins int64
+	var screenDetail, warning string
+	if status == "open" {
+		state, err := getDoorState(ctx, deviceID)
+		warning = autoCloseWarning(ctx, state, loc)
+		if err == nil && state != nil && state.LastOpenedTime > 0 {
+			openMins = (now().Unix() - state.LastOpenedTime) / 60
+			// Short openings are just "open"; the duration is noise
+			if openMins < minSpeakDuration {
+				openMins = 0
+			}
+			if openMins > 0 {
+				screenDetail = fmt.Sprintf(loc.ScreenOpenFor, loc.plainDuration(openMins))
+			}
+		}
+	}
+
+	// A closed door can't be blocked, so only ask about the others
+	var obstruction string
+	if status != "closed" && doorObstructed(ctx, deviceID) {
+		obstruction = loc.sentence("obstruction", ", but there's an obstruction detected")
+	}
+
+	speech := readingSpeech(name, reading, obstruction, loc)
+	var checked string
+	if forceLive || (reading.Source == sourceLive && verboseResponses()) {
+		checked = loc.phrase("checkedNow")
+	}
+	if status == "closed" && verboseResponses() {
+		if state, err := getDoorState(ctx, deviceID); err == nil && state != nil && state.LastClosedTime > 0 {
+			closedFor := loc.phrase("closedFor", "duration", loc.plainDuration((now().Unix()-state.LastClosedTime)/60))
+			checked = strings.TrimSpace(closedFor + " " + checked)
+		}
+	}
+	// Warn before a close the user might not expect, right after checking
+	if warning != "" {
+		checked = strings.TrimSpace(checked + " " + warning)
+	}
+
+	// The open duration follows the request's locale everywhere it appears:
+	// as SSML in the speech, and as plain text on the card and screen
+	var response AlexaResponse
+	cardText := speech
+	if openMins > 0 && speakOpenDuration() {
+		cardText += " " + loc.openFor(openMins)
+		response = buildSSMLResponse(ssmlSpeak(ssmlText(speech), loc.ssmlOpenFor(openMins), ssmlText(checked)), true)
+	} else {
+		response = buildResponse(strings.TrimSpace(speech+" "+checked), true)
+	}
+	if checked != "" {
+		cardText += " " + checked
+	}
+	response.Response.Card = buildStatusCard(cardText, status, loc)
+	response.live = reading.Source == sourceLive
+	if screen && (status == "open" || status == "closed") {
+		response.Response.Directives = append(response.Response.Directives,
+			buildStatusDirective(name, status, screenDetail, loc))
+	}
+	return response, nil
+}
+
+// notRespondingSpeech is the response when the controller didn't answer Particle
+func notRespondingSpeech(name string) string {
+	return fmt.Sprintf("The controller for %s didn't respond. It may be offline or have lost its connection.", name)
+}
+
+// particleUnavailableSpeech is the response while the Particle breaker is
+// open, so the user knows not to retry straight away
+func particleUnavailableSpeech(name string) string {
+	return fmt.Sprintf("The Particle cloud that connects to %s isn't responding right now. Please try again in a minute.", name)
+}
+
+// storedStatusSpeech describes the last status recorded in DynamoDB, for when
+// the controller can't be reached. It declines if that status is older than
+// STORED_STATUS_MAX_AGE_MINUTES, since an old answer could be wrong.
+func storedStatusSpeech(ctx context.Context, deviceID string, loc speechLocale) (string, bool) {
+	if storedStatusMaxAge <= 0 {
+		return "", false
+	}
+
+	state, err := getDoorState(ctx, deviceID)
+	if err != nil || state == nil || state.LastChecked == 0 {
+		return "", false
+	}
+	if state.Status != "open" && state.Status != "closed" {
+		return "", false
+	}
+
+	age := (now().Unix() - state.LastChecked) / 60
+	if age > storedStatusMaxAge {
+		fmt.Printf("Stored status is %d minutes old - too old to report\n", age)
+		return "", false
+	}
+
+	reading := newStatusReading(state.Status, sourceStored, time.Unix(state.LastChecked, 0))
+	return loc.sentence("unreachable", "I can't reach the controller right now. ") + readingSpeech(loc.doorName(deviceID), reading, "", loc), true
+}
+
+// readingSpeech words a reading by where it came from, so only one straight
+// from the sensor is stated as fact and anything older is hedged with its age
+func readingSpeech(name string, reading statusReading, obstruction string, loc speechLocale) string {
+	if reading.Source == sourceLive {
+		return loc.phrase("statusLive", "Name", capitalize(name), "status", loc.describe(reading), "obstruction", obstruction)
+	}
+	age := int64(now().Sub(reading.AsOf).Minutes())
+	return loc.phrase("statusStale", "Name", capitalize(name), "status", loc.describe(reading),
+		"age", loc.plainDuration(age), "obstruction", obstruction)
+}
+
+// Where a status reading came from
+const (
+	sourceLive   = "live"   // Read from Particle for this request
+	sourceCached = "cached" // Served from the in-memory status cache
+	sourceStored = "stored" // Last status persisted in DynamoDB
+	sourcePushed = "pushed" // Pushed by the Particle webhook into DynamoDB
+)
+
+// statusReading is a door status along with where and when it was read
+type statusReading struct {
+	Status      string
+	Position    int  // Percent open, for openers that report a position
+	HasPosition bool // Whether Position was reported
+	Source      string
+	AsOf        time.Time
+}
+
+// newStatusReading interprets a raw status variable value, through
+// STATUS_MAP first. Openers that
+// report a 0-100 position instead of a status are mapped to open above
+// OPEN_POSITION_THRESHOLD and closed otherwise.
+func newStatusReading(raw, source string, asOf time.Time) statusReading {
+	reading := statusReading{Status: raw, Source: source, AsOf: asOf}
+	if status, ok := mapStatus(raw); ok {
+		reading.Status = status
+		return reading
+	}
+
+	position, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil {
+		return reading
+	}
+
+	reading.HasPosition = true
+	reading.Position = int(math.Round(math.Max(0, math.Min(100, position))))
+	if reading.Position > openPositionMin {
+		reading.Status = "open"
+	} else {
+		reading.Status = "closed"
+	}
+	return reading
+}
+
+// describe renders the reading for speech, e.g. "partially open at 60 percent"
+func (r statusReading) describe() string {
+	if r.HasPosition && r.Position > 0 && r.Position < 100 {
+		return fmt.Sprintf("partially open at %d percent", r.Position)
+	}
+	return r.Status
+}
+
+// StatusOptions is the freshness policy for one status read
+type StatusOptions struct {
+	// MaxStaleness is the oldest cached reading the caller will accept;
+	// zero always reads the sensor
+	MaxStaleness time.Duration
+
+	// AllowPushed accepts a recent status pushed by the Particle webhook
+	AllowPushed bool
+}
+
+// defaultStatusOptions accepts anything the status cache still holds, or a
+// recently pushed status
+func defaultStatusOptions() StatusOptions {
+	return StatusOptions{MaxStaleness: statusCacheTTL, AllowPushed: true}
+}
+
+// fetchDoorStatus reads the door status, serving it from the pushed state or
+// the status cache when enabled and fresh enough for opts
+func fetchDoorStatus(ctx context.Context, deviceID string, opts StatusOptions) (statusReading, error) {
+	if opts.AllowPushed {
+		if reading, ok := pushedStatus(ctx, deviceID); ok {
+			return reading, nil
+		}
+	}
+
+	live := false
+	fetch := func() (string, error) {
+		live = true
+		return getParticleVariable(ctx, deviceID, statusVariable)
+	}
+
+	if statusCache == nil {
+		raw, err := fetch()
+		return newStatusReading(raw, sourceLive, now()), err
+	}
+
+	cache := statusCache.For(deviceID)
+	if opts.MaxStaleness < statusCacheTTL {
+		// Stricter than the cache itself, so only a young enough entry will do
+		if raw, fetchedAt, ok := cache.Peek(); ok && opts.MaxStaleness > 0 && time.Since(fetchedAt) <= opts.MaxStaleness {
+			return newStatusReading(raw, sourceCached, fetchedAt), nil
+		}
+
+		raw, err := fetch()
+		if err == nil {
+			cache.Set(raw)
+		}
+		return newStatusReading(raw, sourceLive, now()), err
+	}
+
+	raw, fetchedAt, err := cache.Get(fetch)
+	source := sourceCached
+	if live {
+		source = sourceLive
+	}
+	return newStatusReading(raw, source, fetchedAt), err
+}
+
+// handleAcknowledge silences open-door reminders for SNOOZE_MINUTES without
+// closing the door
+func handleAcknowledge(ctx context.Context, deviceID string) (AlexaResponse, error) {
+	name := spokenName(deviceID)
+
+	state, err := getDoorState(ctx, deviceID)
+	if err != nil {
+		fmt.Printf("Error getting door state: %v\n", err)
+		return buildErrorResponse("Sorry, I couldn't update the reminders. Please try again."), nil
+	}
+	if state != nil && state.Status == "closed" {
+		speech := fmt.Sprintf("%s is closed, so there are no reminders to stop.", capitalize(name))
+		return buildResponse(speech, true), nil
+	}
+
+	until := now().Add(time.Duration(snoozeMinutes) * time.Minute)
+	if err := snoozeReminders(ctx, deviceID, state, until); err != nil {
+		fmt.Printf("Error snoozing reminders: %v\n", err)
+		return buildErrorResponse("Sorry, I couldn't update the reminders. Please try again."), nil
+	}
+
+	window := humanizeDuration(snoozeMinutes)
+	if snoozeMinutes == 60 {
+		window = "an hour"
+	}
+	speech := fmt.Sprintf("Okay, I'll stop reminding you for %s.", window)
+	return buildResponse(speech, true), nil
+}
+
+// handleSnooze silences open-door reminders until tomorrow morning, for the
+// Duration slot, or for SNOOZE_MINUTES if neither is given. Like
+// AcknowledgeIntent it holds off auto-close too.
+func handleSnooze(ctx context.Context, deviceID string, intent Intent) (AlexaResponse, error) {
+	name := spokenName(deviceID)
+
+	current := now()
+	until := current.Add(time.Duration(snoozeMinutes) * time.Minute)
+	if slotValue(intent, "Until") == "tomorrow" {
+		until = nextMorning(current)
+	} else if raw := slotValue(intent, "Duration"); raw != "" {
+		parsed, err := parseISODuration(raw)
+		if err != nil || parsed <= 0 {
+			fmt.Printf("Unusable Duration slot %q: %v\n", raw, err)
+			return buildResponse("Sorry, I didn't catch how long to snooze for. Try saying, snooze alerts until tomorrow morning.", true), nil
+		}
+		until = current.Add(parsed)
+	}
+
+	state, err := getDoorState(ctx, deviceID)
+	if err != nil {
+		fmt.Printf("Error getting door state: %v\n", err)
+		return buildErrorResponse("Sorry, I couldn't update the reminders. Please try again."), nil
+	}
+	if state != nil && state.Status == "closed" {
+		speech := fmt.Sprintf("%s is closed, so there are no reminders to snooze.", capitalize(name))
+		return buildResponse(speech, true), nil
+	}
+
+	if err := snoozeReminders(ctx, deviceID, state, until); err != nil {
+		fmt.Printf("Error snoozing reminders: %v\n", err)
+		return buildErrorResponse("Sorry, I couldn't update the reminders. Please try again."), nil
+	}
+
+	speech := fmt.Sprintf("Okay, I won't remind you about %s until %s.", name, spokenTime(until))
+	return buildResponse(speech, true), nil
+}
+
+// nextMorning is SNOOZE_MORNING_HOUR on the next local morning. Before 5 AM
+// that is later the same day, since "tomorrow morning" said after midnight
+// means the coming one.
+func nextMorning(current time.Time) time.Time {
+	local := current.In(localTimezone)
+	morning := time.Date(local.Year(), local.Month(), local.Day(), snoozeMorningHour, 0, 0, 0, localTimezone)
+	if local.Hour() < 5 && local.Before(morning) {
+		return morning
+	}
+	return morning.AddDate(0, 0, 1)
+}
+
+// handleDelayAlert pushes this open session's alert out by the Duration slot
+// (an hour by default). Unlike snoozing it doesn't count as acknowledging the
+// door, and the alert still comes once the delay is over.
+func handleDelayAlert(ctx context.Context, deviceID string, intent Intent) (AlexaResponse, error) {
+	name := spokenName(deviceID)
+
+	delay := time.Hour
+	if raw := slotValue(intent, "Duration"); raw != "" {
+		parsed, err := parseISODuration(raw)
+		if err != nil || parsed <= 0 {
+			fmt.Printf("Unusable Duration slot %q: %v\n", raw, err)
+			return buildResponse("Sorry, I didn't catch how long to wait. Try saying, don't alert me for another hour.", true), nil
+		}
+		delay = parsed
+	}
+
+	state, err := getDoorState(ctx, deviceID)
+	if err != nil {
+		fmt.Printf("Error getting door state: %v\n", err)
+		return buildErrorResponse("Sorry, I couldn't update the alert. Please try again."), nil
+	}
+	if state == nil || state.Status != "open" || state.LastOpenedTime == 0 {
+		speech := fmt.Sprintf("%s isn't open, so there's no alert to delay.", capitalize(name))
+		return buildResponse(speech, true), nil
+	}
+
+	until := now().Add(delay)
+	if err := delayAlert(ctx, state, until); err != nil {
+		fmt.Printf("Error delaying alert: %v\n", err)
+		return buildErrorResponse("Sorry, I couldn't update the alert. Please try again."), nil
+	}
+
+	// The alert goes out at whichever is later, the delay or the threshold
+	alertAt := time.Unix(state.LastOpenedTime, 0).Add(time.Duration(state.AlertThresholdMins) * time.Minute)
+	if until.After(alertAt) {
+		alertAt = until
+	}
+	speech := fmt.Sprintf("Okay. If %s is still open, I'll alert you at %s.", name, spokenTime(alertAt))
+	return buildResponse(speech, true), nil
+}
+
+// handleRenameDoor stores a new spoken name for a door from the NewName slot
+func handleRenameDoor(ctx context.Context, deviceID string, intent Intent) (AlexaResponse, error) {
+	name, ok := normalizeFriendlyName(slotValue(intent, "NewName"))
+	if !ok {
+		return buildResponse("Sorry, I didn't catch the new name. Try saying, call the garage door the workshop door.", true), nil
+	}
+	if doorNameTaken(ctx, deviceID, name) {
+		speech := fmt.Sprintf("Sorry, there's already a door called %s. Try a different name.", bareDoorName(name))
+		return buildResponse(speech, true), nil
+	}
+
+	if err := setFriendlyName(ctx, deviceID, name); err != nil {
+		fmt.Printf("Error saving friendly name: %v\n", err)
+		return buildErrorResponse("Sorry, I couldn't save the new name. Please try again."), nil
+	}
+	rememberFriendlyName(deviceID, name)
+	invalidateResponses(deviceID)
+
+	speech := fmt.Sprintf("Okay, I'll call it %s from now on.", name)
+	return buildResponse(speech, true), nil
+}
+
+// handleResetState deletes a door's stored state after a yes/no
+// confirmation. It can't be undone, so it is only offered when ALLOWED_USERS
+// names who may use the door.
+func handleResetState(ctx context.Context, deviceID, userID string, intent Intent) (AlexaResponse, error) {
+	name := spokenName(deviceID)
+
+	if userAccess == nil {
+		fmt.Printf("Refusing state reset from %s - ALLOWED_USERS is not set\n", redactID(userID))
+		return buildResponse("Sorry, only allowed users can reset the stored state.", true), nil
+	}
+	if intent.ConfirmationStatus == "DENIED" {
+		return buildResponse("Okay, I'll leave it alone.", true), nil
+	}
+	if intent.ConfirmationStatus != "CONFIRMED" {
+		prompt := fmt.Sprintf("This clears everything stored about %s, including any name you gave it. Do you want me to reset it?", name)
+		return buildConfirmIntentResponse(prompt, intent), nil
+	}
+
+	if err := deleteDoorState(ctx, deviceID); err != nil {
+		fmt.Printf("Error deleting door state: %v\n", err)
+		return buildErrorResponse("Sorry, I couldn't clear the stored state. Please try again."), nil
+	}
+	fmt.Printf("Door state for %s reset by %s\n", deviceID, redactID(userID))
+	noteSummary(ctx, func(s *RequestSummary) { s.Action = "reset_state" })
+
+	if statusCache != nil {
+		statusCache.For(deviceID).Invalidate()
+	}
+	invalidateResponses(deviceID)
+	lastDoorStates.Delete(deviceID)
+	rememberFriendlyName(deviceID, "")
+
+	speech := fmt.Sprintf("I've cleared the stored state for %s.", name)
+	return buildResponse(speech, true), nil
+}
+
+// normalizeFriendlyName turns a spoken name into the form responses use,
+// e.g. "workshop" becomes "the workshop door"
+func normalizeFriendlyName(raw string) (string, bool) {
+	name := strings.Join(strings.Fields(strings.ToLower(raw)), " ")
+	name = strings.TrimPrefix(name, "the ")
+	if name == "" || name == "door" || len(name) > 40 {
+		return "", false
+	}
+	if !strings.HasSuffix(name, "door") {
+		name += " door"
+	}
+	return "the " + name, true
+}
+
+// setFriendlyName stores a door's spoken name, leaving the rest of its
+// state alone
+func setFriendlyName(ctx context.Context, deviceID, name string) error {
+	if doorStateTable == "" {
+		return fmt.Errorf("door state table not configured")
+	}
+
+	_, err := dynamoClient.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(doorStateTable),
+		Key:              stateKey(deviceID),
+		UpdateExpression: aws.String("SET friendlyName = :name"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":name": {S: aws.String(name)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error updating item in DynamoDB: %w", err)
+	}
+	return nil
+}
+
+// parseISODuration parses the AMAZON.DURATION slot format, e.g. PT1H30M or P1D
+func parseISODuration(value string) (time.Duration, error) {
+	match := isoDurationPattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("unsupported duration %q", value)
+	}
+
+	units := []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var total time.Duration
+	for i, unit := range units {
+		if match[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(match[i+1])
+		if err != nil {
+			return 0, err
+		}
+		total += time.Duration(n) * unit
+	}
+	return total, nil
 }
 
-func init() {
-	particleAccessToken = os.Getenv("PARTICLE_ACCESS_TOKEN")
-	particleDeviceID = os.Getenv("PARTICLE_DEVICE_ID")
-	doorStateTable = os.Getenv("DOOR_STATE_TABLE")
+// isoDurationPattern matches the day and time parts of an ISO 8601 duration
+var isoDurationPattern = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
 
-	if particleAccessToken == "" {
-		fmt.Println("WARNING: PARTICLE_ACCESS_TOKEN not set")
+// handleGetAutoCloseETA says how long until the monitor closes an open door
+func handleGetAutoCloseETA(ctx context.Context, deviceID string) (AlexaResponse, error) {
+	if !autoCloseOn(ctx) {
+		return buildResponse("Auto-close is turned off.", true), nil
 	}
-	if particleDeviceID == "" {
-		fmt.Println("WARNING: PARTICLE_DEVICE_ID not set")
+
+	name := spokenName(deviceID)
+
+	state, err := getDoorState(ctx, deviceID)
+	if err != nil {
+		fmt.Printf("Error getting door state: %v\n", err)
+		return buildErrorResponse("Sorry, I couldn't check the auto-close timer. Please try again."), nil
 	}
-	if doorStateTable == "" {
-		fmt.Println("WARNING: DOOR_STATE_TABLE not set")
+	if state == nil || state.Status != "open" || state.LastOpenedTime == 0 {
+		speech := fmt.Sprintf("%s isn't open, so there's nothing to auto-close.", capitalize(name))
+		return buildResponse(speech, true), nil
 	}
 
-	// Initialize AWS DynamoDB client
-	sess := session.Must(session.NewSession())
-	dynamoClient = dynamodb.New(sess)
-}
+	if state.ManualInterventionNeeded {
+		speech := fmt.Sprintf("I tried to close %s but it didn't close, so I've stopped trying. Please check it.", name)
+		return buildResponse(speech, true), nil
+	}
 
-func main() {
-	lambda.Start(HandleRequest)
-}
+	current := now().Unix()
+	if state.SnoozeUntil > current {
+		speech := fmt.Sprintf("Auto-close is paused while reminders are snoozed, until %s.", spokenTime(time.Unix(state.SnoozeUntil, 0)))
+		return buildResponse(speech, true), nil
+	}
 
-// HandleRequest is the main Lambda handler
-func HandleRequest(ctx context.Context, request AlexaRequest) (AlexaResponse, error) {
-	fmt.Printf("Request Type: %s\n", request.Request.Type)
+	if state.AutoCloseDeferredSince > 0 {
+		speech := fmt.Sprintf("Auto-close for %s is waiting because there's been movement in the garage. I'll try again at the next check.", name)
+		return buildResponse(speech, true), nil
+	}
 
-	switch request.Request.Type {
-	case "LaunchRequest":
-		return handleLaunch(request)
-	case "IntentRequest":
-		return handleIntent(request)
-	case "SessionEndedRequest":
-		return handleSessionEnded(request)
-	default:
-		return buildResponse("I don't understand that request.", true), nil
+	remaining := autoCloseRemaining(state, current)
+	if remaining < 1 {
+		speech := fmt.Sprintf("%s is due to close automatically at the next check.", capitalize(name))
+		return buildResponse(speech, true), nil
 	}
+
+	speech := fmt.Sprintf("%s will close automatically in %s.", capitalize(name), humanizeDuration(remaining))
+	return buildResponse(speech, true), nil
 }
 
-func handleLaunch(request AlexaRequest) (AlexaResponse, error) {
-	speech := "Garage door controller ready. Say 'press button' to activate the garage door."
-	return buildResponse(speech, false), nil
+// autoCloseRemaining is how many minutes are left before the monitor
+// auto-closes an open door, ignoring whatever may hold it off
+func autoCloseRemaining(state *DoorState, current int64) int64 {
+	return autoCloseMinutes - (current-state.LastOpenedTime)/60
 }
 
-func handleIntent(request AlexaRequest) (AlexaResponse, error) {
-	intentName := request.Request.Intent.Name
-	fmt.Printf("Intent: %s\n", intentName)
+// autoCloseWarning warns when an open door is within AUTO_CLOSE_WARN_MINUTES
+// of closing automatically, or says nothing if auto-close won't happen soon
+func autoCloseWarning(ctx context.Context, state *DoorState, loc speechLocale) string {
+	if autoCloseWarnMins <= 0 || !autoCloseOn(ctx) {
+		return ""
+	}
+	if state == nil || state.Status != "open" || state.LastOpenedTime == 0 || state.ManualInterventionNeeded || state.AutoCloseDeferredSince > 0 {
+		return ""
+	}
+	current := now().Unix()
+	if state.SnoozeUntil > current {
+		return ""
+	}
 
-	switch intentName {
-	case "PressButtonIntent":
-		return handlePressButton()
-	case "GetStatusIntent":
-		return handleGetStatus()
-	case "AMAZON.HelpIntent":
-		return handleHelp()
-	case "AMAZON.CancelIntent", "AMAZON.StopIntent":
-		return handleStop()
+	remaining := autoCloseRemaining(state, current)
+	switch {
+	case remaining > autoCloseWarnMins:
+		return ""
+	case remaining < 1:
+		return loc.sentence("autoCloseNext", "It's due to close automatically at the next check.")
 	default:
-		return buildResponse("I don't understand that command.", true), nil
+		return loc.sentence("autoCloseIn", fmt.Sprintf("It will close automatically in %s.", humanizeDuration(remaining)), loc.plainDuration(remaining))
 	}
 }
 
-func handleSessionEnded(request AlexaRequest) (AlexaResponse, error) {
-	return buildResponse("Goodbye", true), nil
-}
+// handleGetConfig summarizes the loaded configuration for troubleshooting.
+// It only says whether secrets and ARNs are set, never their values.
+func handleGetConfig(ctx context.Context) (AlexaResponse, error) {
+	var parts []string
 
-func handlePressButton() (AlexaResponse, error) {
-	fmt.Println("Pressing garage door button...")
+	if len(devices) > 1 {
+		parts = append(parts, fmt.Sprintf("I'm set up for %d doors: %s.", len(devices), strings.ReplaceAll(doorNameList(), " or ", " and ")))
+	} else {
+		parts = append(parts, fmt.Sprintf("I'm set up for %s.", spokenName(defaultDeviceID())))
+	}
+	if particleAccessToken == "" || defaultDeviceID() == "" {
+		parts = append(parts, "The Particle access token or device ID is missing.")
+	}
 
-	// Call Particle cloud function
-	success, err := callParticleFunction("pressButton", "")
-	if err != nil {
-		fmt.Printf("Error calling Particle function: %v\n", err)
-		speech := "Sorry, I couldn't communicate with the garage door opener. Please try again."
-		return buildResponse(speech, true), nil
+	if alertsConfigured {
+		parts = append(parts, fmt.Sprintf("Alerts go out after the door has been open %s.", humanizeDuration(int64(thresholdMinutes))))
+	} else {
+		parts = append(parts, "Notifications aren't set up, so there are no open-door alerts.")
 	}
 
-	if success {
-		// Update DynamoDB with button press time
-		err = updateButtonPress()
-		if err != nil {
-			fmt.Printf("Error updating button press in DynamoDB: %v\n", err)
-			// Continue anyway - don't fail the request
-		}
+	if autoCloseOn(ctx) {
+		parts = append(parts, fmt.Sprintf("Auto-close is on, after %s.", humanizeDuration(autoCloseMinutes)))
+	} else {
+		parts = append(parts, "Auto-close is off.")
+	}
 
-		speech := "Garage door button pressed. The relay has been activated for one second."
-		return buildResponse(speech, true), nil
+	if closeLinkSecret != "" {
+		parts = append(parts, "Alerts include a link to close the door.")
 	}
 
-	speech := "The garage door button is already active. Please wait and try again."
-	return buildResponse(speech, true), nil
+	return buildResponse(strings.Join(parts, " "), true), nil
 }
 
-func handleGetStatus() (AlexaResponse, error) {
-	fmt.Println("Getting garage door status...")
+func handleGetUptime(ctx context.Context, deviceID string) (AlexaResponse, error) {
+	fmt.Println("Getting garage controller uptime...")
 
-	// Call Particle cloud function
-	status, err := getParticleVariable("doorStatus")
+	info, err := getDeviceInfo(ctx, deviceID)
 	if err != nil {
-		fmt.Printf("Error getting status: %v\n", err)
-		speech := "Sorry, I couldn't get the garage door status. Please try again."
+		fmt.Printf("Error getting device info: %v\n", err)
+		speech := "Sorry, I couldn't reach the Particle cloud to check on the garage controller. Please try again."
+		return buildErrorResponse(speech), nil
+	}
+
+	if !info.Connected {
+		speech := "The garage controller is offline."
+		if !info.LastHeard.IsZero() {
+			speech = fmt.Sprintf("The garage controller is offline. It was last heard from %s.", spokenTime(info.LastHeard))
+		}
 		return buildResponse(speech, true), nil
 	}
 
-	// Update DynamoDB with current status
-	err = updateDoorStatus(status)
-	if err != nil {
-		fmt.Printf("Error updating status in DynamoDB: %v\n", err)
-		// Continue anyway - don't fail the request
+	// The last handshake marks the start of the current cloud session
+	onlineSince := info.LastHandshakeAt
+	if onlineSince.IsZero() {
+		onlineSince = info.LastHeard
+	}
+	if onlineSince.IsZero() {
+		return buildResponse("The garage controller is online.", true), nil
 	}
 
-	// Get additional info from DynamoDB if door is open
-	var additionalInfo string
-	if status == "open" {
-		state, err := getDoorState()
-		if err == nil && state != nil && state.LastOpenedTime > 0 {
-			openMins := (time.Now().Unix() - state.LastOpenedTime) / 60
-			if openMins > 60 {
-				hours := openMins / 60
-				mins := openMins % 60
-				additionalInfo = fmt.Sprintf(" It has been open for %d hours and %d minutes.", hours, mins)
-			} else if openMins > 0 {
-				additionalInfo = fmt.Sprintf(" It has been open for %d minutes.", openMins)
-			}
-		}
+	uptime := now().Sub(onlineSince)
+	speech := fmt.Sprintf("The garage controller has been online since %s, for %s.",
+		spokenTime(onlineSince), humanizeDuration(int64(uptime.Minutes())))
+	if uptime < recentReconnectWindow {
+		speech += " It reconnected recently, so its connection may be unstable."
 	}
 
-	speech := fmt.Sprintf("The garage door is currently %s.%s", status, additionalInfo)
 	return buildResponse(speech, true), nil
 }
 
+// helpSpeech lists the main commands, for help and misheard requests
+const helpSpeech = "You can say 'press button' to activate the garage door, 'get status' to check if the door is open or closed, or 'is the controller online' to check the connection."
+
 func handleHelp() (AlexaResponse, error) {
-	speech := "You can say 'press button' to activate the garage door, or 'get status' to check if the door is open or closed."
-	return buildResponse(speech, false), nil
+	return buildResponse(helpSpeech, false), nil
 }
 
 func handleStop() (AlexaResponse, error) {
@@ -253,11 +1541,40 @@ func handleStop() (AlexaResponse, error) {
 	return buildResponse(speech, true), nil
 }
 
+// buildElicitSlotResponse asks the user for a missing slot and keeps the
+// session open; Alexa sends the intent back with the slot filled
+func buildElicitSlotResponse(prompt, slotName string, intent Intent) AlexaResponse {
+	response := buildResponse(prompt, false)
+	response.Response.Reprompt = &Reprompt{
+		OutputSpeech: OutputSpeech{Type: "PlainText", Text: prompt},
+	}
+	response.Response.Directives = []Directive{{
+		Type:          "Dialog.ElicitSlot",
+		SlotToElicit:  slotName,
+		UpdatedIntent: &intent,
+	}}
+	return response
+}
+
+// buildConfirmIntentResponse asks the user to confirm the whole intent; Alexa
+// sends it back with ConfirmationStatus set to CONFIRMED or DENIED
+func buildConfirmIntentResponse(prompt string, intent Intent) AlexaResponse {
+	response := buildResponse(prompt, false)
+	response.Response.Reprompt = &Reprompt{
+		OutputSpeech: OutputSpeech{Type: "PlainText", Text: prompt},
+	}
+	response.Response.Directives = []Directive{{
+		Type:          "Dialog.ConfirmIntent",
+		UpdatedIntent: &intent,
+	}}
+	return response
+}
+
 func buildResponse(text string, shouldEnd bool) AlexaResponse {
 	return AlexaResponse{
 		Version: "1.0",
 		Response: ResponseBody{
-			OutputSpeech: OutputSpeech{
+			OutputSpeech: &OutputSpeech{
 				Type: "PlainText",
 				Text: text,
 			},
@@ -266,11 +1583,143 @@ func buildResponse(text string, shouldEnd bool) AlexaResponse {
 	}
 }
 
+// buildEmptyResponse builds a valid response with no speech, card or
+// directives
+func buildEmptyResponse() AlexaResponse {
+	return AlexaResponse{Version: "1.0"}
+}
+
+// buildSSMLResponse builds a response spoken from SSML; see ssml.go
+func buildSSMLResponse(ssml string, shouldEnd bool) AlexaResponse {
+	response := buildResponse("", shouldEnd)
+	response.Response.OutputSpeech = &OutputSpeech{Type: "SSML", SSML: ssml}
+	return response
+}
+
+// buildErrorResponse builds a response for a request that failed, which gets
+// a reference code appended when INCLUDE_REF_IN_ERRORS is set
+func buildErrorResponse(text string) AlexaResponse {
+	response := buildResponse(text, true)
+	response.failed = true
+	return response
+}
+
+// referenceCodeAlphabet leaves out letters and digits that sound alike or
+// are easily confused, such as B/D/E/P/T/V, I/1 and O/0
+const referenceCodeAlphabet = "ACFHJKLMNQRUWXY2345789"
+
+// referenceCode derives a short code from a request ID, for matching a
+// failure the user heard to its log lines
+func referenceCode(requestID string) string {
+	sum := sha256.Sum256([]byte(requestID))
+	code := make([]byte, 4)
+	for i := range code {
+		code[i] = referenceCodeAlphabet[int(sum[i])%len(referenceCodeAlphabet)]
+	}
+	return string(code)
+}
+
+// spokenCode spaces out a code so Alexa reads it one character at a time
+func spokenCode(code string) string {
+	return strings.Join(strings.Split(code, ""), " ")
+}
+
+// humanizeDuration renders a number of minutes the way Alexa should say it
+func humanizeDuration(totalMins int64) string {
+	if totalMins < 1 {
+		return "less than a minute"
+	}
+
+	hours := totalMins / 60
+	mins := totalMins % 60
+
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s", unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+
+	switch {
+	case hours == 0:
+		return plural(mins, "minute")
+	case mins == 0:
+		return plural(hours, "hour")
+	default:
+		return fmt.Sprintf("%s and %s", plural(hours, "hour"), plural(mins, "minute"))
+	}
+}
+
+// spokenTime renders a timestamp in the local timezone, e.g. "8 AM" or
+// "Tuesday at 3:15 PM" when it isn't today
+func spokenTime(t time.Time) string {
+	local := t.In(localTimezone)
+	current := now().In(localTimezone)
+
+	clock := local.Format("3:04 PM")
+	if local.Minute() == 0 {
+		clock = local.Format("3 PM")
+	}
+
+	if local.YearDay() == current.YearDay() && local.Year() == current.Year() {
+		return clock
+	}
+	if current.Sub(local) < 7*24*time.Hour {
+		return fmt.Sprintf("%s at %s", local.Weekday(), clock)
+	}
+	return fmt.Sprintf("%s at %s", local.Format("January 2"), clock)
+}
+
+// Logging helpers
+
+// logf prints a log line, redacting Alexa identifiers when LOG_REDACT is set
+func logf(format string, args ...interface{}) {
+	fmt.Print(redactLog(fmt.Sprintf(format, args...)))
+}
+
+// logRequest dumps the session identifiers and the full request payload
+func logRequest(request AlexaRequest) {
+	logf("Session: id=%s new=%v user=%s application=%s\n",
+		redactID(request.Session.SessionID),
+		request.Session.New,
+		redactID(request.Session.User.UserID),
+		request.Session.Application.ApplicationID)
+
+	payload, err := json.Marshal(request)
+	if err != nil {
+		fmt.Printf("Error marshaling request for logging: %v\n", err)
+		return
+	}
+	logf("Request payload: %s\n", payload)
+}
+
+// redactLog replaces every Alexa identifier in s with a short hash
+func redactLog(s string) string {
+	if !logRedact {
+		return s
+	}
+	s = accessTokenPattern.ReplaceAllString(s, `"$1":"redacted"`)
+	return alexaIdentifierPattern.ReplaceAllStringFunc(s, redactID)
+}
+
+// redactID hashes a single identifier so log lines stay correlatable
+// without exposing the raw value
+func redactID(id string) string {
+	if !logRedact || id == "" {
+		return id
+	}
+	sum := sha256.Sum256([]byte(id))
+	return "redacted:" + hex.EncodeToString(sum[:6])
+}
+
 // Particle Cloud API functions
-func callParticleFunction(functionName, arg string) (bool, error) {
+func callParticleFunction(ctx context.Context, deviceID, functionName, arg string) (bool, error) {
+	ctx, end := startSpan(ctx, "particle."+functionName)
+	defer end()
+
 	url := fmt.Sprintf("%s/devices/%s/%s",
 		particleAPIBase,
-		particleDeviceID,
+		deviceID,
 		functionName,
 	)
 
@@ -280,7 +1729,7 @@ func callParticleFunction(functionName, arg string) (bool, error) {
 		return false, fmt.Errorf("error marshaling request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return false, fmt.Errorf("error creating request: %w", err)
 	}
@@ -288,8 +1737,7 @@ func callParticleFunction(functionName, arg string) (bool, error) {
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", particleAccessToken))
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return false, fmt.Errorf("error making request: %w", err)
 	}
@@ -309,6 +1757,10 @@ func callParticleFunction(functionName, arg string) (bool, error) {
 		return false, fmt.Errorf("error unmarshaling response: %w", err)
 	}
 
+	if funcResp.Error != "" {
+		return false, fmt.Errorf("%w: %s", errDeviceNotResponding, funcResp.Error)
+	}
+
 	fmt.Printf("Particle function response: return_value=%d, connected=%v\n",
 		funcResp.ReturnValue, funcResp.Connected)
 
@@ -316,15 +1768,23 @@ func callParticleFunction(functionName, arg string) (bool, error) {
 	return funcResp.ReturnValue == 1, nil
 }
 
-func getParticleVariable(variableName string) (string, error) {
+func getParticleVariable(ctx context.Context, deviceID, variableName string) (string, error) {
+	ctx, end := startSpan(ctx, "particle."+variableName)
+	defer end()
+
 	url := fmt.Sprintf("%s/devices/%s/%s?access_token=%s",
 		particleAPIBase,
-		particleDeviceID,
+		deviceID,
 		variableName,
 		particleAccessToken,
 	)
 
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("error making request: %w", err)
 	}
@@ -340,33 +1800,99 @@ func getParticleVariable(variableName string) (string, error) {
 	}
 
 	var result struct {
-		Result string `json:"result"`
+		Result json.RawMessage `json:"result"`
+		Error  string          `json:"error,omitempty"`
 	}
 	if err := json.Unmarshal(body, &result); err != nil {
 		return "", fmt.Errorf("error unmarshaling response: %w", err)
 	}
 
-	return result.Result, nil
+	if result.Error != "" {
+		return "", fmt.Errorf("%w: %s", errDeviceNotResponding, result.Error)
+	}
+
+	return variableResultString(result.Result), nil
+}
+
+// variableResultString renders a variable's result as text; Particle returns
+// strings quoted and numbers and booleans bare
+func variableResultString(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	return string(raw)
+}
+
+// warmParticleConnection primes the shared client's connection pool and TLS
+// session with a lightweight device info request. Best-effort: failures are
+// only logged.
+func warmParticleConnection(ctx context.Context) {
+	// Keep this short - in init() it counts against the cold start
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := getDeviceInfo(ctx, defaultDeviceID()); err != nil {
+		fmt.Printf("Particle warm-up failed (ignored): %v\n", err)
+		return
+	}
+	fmt.Printf("Particle connection warmed in %v\n", time.Since(start))
+}
+
+// getDeviceInfo fetches the device record, including connection timestamps
+func getDeviceInfo(ctx context.Context, deviceID string) (*ParticleDeviceInfo, error) {
+	ctx, end := startSpan(ctx, "particle.deviceInfo")
+	defer end()
+
+	url := fmt.Sprintf("%s/devices/%s", particleAPIBase, deviceID)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", particleAccessToken))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("particle API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var info ParticleDeviceInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("error unmarshaling response: %w", err)
+	}
+
+	return &info, nil
 }
 
 // DynamoDB helper functions
 
 // getDoorState retrieves the current state from DynamoDB
-func getDoorState() (*DoorState, error) {
+func getDoorState(ctx context.Context, deviceID string) (*DoorState, error) {
 	if doorStateTable == "" {
 		return nil, fmt.Errorf("DOOR_STATE_TABLE not configured")
 	}
 
-	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+	result, err := dynamoClient.GetItemWithContext(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(doorStateTable),
-		Key: map[string]*dynamodb.AttributeValue{
-			"deviceId": {
-				S: aws.String(particleDeviceID),
-			},
-		},
+		Key:       stateKey(deviceID),
 	})
 
 	if err != nil {
+		if state, ok := throttledFallbackState(deviceID, err); ok {
+			return state, nil
+		}
 		return nil, fmt.Errorf("error getting item from DynamoDB: %w", err)
 	}
 
@@ -375,50 +1901,108 @@ func getDoorState() (*DoorState, error) {
 	}
 
 	var state DoorState
-	err = dynamodbattribute.UnmarshalMap(result.Item, &state)
+	err = unmarshalStateItem(result.Item, &state)
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshaling state: %w", err)
 	}
+	applyStateDefaults(&state)
+	rememberFriendlyName(deviceID, state.FriendlyName)
+	lastDoorStates.Store(deviceID, storedDoorState{state: state, readAt: time.Now()})
 
 	return &state, nil
 }
 
+// lastDoorStates holds each device's last state read in this container, to
+// answer from while DynamoDB is throttling
+var lastDoorStates sync.Map // Device ID to storedDoorState
+
+type storedDoorState struct {
+	state  DoorState
+	readAt time.Time
+}
+
+// throttledStateMaxAge is how stale a remembered state may be to stand in
+// for a throttled read
+const throttledStateMaxAge = 10 * time.Minute
+
+// throttledFallbackState returns a copy of the last state read for the
+// device if err is throttling and that state is recent enough
+func throttledFallbackState(deviceID string, err error) (*DoorState, bool) {
+	if !isThrottled(err) {
+		return nil, false
+	}
+	value, ok := lastDoorStates.Load(deviceID)
+	if !ok {
+		return nil, false
+	}
+	stored := value.(storedDoorState)
+	if time.Since(stored.readAt) > throttledStateMaxAge {
+		return nil, false
+	}
+
+	fmt.Printf("DynamoDB is throttling - using state read %s ago\n", time.Since(stored.readAt).Round(time.Second))
+	state := stored.state
+	return &state, true
+}
+
+// stateSchemaVersion is the DoorState layout this code writes
+const stateSchemaVersion = 1
+
+// applyStateDefaults fills in fields that items written before they existed
+// lack, so a missing threshold reads as the configured default rather than
+// zero ("alert immediately")
+func applyStateDefaults(state *DoorState) {
+	if state.SchemaVersion >= stateSchemaVersion {
+		return
+	}
+	if state.AlertThresholdMins <= 0 {
+		state.AlertThresholdMins = thresholdMinutes
+	}
+	state.SchemaVersion = stateSchemaVersion
+}
+
 // updateButtonPress updates DynamoDB with the time the button was pressed
-func updateButtonPress() error {
+func updateButtonPress(ctx context.Context, deviceID string) error {
 	if doorStateTable == "" {
 		return nil // Skip if table not configured
 	}
 
-	currentTime := time.Now().Unix()
+	currentTime := now().Unix()
 
 	// Get existing state
-	state, err := getDoorState()
+	state, err := getDoorState(ctx, deviceID)
 	if err != nil {
 		fmt.Printf("Error getting existing state: %v\n", err)
 		state = &DoorState{
-			DeviceID: particleDeviceID,
+			DeviceID: deviceID,
 			Status:   "unknown",
 		}
 	}
 
 	if state == nil {
 		state = &DoorState{
-			DeviceID: particleDeviceID,
+			DeviceID: deviceID,
 			Status:   "unknown",
 		}
 	}
 
-	// Update with button press time
+	// Update with button press time; a press that worked ends any run of
+	// already-active results
 	state.LastButtonPress = currentTime
 	state.LastChecked = currentTime
+	state.RelayAlreadyActiveCount = 0
+	if assumeFromPresses {
+		state.AssumedStatus = nextAssumedStatus(state)
+		fmt.Printf("Assumed status after press: %s\n", state.AssumedStatus)
+	}
 
 	// Save to DynamoDB
-	item, err := dynamodbattribute.MarshalMap(state)
+	item, err := marshalStateItem(state)
 	if err != nil {
 		return fmt.Errorf("error marshaling state: %w", err)
 	}
 
-	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+	_, err = dynamoClient.PutItemWithContext(ctx, &dynamodb.PutItemInput{
 		TableName: aws.String(doorStateTable),
 		Item:      item,
 	})
@@ -431,61 +2015,180 @@ func updateButtonPress() error {
 	return nil
 }
 
-// updateDoorStatus updates DynamoDB with the current door status
-func updateDoorStatus(status string) error {
+// deleteDoorState removes a device's door state item. The next read or
+// check starts it afresh.
+func deleteDoorState(ctx context.Context, deviceID string) error {
 	if doorStateTable == "" {
-		return nil // Skip if table not configured
+		return fmt.Errorf("DOOR_STATE_TABLE not configured")
+	}
+
+	_, err := dynamoClient.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(doorStateTable),
+		Key:       stateKey(deviceID),
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting item from DynamoDB: %w", err)
+	}
+	return nil
+}
+
+// snoozeReminders marks the current open-door alert as sent and suppresses
+// further alerts until the snooze window ends
+func snoozeReminders(ctx context.Context, deviceID string, state *DoorState, until time.Time) error {
+	if doorStateTable == "" {
+		return fmt.Errorf("door state table not configured")
+	}
+
+	if state == nil {
+		state = &DoorState{
+			DeviceID: deviceID,
+			Status:   "unknown",
+		}
+	}
+
+	state.NotificationSent = true
+	state.SnoozeUntil = until.Unix()
+
+	if err := saveDoorState(ctx, state); err != nil {
+		return err
+	}
+
+	fmt.Printf("Reminders snoozed until %s\n", until.In(localTimezone).Format(time.RFC3339))
+	return nil
+}
+
+// delayAlert holds off the open-door alert until the given time, for the
+// current open session only
+func delayAlert(ctx context.Context, state *DoorState, until time.Time) error {
+	if doorStateTable == "" {
+		return fmt.Errorf("door state table not configured")
+	}
+
+	state.SuppressAlertUntil = until.Unix()
+	if err := saveDoorState(ctx, state); err != nil {
+		return err
+	}
+
+	fmt.Printf("Alert delayed until %d\n", state.SuppressAlertUntil)
+	return nil
+}
+
+// saveDoorState writes a whole state item
+func saveDoorState(ctx context.Context, state *DoorState) error {
+	item, err := marshalStateItem(state)
+	if err != nil {
+		return fmt.Errorf("error marshaling state: %w", err)
+	}
+
+	_, err = dynamoClient.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(doorStateTable),
+		Item:      item,
+	})
+
+	if err != nil {
+		return fmt.Errorf("error putting item to DynamoDB: %w", err)
+	}
+
+	return nil
+}
+
+// updateDoorStatus records a status just read from the sensor
+func updateDoorStatus(ctx context.Context, deviceID, status string) error {
+	_, err := saveDoorStatus(ctx, deviceID, status, now(), false)
+	return err
+}
+
+// saveDoorStatus records a status observed at a given time. Pushed statuses
+// also set PushedAt, and one older than the last push is ignored, since
+// webhooks can arrive out of order. Returns whether the status was applied.
+func saveDoorStatus(ctx context.Context, deviceID, status string, at time.Time, pushed bool) (bool, error) {
+	if doorStateTable == "" {
+		return true, nil // Skip if table not configured
 	}
 
-	currentTime := time.Now().Unix()
+	currentTime := at.Unix()
 
 	// Get existing state
-	state, err := getDoorState()
+	state, err := getDoorState(ctx, deviceID)
 	if err != nil {
 		fmt.Printf("Error getting existing state: %v\n", err)
 		state = &DoorState{
-			DeviceID: particleDeviceID,
+			DeviceID: deviceID,
 		}
 	}
 
 	if state == nil {
 		state = &DoorState{
-			DeviceID: particleDeviceID,
+			DeviceID: deviceID,
+		}
+	}
+
+	if pushed {
+		if state.PushedAt > currentTime {
+			fmt.Printf("Ignoring pushed status from %d, older than the last push at %d\n", currentTime, state.PushedAt)
+			return false, nil
 		}
+		state.PushedAt = currentTime
 	}
 
 	previousStatus := state.Status
 	state.Status = status
 	state.LastChecked = currentTime
+	if status != "unknown" && status != "" {
+		state.AssumedStatus = "" // A real reading replaces any guess
+	}
+
+	if eventLogRecovered {
+		state.EventLogGapSince = 0
+	}
 
 	// Track state changes
 	if status != previousStatus {
 		fmt.Printf("Status changed: %s -> %s\n", previousStatus, status)
+		if shouldNotify(ctx, state, status, currentTime) {
+			recordDoorEvent(ctx, state, previousStatus, status, currentTime)
+			publishTransition(ctx, deviceID, previousStatus, status, currentTime)
+		}
 
 		if status == "open" {
 			state.LastOpenedTime = currentTime
 			state.NotificationSent = false
+			state.AwayAlertSent = false
+			state.AllClearPending = false
+			state.OpenAnnounced = false
+			state.AlertSeverity = ""
 		} else if status == "closed" {
 			state.LastClosedTime = currentTime
+			state.AllClearPending = state.NotificationSent || len(state.RecipientsNotified) > 0
 			state.NotificationSent = false
+			state.SnoozeUntil = 0
+			state.SuppressAlertUntil = 0
+			state.CloseLinkNonce = ""
+			state.AutoCloseAttempts = 0
+			state.LastAutoCloseAttempt = 0
+			state.ManualInterventionNeeded = false
+			state.ObstructionAlertSent = false
+			state.AutoCloseDeferredSince = 0
+			state.AwayAlertSent = false
+			state.AlertSeverity = ""
 		}
 	}
 
 	// Save to DynamoDB
-	item, err := dynamodbattribute.MarshalMap(state)
+	item, err := marshalStateItem(state)
 	if err != nil {
-		return fmt.Errorf("error marshaling state: %w", err)
+		return false, fmt.Errorf("error marshaling state: %w", err)
 	}
 
-	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+	_, err = dynamoClient.PutItemWithContext(ctx, &dynamodb.PutItemInput{
 		TableName: aws.String(doorStateTable),
 		Item:      item,
 	})
 
 	if err != nil {
-		return fmt.Errorf("error putting item to DynamoDB: %w", err)
+		return false, fmt.Errorf("error putting item to DynamoDB: %w", err)
 	}
 
 	fmt.Printf("Door status updated in DynamoDB: %s\n", status)
-	return nil
+	return true, nil
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// obstructionVariable is the cloud variable the opener reports an
+// obstruction on, from OBSTRUCTION_VAR (default "obstructed"). It is read
+// opportunistically: devices whose firmware doesn't have it are remembered
+// and not asked again in this container.
+var (
+	obstructionVariable string
+	obstructionMissing  sync.Map // Device ID to true once the variable 404s
+)
+
+// doorObstructed reports whether the opener says something is in the way.
+// Any error counts as no obstruction.
+func doorObstructed(ctx context.Context, deviceID string) bool {
+	if obstructionVariable == "" {
+		return false
+	}
+	if _, missing := obstructionMissing.Load(deviceID); missing {
+		return false
+	}
+
+	value, err := getParticleVariable(ctx, deviceID, obstructionVariable)
+	if err != nil {
+		if strings.Contains(err.Error(), "status 404") {
+			fmt.Printf("%s not found on %s - not checking for obstructions\n", obstructionVariable, deviceID)
+			obstructionMissing.Store(deviceID, true)
+			return false
+		}
+		fmt.Printf("Error reading %s (ignored): %v\n", obstructionVariable, err)
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "1", "yes", "obstructed":
+		return true
+	default:
+		return false
+	}
+}
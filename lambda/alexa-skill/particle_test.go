@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeParticle points the Particle client at a test server for the length of
+// the test. The breaker is turned off so error statuses don't trip it for
+// later tests.
+func fakeParticle(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+
+	base, token, threshold := particleAPIBase, particleAccessToken, particleBreaker.threshold
+	particleAPIBase, particleAccessToken, particleBreaker.threshold = server.URL, "test-token", 0
+	t.Cleanup(func() {
+		server.Close()
+		particleAPIBase, particleAccessToken, particleBreaker.threshold = base, token, threshold
+	})
+}
+
+func TestCallParticleFunctionRequest(t *testing.T) {
+	var method, path, auth, contentType string
+	var body ParticleFunctionRequest
+	fakeParticle(t, func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		auth, contentType = r.Header.Get("Authorization"), r.Header.Get("Content-Type")
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("request body is not JSON: %v", err)
+		}
+		io.WriteString(w, `{"id":"dev1","connected":true,"return_value":1}`)
+	})
+
+	if _, err := callParticleFunction(context.Background(), "dev1", "pressButton", "hold=500"); err != nil {
+		t.Fatalf("callParticleFunction: %v", err)
+	}
+	if method != http.MethodPost {
+		t.Errorf("method = %s, want POST", method)
+	}
+	if path != "/devices/dev1/pressButton" {
+		t.Errorf("path = %s, want /devices/dev1/pressButton", path)
+	}
+	if auth != "Bearer test-token" {
+		t.Errorf("Authorization = %q, want the bearer token", auth)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+	if body.Arg != "hold=500" {
+		t.Errorf("arg = %q, want hold=500", body.Arg)
+	}
+}
+
+func TestCallParticleFunctionResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    bool
+		wantErr string
+		notResp bool // The error should be errDeviceNotResponding
+	}{
+		{name: "pressed", status: 200, body: `{"return_value":1,"connected":true}`, want: true},
+		{name: "already active", status: 200, body: `{"return_value":0,"connected":true}`, want: false},
+		{name: "device offline", status: 200, body: `{"error":"Timed out."}`, notResp: true},
+		{name: "bad token", status: 401, body: `{"error":"invalid_token"}`, wantErr: "status 401"},
+		{name: "unknown device", status: 404, body: `{"error":"Permission denied"}`, wantErr: "status 404"},
+		{name: "server error", status: 500, body: `oops`, wantErr: "status 500"},
+		{name: "not JSON", status: 200, body: `<html>`, wantErr: "unmarshaling"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeParticle(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			})
+
+			got, err := callParticleFunction(context.Background(), "dev1", "pressButton", "")
+			switch {
+			case tt.notResp:
+				if !errors.Is(err, errDeviceNotResponding) {
+					t.Fatalf("err = %v, want errDeviceNotResponding", err)
+				}
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("callParticleFunction: %v", err)
+			case got != tt.want:
+				t.Errorf("success = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetParticleVariable(t *testing.T) {
+	var method, path, token string
+	fakeParticle(t, func(w http.ResponseWriter, r *http.Request) {
+		method, path, token = r.Method, r.URL.Path, r.URL.Query().Get("access_token")
+		io.WriteString(w, `{"name":"doorStatus","result":"open"}`)
+	})
+
+	got, err := getParticleVariable(context.Background(), "dev1", "doorStatus")
+	if err != nil {
+		t.Fatalf("getParticleVariable: %v", err)
+	}
+	if got != "open" {
+		t.Errorf("result = %q, want open", got)
+	}
+	if method != http.MethodGet || path != "/devices/dev1/doorStatus" {
+		t.Errorf("request = %s %s, want GET /devices/dev1/doorStatus", method, path)
+	}
+	if token != "test-token" {
+		t.Errorf("access_token = %q, want the token", token)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import "fmt"
+
+// notificationPermission is the scope that lets the skill send Alexa
+// notifications, declared in the skill manifest
+const notificationPermission = "alexa::devices:all:notifications:write"
+
+// UserPermissions is what the user has granted the skill. Scopes lists each
+// permission's status; older requests only carry the consent token.
+type UserPermissions struct {
+	ConsentToken string `json:"consentToken,omitempty"`
+	Scopes       map[string]struct {
+		Status string `json:"status"` // GRANTED or DENIED
+	} `json:"scopes,omitempty"`
+}
+
+// hasPermission reports whether the user has granted scope
+func hasPermission(request AlexaRequest, scope string) bool {
+	permissions := request.Context.System.User.Permissions
+	if permissions == nil {
+		return false
+	}
+	if grant, ok := permissions.Scopes[scope]; ok {
+		return grant.Status == "GRANTED"
+	}
+	return len(permissions.Scopes) == 0 && permissions.ConsentToken != ""
+}
+
+// handleEnableNotifications sends the card that asks for notification
+// permission, unless it has already been granted
+func handleEnableNotifications(request AlexaRequest) (AlexaResponse, error) {
+	if hasPermission(request, notificationPermission) {
+		return buildResponse("Alexa notifications are already turned on for this skill.", true), nil
+	}
+
+	fmt.Printf("Asking %s for notification permission\n", redactID(request.Session.User.UserID))
+	response := buildResponse("To get garage door notifications on your Alexa devices, please allow notifications. I've sent a card to the Alexa app to help you do that.", true)
+	response.Response.Card = &Card{
+		Type:        "AskForPermissionsConsent",
+		Permissions: []string{notificationPermission},
+	}
+	return response, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// Some firmware returns the same value from pressButton whether or not the
+// relay fired, so it can't say whether a press worked or the relay was
+// already active. With DETECT_SUCCESS_BY_STATUS=true the return value is
+// ignored: the skill reads the status before pressing, waits
+// VERIFY_DELAY_SECONDS, reads it again and only counts the press if the
+// status changed.
+var detectSuccessByStatus bool
+
+// confirmPressByStatus decides whether a press worked from the door's status
+// before and after it
+func confirmPressByStatus(ctx context.Context, deviceID, before string) AlexaResponse {
+	name := spokenName(deviceID)
+
+	// The door may be about to move, so any cached status is stale
+	if statusCache != nil {
+		statusCache.For(deviceID).Invalidate()
+	}
+	invalidateResponses(deviceID)
+
+	reading, err := statusAfterPress(ctx, deviceID)
+	if err != nil {
+		noteSummary(ctx, func(s *RequestSummary) { s.Action = "press_unconfirmed" })
+		return buildResponse(fmt.Sprintf("I pressed the button, but I couldn't check whether %s moved.", name), true)
+	}
+
+	switch reading.Status {
+	case before:
+		fmt.Printf("Status still %s after the press - not counting it\n", before)
+		noteSummary(ctx, func(s *RequestSummary) { s.Action = "press_unconfirmed" })
+		return buildResponse(fmt.Sprintf("I pressed the button, but %s didn't move. It still reports %s.", name, reading.describe()), true)
+	case "unknown", "":
+		noteSummary(ctx, func(s *RequestSummary) { s.Action = "press_unconfirmed" })
+		return buildResponse(pressOutcomeSpeech(name, before, reading), true)
+	}
+
+	noteSummary(ctx, func(s *RequestSummary) { s.Action = "pressed" })
+	if err := updateButtonPress(ctx, deviceID); err != nil {
+		fmt.Printf("Error updating button press in DynamoDB: %v\n", err)
+	}
+	return buildResponse(pressOutcomeSpeech(name, before, reading), true)
+}
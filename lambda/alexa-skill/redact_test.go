@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureOutput returns what run prints to stdout
+func captureOutput(t *testing.T, run func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe: %v", err)
+	}
+	saved := os.Stdout
+	os.Stdout = w
+	done := make(chan string)
+	go func() {
+		var out bytes.Buffer
+		io.Copy(&out, r)
+		done <- out.String()
+	}()
+
+	run()
+	os.Stdout = saved
+	w.Close()
+	return <-done
+}
+
+// TestLogsRedactUserID sends requests while DynamoDB is failing, from a user
+// without access and from one whose last door can't be loaded, so the
+// request dumps, the refusal and the error are all logged. None of those
+// lines may have a raw userId.
+func TestLogsRedactUserID(t *testing.T) {
+	const owner, stranger = "amzn1.ask.account.AGF7EXAMPLEOWNER", "amzn1.ask.account.AGF7EXAMPLESTRANGER"
+	useDevices(t, nil)
+	fakeDynamo(t, func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"__type":"InternalServerError","message":"test failure"}`)
+	})
+
+	savedRedact, savedVerbose, savedAccess, savedLastDoor := logRedact, logVerbose, userAccess, defaultToLastDoor
+	logRedact, logVerbose, userAccess, defaultToLastDoor = true, true, map[string][]string{owner: {"*"}}, true
+	defer func() {
+		logRedact, logVerbose, userAccess, defaultToLastDoor = savedRedact, savedVerbose, savedAccess, savedLastDoor
+	}()
+
+	out := captureOutput(t, func() {
+		for _, userID := range []string{stranger, owner} {
+			request := localeRequest("GetStatusIntent", "en-US")
+			request.Session.New = true
+			request.Session.SessionID = "amzn1.echo-api.session.EXAMPLESESSION"
+			request.Session.User.UserID = userID
+			if userID == stranger {
+				request.Request.Intent.Slots = map[string]Slot{"Door": {Name: "Door", Value: "garage"}}
+			}
+			if _, err := HandleRequest(context.Background(), request); err != nil {
+				t.Errorf("HandleRequest: %v", err)
+			}
+		}
+	})
+	for _, want := range []string{"Request payload", "is not allowed", "Error loading preferences"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("log is missing %q:\n%s", want, out)
+		}
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.Contains(line, owner) || strings.Contains(line, stranger) {
+			t.Errorf("log line has a raw userId: %s", line)
+		}
+	}
+	if !strings.Contains(out, redactID(owner)) || !strings.Contains(out, redactID(stranger)) {
+		t.Errorf("log doesn't name the users by their hashes:\n%s", out)
+	}
+}
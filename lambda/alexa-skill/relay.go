@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+// The relay function returns 0 when a pulse is already in progress. That
+// should clear within a second, so several in a row across invocations means
+// the relay or firmware is stuck. The run is counted on DoorState and reset
+// by the next successful press.
+var (
+	stuckRelayThreshold int64
+	stuckRelayTopicARN  string
+	snsClient           *sns.SNS
+)
+
+// A second press that lands while the first is still pulsing, e.g. from
+// asking twice in quick succession, gets the same already-active result.
+// Within RELAY_ACTIVE_GRACE_SECONDS of a press that worked it is answered
+// with RELAY_ACTIVE_MESSAGE and isn't counted towards a stuck relay.
+var (
+	relayActiveGrace   time.Duration
+	relayActiveMessage string // {name} is replaced with the door's spoken name
+)
+
+// recentlyPressed reports whether the device's last successful press was
+// within the grace period
+func recentlyPressed(ctx context.Context, deviceID string) bool {
+	if relayActiveGrace <= 0 {
+		return false
+	}
+	state, err := getDoorState(ctx, deviceID)
+	if err != nil || state == nil || state.LastButtonPress == 0 {
+		return false
+	}
+	return now().Sub(time.Unix(state.LastButtonPress, 0)) <= relayActiveGrace
+}
+
+// recordRelayAlreadyActive adds one to the device's run of already-active
+// results and returns the new length of the run
+func recordRelayAlreadyActive(ctx context.Context, deviceID string) (int64, error) {
+	if doorStateTable == "" {
+		return 0, nil
+	}
+
+	result, err := dynamoClient.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(doorStateTable),
+		Key:              stateKey(deviceID),
+		UpdateExpression: aws.String("ADD relayAlreadyActiveCount :one"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":one": {N: aws.String("1")},
+		},
+		ReturnValues: aws.String(dynamodb.ReturnValueUpdatedNew),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error updating item in DynamoDB: %w", err)
+	}
+
+	count, err := strconv.ParseInt(aws.StringValue(result.Attributes["relayAlreadyActiveCount"].N), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing relayAlreadyActiveCount: %w", err)
+	}
+	return count, nil
+}
+
+// relayAlreadyActiveSpeech responds to an already-active result, escalating
+// once the run reaches STUCK_RELAY_THRESHOLD. One right after a press is
+// just a double trigger.
+func relayAlreadyActiveSpeech(ctx context.Context, deviceID string) string {
+	name := spokenName(deviceID)
+
+	if recentlyPressed(ctx, deviceID) {
+		fmt.Printf("Relay for %s still active from a press within %s - not counting it\n", deviceID, relayActiveGrace)
+		noteSummary(ctx, func(s *RequestSummary) { s.Action = "double_trigger" })
+		return strings.ReplaceAll(relayActiveMessage, "{name}", name)
+	}
+
+	count, err := recordRelayAlreadyActive(ctx, deviceID)
+	if err != nil {
+		fmt.Printf("Error recording already-active relay: %v\n", err)
+	}
+	if stuckRelayThreshold <= 0 || count < stuckRelayThreshold {
+		return fmt.Sprintf("%s button is already active. Please wait and try again.", capitalize(name))
+	}
+
+	fmt.Printf("Relay for %s reported already active %d times in a row\n", deviceID, count)
+	// Only notify as the threshold is crossed, not on every press after it
+	if count == stuckRelayThreshold {
+		notifyStuckRelay(ctx, deviceID, count)
+	}
+	return fmt.Sprintf("The relay for %s seems to be stuck on. Please check the hardware.", name)
+}
+
+// notifyStuckRelay sends an ops notification about a stuck relay, when
+// STUCK_RELAY_TOPIC_ARN is set. Best-effort: failures are only logged.
+func notifyStuckRelay(ctx context.Context, deviceID string, count int64) {
+	if stuckRelayTopicARN == "" {
+		return
+	}
+
+	message := fmt.Sprintf(" GARAGE DOOR RELAY STUCK\n\nThe opener for %s has reported its button as already active %d times in a row. The relay may be stuck on or the firmware may have hung. Please check the hardware.\n\nTime: %s",
+		spokenName(deviceID), count, now().In(localTimezone).Format("2006-01-02 15:04:05 MST"))
+	_, err := snsClient.PublishWithContext(ctx, &sns.PublishInput{
+		TopicArn: aws.String(stuckRelayTopicARN),
+		Subject:  aws.String("Garage Door Relay Stuck"),
+		Message:  aws.String(message),
+	})
+	if err != nil {
+		fmt.Printf("Error publishing stuck relay notification: %v\n", err)
+		return
+	}
+	noteSummary(ctx, func(s *RequestSummary) { s.Notified = true })
+}
+
+// defaultRelayHold is the pulse length assumed when the firmware doesn't
+// report relayHoldMs
+const defaultRelayHold = time.Second
+
+// relayHolds caches each device's relayHoldMs. It only changes when new
+// firmware is flashed, so it is kept for an hour.
+var relayHolds = newKeyedCache[string, time.Duration](time.Hour)
+
+// relayHold is how long the device holds the relay for a press. A missing
+// or unusable variable is cached as the default so it isn't asked for on
+// every press; other errors fall back without caching.
+func relayHold(ctx context.Context, deviceID string) time.Duration {
+	hold, _, err := relayHolds.For(deviceID).Get(func() (time.Duration, error) {
+		value, err := getParticleVariable(ctx, deviceID, "relayHoldMs")
+		if err != nil {
+			if strings.Contains(err.Error(), "status 404") {
+				fmt.Printf("relayHoldMs not found on %s - assuming %s\n", deviceID, defaultRelayHold)
+				return defaultRelayHold, nil
+			}
+			return 0, err
+		}
+
+		ms, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || ms <= 0 {
+			fmt.Printf("Unusable relayHoldMs %q on %s - assuming %s\n", value, deviceID, defaultRelayHold)
+			return defaultRelayHold, nil
+		}
+		return time.Duration(ms) * time.Millisecond, nil
+	})
+	if err != nil {
+		fmt.Printf("Error reading relayHoldMs (ignored): %v\n", err)
+		return defaultRelayHold
+	}
+	return hold
+}
+
+// spokenHold describes a relay hold, e.g. "one second", "1.5 seconds" or
+// "500 milliseconds"
+func spokenHold(hold time.Duration) string {
+	switch {
+	case hold == time.Second:
+		return "one second"
+	case hold < time.Second:
+		return fmt.Sprintf("%d milliseconds", hold.Milliseconds())
+	default:
+		return strconv.FormatFloat(hold.Seconds(), 'f', -1, 64) + " seconds"
+	}
+}
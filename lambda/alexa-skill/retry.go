@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// Every retry in an invocation, whether the AWS SDK's backoff or one of our
+// own replay loops, draws on one shared budget of RETRY_BUDGET_MS carried in
+// the context. Once it is spent, or a retry would run into the Lambda
+// deadline, calls fail on their first error instead of stacking up retries.
+var retryBudgetTotal time.Duration
+
+// DynamoDB has its own retry settings, since a burst of throttling is its
+// most likely failure: DYNAMODB_MAX_RETRIES and DYNAMODB_MAX_THROTTLE_DELAY_MS
+var (
+	dynamoMaxRetries       int
+	dynamoMaxThrottleDelay time.Duration
+)
+
+// retryDeadlineMargin is left before the invocation deadline for the
+// response, so a retry never starts closer to it than this
+const retryDeadlineMargin = time.Second
+
+type retryBudgetKey struct{}
+
+// retryBudget is the retry time left in one invocation
+type retryBudget struct {
+	mu        sync.Mutex
+	remaining time.Duration
+}
+
+// withRetryBudget starts an invocation's retry budget
+func withRetryBudget(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryBudgetKey{}, &retryBudget{remaining: retryBudgetTotal})
+}
+
+// allowRetry reports whether a retry expected to take wait may go ahead,
+// and if so charges it to the budget
+func allowRetry(ctx context.Context, wait time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait+retryDeadlineMargin {
+		return false
+	}
+
+	budget, ok := ctx.Value(retryBudgetKey{}).(*retryBudget)
+	if !ok {
+		// Not started by a handler, e.g. during init
+		return true
+	}
+
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+	if budget.remaining <= 0 || budget.remaining < wait {
+		if budget.remaining > 0 {
+			fmt.Printf("Retry budget exhausted (%s left, retry needs %s)\n", budget.remaining, wait)
+		}
+		budget.remaining = 0
+		return false
+	}
+	budget.remaining -= wait
+	return true
+}
+
+// chargeRetry deducts time spent on a retry that was allowed with an
+// unknown cost
+func chargeRetry(ctx context.Context, spent time.Duration) {
+	budget, ok := ctx.Value(retryBudgetKey{}).(*retryBudget)
+	if !ok {
+		return
+	}
+
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+	budget.remaining -= spent
+}
+
+// budgetRetryer is the SDK's default retryer, limited by the invocation's
+// retry budget. EnforceShouldRetryCheck must be set on the config so
+// ShouldRetry is always consulted.
+type budgetRetryer struct {
+	client.DefaultRetryer
+}
+
+// ShouldRetry declines once the budget can't cover the next backoff
+func (r budgetRetryer) ShouldRetry(req *request.Request) bool {
+	if !r.DefaultRetryer.ShouldRetry(req) {
+		return false
+	}
+	return allowRetry(req.Context(), r.DefaultRetryer.RetryRules(req))
+}
+
+// dynamoRetryConfig gives the DynamoDB client a budget-limited retryer with
+// its own limits. The SDK would otherwise back off for up to 5 minutes when
+// throttled, far longer than an invocation.
+func dynamoRetryConfig() *aws.Config {
+	minThrottleDelay := 100 * time.Millisecond
+	if minThrottleDelay > dynamoMaxThrottleDelay {
+		minThrottleDelay = dynamoMaxThrottleDelay
+	}
+	return request.WithRetryer(aws.NewConfig(), budgetRetryer{client.DefaultRetryer{
+		NumMaxRetries:    dynamoMaxRetries,
+		MinRetryDelay:    50 * time.Millisecond,
+		MinThrottleDelay: minThrottleDelay,
+		MaxThrottleDelay: dynamoMaxThrottleDelay,
+	}})
+}
+
+// isThrottled reports whether err, wrapped or not, is an AWS throttling
+// error such as DynamoDB's ProvisionedThroughputExceededException
+func isThrottled(err error) bool {
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && request.IsErrorThrottle(aerr)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// The response schema in testdata covers the parts of Alexa's response
+// format this skill sends. Every response builder's output is checked
+// against it, so a new response feature can't quietly break the contract.
+
+const responseSchemaFile = "testdata/alexa-response.schema.json"
+
+// loadResponseSchema compiles the response schema
+func loadResponseSchema(t *testing.T) *jsonschema.Schema {
+	t.Helper()
+	raw, err := os.ReadFile(responseSchemaFile)
+	if err != nil {
+		t.Fatalf("reading schema: %v", err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft7
+	if err := compiler.AddResource(responseSchemaFile, bytes.NewReader(raw)); err != nil {
+		t.Fatalf("loading schema: %v", err)
+	}
+	schema, err := compiler.Compile(responseSchemaFile)
+	if err != nil {
+		t.Fatalf("compiling schema: %v", err)
+	}
+	return schema
+}
+
+// validateJSON checks raw JSON against the schema
+func validateJSON(schema *jsonschema.Schema, raw []byte) error {
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return err
+	}
+	return schema.Validate(doc)
+}
+
+func TestResponsesMatchSchema(t *testing.T) {
+	schema := loadResponseSchema(t)
+	loc := localeFor("en-US")
+	intent := Intent{Name: "PressButtonIntent", Slots: map[string]Slot{"Door": {Name: "Door"}}}
+
+	withCard := buildResponse("The garage door is closed right now.", true)
+	withCard.Response.Card = buildStatusCard("The garage door is closed right now.", "closed", loc)
+
+	withImage := buildResponse("The garage door is open right now.", true)
+	withImage.Response.Card = &Card{
+		Type:  cardStyleStandard,
+		Title: loc.CardTitle,
+		Text:  "The garage door is open right now.",
+		Image: &CardImage{SmallImageURL: "https://example.com/open.png", LargeImageURL: "https://example.com/open.png"},
+	}
+
+	withScreen := buildSSMLResponse(ssmlSpeak(ssmlText("The garage door is open right now."), loc.ssmlOpenFor(90)), true)
+	withScreen.Response.Card = buildStatusCard("The garage door is open right now.", "open", loc)
+	withScreen.Response.Directives = []Directive{buildStatusDirective("the garage door", "open", "Open for 1 hour and 30 minutes", loc)}
+
+	withReprompt := buildResponse("Which door?", false)
+	withReprompt.Response.Reprompt = &Reprompt{OutputSpeech: OutputSpeech{Type: "PlainText", Text: "Which door?"}}
+
+	fallbackKeepOpen = true
+	fallback, _ := handleFallback("UnknownIntent")
+	fallbackKeepOpen = false
+
+	enableNotifications, _ := handleEnableNotifications(AlexaRequest{})
+
+	samples := map[string]AlexaResponse{
+		"plain":              buildResponse("Goodbye", true),
+		"open session":       buildResponse("Garage door controller ready.", false),
+		"SSML":               buildSSMLResponse(ssmlSpeak(ssmlText("Open for"), loc.ssmlOpenFor(5)), true),
+		"error":              buildErrorResponse("Sorry, I couldn't get the status of the garage door."),
+		"simple card":        withCard,
+		"standard card":      withImage,
+		"link account card":  buildLinkAccountResponse(),
+		"permissions card":   enableNotifications,
+		"reprompt":           withReprompt,
+		"fallback reprompt":  fallback,
+		"elicit slot":        buildElicitSlotResponse("Which door?", "Door", intent),
+		"confirm intent":     buildConfirmIntentResponse("Do you want me to press the button?", intent),
+		"APL directive":      withScreen,
+		"no speech":          buildEmptyResponse(),
+		"session attributes": {Version: "1.0", Response: ResponseBody{OutputSpeech: &OutputSpeech{Type: "PlainText", Text: "Okay."}}, Session: map[string]string{"door": "garage"}},
+	}
+
+	for name, response := range samples {
+		t.Run(name, func(t *testing.T) {
+			raw, err := json.Marshal(response)
+			if err != nil {
+				t.Fatalf("marshaling: %v", err)
+			}
+			if bytes.Contains(raw, []byte("null")) {
+				t.Errorf("response has a null: %s", raw)
+			}
+			if err := validateJSON(schema, raw); err != nil {
+				t.Errorf("response doesn't match the schema: %v\n%s", err, raw)
+			}
+		})
+	}
+}
+
+// TestSchemaRejectsEmptySpeech is why outputSpeech is a pointer with
+// omitempty. Before, a response with nothing to say, such as the one for an
+// AudioPlayer event, still sent "outputSpeech":{"type":""}, and Alexa
+// rejects a speech object without a valid type. The field must be left out
+// instead.
+func TestSchemaRejectsEmptySpeech(t *testing.T) {
+	schema := loadResponseSchema(t)
+
+	if err := validateJSON(schema, []byte(`{"version":"1.0","response":{"outputSpeech":{"type":""},"shouldEndSession":false}}`)); err == nil {
+		t.Error("schema accepted an outputSpeech with an empty type")
+	}
+
+	raw, err := json.Marshal(buildEmptyResponse())
+	if err != nil {
+		t.Fatalf("marshaling: %v", err)
+	}
+	if strings.Contains(string(raw), "outputSpeech") {
+		t.Errorf("empty response still sends outputSpeech: %s", raw)
+	}
+}
+
+func TestSchemaRejectsBrokenResponses(t *testing.T) {
+	schema := loadResponseSchema(t)
+
+	broken := map[string]string{
+		"missing version":      `{"response":{"shouldEndSession":true}}`,
+		"null speech":          `{"version":"1.0","response":{"outputSpeech":null}}`,
+		"SSML without speak":   `{"version":"1.0","response":{"outputSpeech":{"type":"SSML","ssml":"hello"}}}`,
+		"plain text with SSML": `{"version":"1.0","response":{"outputSpeech":{"type":"PlainText","ssml":"<speak>hi</speak>"}}}`,
+		"simple card image":    `{"version":"1.0","response":{"card":{"type":"Simple","image":{"smallImageUrl":"https://x"}}}}`,
+		"http card image":      `{"version":"1.0","response":{"card":{"type":"Standard","image":{"smallImageUrl":"http://x"}}}}`,
+		"elicit without slot":  `{"version":"1.0","response":{"directives":[{"type":"Dialog.ElicitSlot"}]}}`,
+		"null directives":      `{"version":"1.0","response":{"directives":null}}`,
+		"unknown field":        `{"version":"1.0","response":{"shouldEndSession":true,"speech":"hi"}}`,
+	}
+
+	for name, raw := range broken {
+		t.Run(name, func(t *testing.T) {
+			if err := validateJSON(schema, []byte(raw)); err == nil {
+				t.Errorf("schema accepted %s", raw)
+			}
+		})
+	}
+}
+
+// TestSampleRequestParses keeps test-event.json, used by make local-invoke,
+// readable as a request
+func TestSampleRequestParses(t *testing.T) {
+	raw, err := os.ReadFile("test-event.json")
+	if err != nil {
+		t.Fatalf("reading test-event.json: %v", err)
+	}
+
+	var request AlexaRequest
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	if err := decoder.Decode(&request); err != nil {
+		t.Fatalf("test-event.json doesn't parse: %v", err)
+	}
+	if request.Request.Type == "" {
+		t.Error("test-event.json has no request type")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Slot is one slot of an intent as Alexa sends it. Only the fields the skill
+// reads are modeled; the same struct is echoed back in dialog directives.
+type Slot struct {
+	Name               string           `json:"name"`
+	Value              string           `json:"value,omitempty"`
+	ConfirmationStatus string           `json:"confirmationStatus,omitempty"`
+	Resolutions        *SlotResolutions `json:"resolutions,omitempty"`
+}
+
+// SlotResolutions holds entity resolution results, which map what was said to
+// a slot type value, e.g. a synonym to its canonical door name
+type SlotResolutions struct {
+	ResolutionsPerAuthority []SlotAuthority `json:"resolutionsPerAuthority"`
+}
+
+// SlotAuthority is the resolution result from one source of slot values
+type SlotAuthority struct {
+	Authority string `json:"authority"`
+	Status    struct {
+		Code string `json:"code"` // ER_SUCCESS_MATCH, ER_SUCCESS_NO_MATCH, ...
+	} `json:"status"`
+	Values []struct {
+		Value struct {
+			Name string `json:"name"`
+			ID   string `json:"id"`
+		} `json:"value"`
+	} `json:"values"`
+}
+
+// UnmarshalJSON decodes a slot, keeping what it can from a malformed one
+// rather than failing the whole request
+func (s *Slot) UnmarshalJSON(data []byte) error {
+	type plain Slot
+	var slot plain
+	if err := json.Unmarshal(data, &slot); err == nil {
+		*s = Slot(slot)
+		return nil
+	}
+
+	// Fall back to the fields that matter most, ignoring the rest
+	var partial struct {
+		Name  interface{} `json:"name"`
+		Value interface{} `json:"value"`
+	}
+	if err := json.Unmarshal(data, &partial); err != nil {
+		fmt.Printf("Ignoring unreadable slot: %v\n", err)
+		*s = Slot{}
+		return nil
+	}
+	name, _ := partial.Name.(string)
+	value, _ := partial.Value.(string)
+	fmt.Printf("Slot %q was malformed - using its value only\n", name)
+	*s = Slot{Name: name, Value: value}
+	return nil
+}
+
+// resolvedSlotValue returns a slot's value, preferring the value entity
+// resolution matched it to over the raw words. ok is false if the slot is
+// missing or empty.
+func (i Intent) resolvedSlotValue(name string) (string, bool) {
+	slot, ok := i.Slots[name]
+	if !ok {
+		return "", false
+	}
+
+	if slot.Resolutions != nil {
+		for _, authority := range slot.Resolutions.ResolutionsPerAuthority {
+			if authority.Status.Code != "ER_SUCCESS_MATCH" || len(authority.Values) == 0 {
+				continue
+			}
+			if resolved := authority.Values[0].Value.Name; resolved != "" {
+				return resolved, true
+			}
+		}
+	}
+
+	return slot.Value, slot.Value != ""
+}
+
+// slotValue returns a slot's resolved value, or "" if it is missing
+func slotValue(intent Intent, name string) string {
+	value, _ := intent.resolvedSlotValue(name)
+	return value
+}
+
+// slotInt returns a numeric slot value; ok is false if the slot is missing
+// or not a number
+func slotInt(intent Intent, name string) (int, bool) {
+	value, ok := intent.resolvedSlotValue(name)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// speechLocale holds the wording SSML fragments use in one locale. Numbers
+// are wrapped in say-as cardinal so Alexa reads them in the locale's
+// language rather than guessing from context.
+type speechLocale struct {
+	Hour, Hours        string
+	Minute, Minutes    string
+	OneHour, OneMinute string // Replaces "1 hour"/"1 minute" where grammar needs it, e.g. "einer Stunde"
+	And                string
+	UnderAMinute       string
+	OpenFor            string // Sentence around an open duration, with %s for the duration
+
+	// The rest of a status response: the card title, the screen's line
+	// under the status, with %s for the duration, and the screen's status
+	// labels
+	CardTitle     string
+	ScreenOpenFor string
+	Labels        map[string]string
+
+	// Wording for the other sentences of a status response, for locales
+	// not in English. English locales leave these empty and get the
+	// English text written where each sentence is built.
+	Phrases     map[string]map[verbosity]string // Replaces phrasings, by key
+	Sentences   map[string]string               // Replaces a sentence, by key; see sentence
+	Statuses    map[string]string               // Spoken statuses, e.g. "offen"
+	DefaultDoor string                          // Replaces defaultSpokenName
+	NamedDoor   string                          // A door with a configured or given name, with %s for the name
+}
+
+// speechLocales are the locales with their own wording. Other locales in
+// the same language use the first match by language, then defaultLocale.
+var speechLocales = map[string]speechLocale{
+	"en-US": {
+		Hour: "hour", Hours: "hours", Minute: "minute", Minutes: "minutes",
+		And: "and", UnderAMinute: "less than a minute",
+		OpenFor: "It has been open for %s.",
+
+		CardTitle: "Garage Door Status", ScreenOpenFor: "Open for %s",
+		Labels: map[string]string{"open": "OPEN", "closed": "CLOSED"},
+	},
+	"en-GB": {
+		Hour: "hour", Hours: "hours", Minute: "minute", Minutes: "minutes",
+		And: "and", UnderAMinute: "less than a minute",
+		OpenFor: "It's been open for %s.",
+
+		CardTitle: "Garage Door Status", ScreenOpenFor: "Open for %s",
+		Labels: map[string]string{"open": "OPEN", "closed": "CLOSED"},
+	},
+	"de-DE": {
+		Hour: "Stunde", Hours: "Stunden", Minute: "Minute", Minutes: "Minuten",
+		OneHour: "einer Stunde", OneMinute: "einer Minute",
+		And: "und", UnderAMinute: "weniger als einer Minute",
+		OpenFor: "Es ist seit %s offen.",
+
+		CardTitle: "Garagentor-Status", ScreenOpenFor: "Seit %s offen",
+		Labels: map[string]string{"open": "OFFEN", "closed": "GESCHLOSSEN"},
+
+		Phrases: map[string]map[verbosity]string{
+			"statusLive": {
+				verbosityTerse:  "{Name} ist {status}{obstruction}.",
+				verbosityNormal: "{Name} ist gerade {status}{obstruction}.",
+			},
+			"statusStale": {
+				verbosityTerse:  "{Name} war vor {age} {status}{obstruction}.",
+				verbosityNormal: "{Name} war vor {age} noch {status}{obstruction}.",
+			},
+			"checkedNow": {
+				verbosityTerse:  "",
+				verbosityNormal: "Ich habe gerade nachgesehen.",
+			},
+			"closedFor": {
+				verbosityNormal:  "",
+				verbosityVerbose: "Es ist seit {duration} geschlossen.",
+			},
+		},
+		Sentences: map[string]string{
+			"partlyOpen":          "zu %d Prozent offen",
+			"obstruction":         ", aber es wurde ein Hindernis erkannt",
+			"unreachable":         "Ich kann die Steuerung gerade nicht erreichen. ",
+			"autoCloseNext":       "Es wird bei der nächsten Prüfung automatisch geschlossen.",
+			"autoCloseIn":         "Es wird in %s automatisch geschlossen.",
+			"unknownStatus":       "Ich konnte den Türsensor nicht lesen. Die Steuerung ist vielleicht offline, oder der Sensor ist nicht angeschlossen.",
+			"notResponding":       "Die Steuerung für %s hat nicht geantwortet. Sie ist vielleicht offline oder hat die Verbindung verloren.",
+			"particleUnavailable": "Die Particle-Cloud antwortet gerade nicht, daher kann ich %s nicht erreichen. Bitte versuche es in einer Minute noch einmal.",
+			"statusFailed":        "Entschuldigung, ich konnte nicht abrufen, ob %s offen ist. Bitte versuche es noch einmal.",
+			"assumed":             "Ich nehme an, %s ist %s, nach dem letzten Tastendruck",
+			"assumedAgo":          " vor %s",
+			"assumedCaveat":       ". Ohne Sensor kann ich das nicht sicher sagen, sieh also nach, wenn es wichtig ist.",
+		},
+		Statuses:    map[string]string{"open": "offen", "closed": "geschlossen", "moving": "in Bewegung"},
+		DefaultDoor: "das Garagentor",
+		NamedDoor:   "das Tor %s",
+	},
+}
+
+// defaultLocale is used for locales with no wording of their own
+const defaultLocale = "en-US"
+
+// localeFor picks the wording for a request locale such as "de-AT"
+func localeFor(tag string) speechLocale {
+	if loc, ok := speechLocales[tag]; ok {
+		return loc
+	}
+	language, _, _ := strings.Cut(tag, "-")
+	for _, candidate := range []string{"en-US", "en-GB", "de-DE"} {
+		if strings.HasPrefix(candidate, language+"-") {
+			return speechLocales[candidate]
+		}
+	}
+	return speechLocales[defaultLocale]
+}
+
+// ssmlDuration renders minutes as an SSML fragment, e.g. "2 hours and 15
+// minutes" with each number marked as a cardinal
+func (l speechLocale) ssmlDuration(totalMins int64) string {
+	cardinal := func(n int64) string {
+		return fmt.Sprintf(`<say-as interpret-as="cardinal">%d</say-as>`, n)
+	}
+	return l.duration(totalMins, cardinal, html.EscapeString)
+}
+
+// plainDuration renders minutes as text for cards and screens, worded the
+// same way as the speech
+func (l speechLocale) plainDuration(totalMins int64) string {
+	number := func(n int64) string { return strconv.FormatInt(n, 10) }
+	return l.duration(totalMins, number, func(text string) string { return text })
+}
+
+// duration renders minutes with the locale's words, formatting numbers and
+// words for the output it is going into
+func (l speechLocale) duration(totalMins int64, number func(int64) string, text func(string) string) string {
+	if totalMins < 1 {
+		return text(l.UnderAMinute)
+	}
+
+	hours := totalMins / 60
+	mins := totalMins % 60
+
+	unit := func(n int64, one, singular, plural string) string {
+		if n == 1 && one != "" {
+			return text(one)
+		}
+		word := plural
+		if n == 1 {
+			word = singular
+		}
+		return number(n) + " " + text(word)
+	}
+
+	switch {
+	case hours == 0:
+		return unit(mins, l.OneMinute, l.Minute, l.Minutes)
+	case mins == 0:
+		return unit(hours, l.OneHour, l.Hour, l.Hours)
+	default:
+		return fmt.Sprintf("%s %s %s", unit(hours, l.OneHour, l.Hour, l.Hours), text(l.And), unit(mins, l.OneMinute, l.Minute, l.Minutes))
+	}
+}
+
+// ssmlOpenFor is the sentence saying how long the door has been open
+func (l speechLocale) ssmlOpenFor(totalMins int64) string {
+	return fmt.Sprintf(l.OpenFor, l.ssmlDuration(totalMins))
+}
+
+// openFor is ssmlOpenFor as plain text, for the card
+func (l speechLocale) openFor(totalMins int64) string {
+	return fmt.Sprintf(l.OpenFor, l.plainDuration(totalMins))
+}
+
+// statusLabel is the screen label for a status, upper-cased English for
+// statuses the locale has no label for
+func (l speechLocale) statusLabel(status string) string {
+	if label, ok := l.Labels[status]; ok {
+		return label
+	}
+	return strings.ToUpper(status)
+}
+
+// phrase is the package phrase in the locale's wording, where it has its own
+func (l speechLocale) phrase(key string, vars ...string) string {
+	if levels, ok := l.Phrases[key]; ok {
+		return fillPhrase(levels, vars...)
+	}
+	return phrase(key, vars...)
+}
+
+// sentence returns english, or the locale's own wording for key filled in
+// with args when it has one
+func (l speechLocale) sentence(key, english string, args ...interface{}) string {
+	if format, ok := l.Sentences[key]; ok {
+		return fmt.Sprintf(format, args...)
+	}
+	return english
+}
+
+// describe is statusReading.describe in the locale's words
+func (l speechLocale) describe(r statusReading) string {
+	if r.HasPosition && r.Position > 0 && r.Position < 100 {
+		return l.sentence("partlyOpen", r.describe(), r.Position)
+	}
+	if word, ok := l.Statuses[r.Status]; ok {
+		return word
+	}
+	return r.describe()
+}
+
+// doorName is spokenName in the locale. A name from DEVICE_MAP or
+// RenameDoorIntent is kept as configured, inside the locale's wording.
+func (l speechLocale) doorName(deviceID string) string {
+	name := spokenName(deviceID)
+	switch {
+	case l.DefaultDoor == "":
+		return name
+	case name == defaultSpokenName:
+		return l.DefaultDoor
+	default:
+		return fmt.Sprintf(l.NamedDoor, bareDoorName(name))
+	}
+}
+
+// ssmlSpeak wraps SSML fragments in a speak element, skipping empty ones.
+// Plain text must be escaped with ssmlText first.
+func ssmlSpeak(fragments ...string) string {
+	var parts []string
+	for _, fragment := range fragments {
+		if fragment != "" {
+			parts = append(parts, fragment)
+		}
+	}
+	return "<speak>" + strings.Join(parts, " ") + "</speak>"
+}
+
+// ssmlText escapes plain text for use in SSML
+func ssmlText(text string) string {
+	return html.EscapeString(text)
+}
+
+// appendSpeech adds a plain-text sentence to a response, inside the speak
+// element for SSML responses
+func appendSpeech(speech *OutputSpeech, text string) {
+	if speech.Type == "SSML" {
+		speech.SSML = strings.TrimSuffix(speech.SSML, "</speak>") + " " + ssmlText(text) + "</speak>"
+		return
+	}
+	speech.Text += " " + text
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// TestGetDoorStateCorruptedItem reads items with a hand-edited
+// lastOpenedTime left as a string
+func TestGetDoorStateCorruptedItem(t *testing.T) {
+	current := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	fixClock(t, current)
+	checked := current.Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name       string
+		status     string
+		wantOpened int64
+	}{
+		// The open time is lost, so the open door's clock starts again now
+		{name: "open", status: "open", wantOpened: current.Unix()},
+		// A closed door has no open duration to restart
+		{name: "closed", status: "closed", wantOpened: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeDoorState(t, fmt.Sprintf(`{"deviceId":{"S":"dev1"},"status":{"S":%q},"lastChecked":{"N":"%d"},"lastOpenedTime":{"S":"yesterday"},"notificationSent":{"BOOL":true}}`,
+				tt.status, checked))
+
+			state, err := getDoorState(context.Background(), "dev1")
+			if err != nil {
+				t.Fatalf("getDoorState: %v", err)
+			}
+			if state.DeviceID != "dev1" || state.Status != tt.status || state.LastChecked != checked || !state.NotificationSent {
+				t.Errorf("state = %+v, want the well-formed attributes kept", state)
+			}
+			if state.LastOpenedTime != tt.wantOpened {
+				t.Errorf("LastOpenedTime = %d, want %d", state.LastOpenedTime, tt.wantOpened)
+			}
+		})
+	}
+}
+
+// TestStateKeyNameRoundTrip keeps door state in a table whose partition key
+// is pk, as STATE_KEY_NAME allows
+func TestStateKeyNameRoundTrip(t *testing.T) {
+	saved := stateKeyName
+	stateKeyName = "pk"
+	defer func() { stateKeyName = saved }()
+	fakeDoorTable(t)
+
+	state := &DoorState{DeviceID: "dev1", Status: "open", LastOpenedTime: 1760000000, SchemaVersion: stateSchemaVersion, AlertThresholdMins: 30}
+
+	item, err := marshalStateItem(state)
+	if err != nil {
+		t.Fatalf("marshalStateItem: %v", err)
+	}
+	if _, ok := item["deviceId"]; ok || aws.StringValue(item["pk"].S) != "dev1" {
+		t.Errorf("item = %v, want the device under pk only", item)
+	}
+	if key := stateKey("dev1"); len(key) != 1 || aws.StringValue(key["pk"].S) != "dev1" {
+		t.Errorf("stateKey = %v, want pk", key)
+	}
+
+	var read DoorState
+	if err := unmarshalStateItem(item, &read); err != nil {
+		t.Fatalf("unmarshalStateItem: %v", err)
+	}
+	if !reflect.DeepEqual(read, *state) {
+		t.Errorf("read %+v, want %+v", read, *state)
+	}
+	if _, ok := item["pk"]; !ok {
+		t.Error("unmarshalStateItem changed the item")
+	}
+
+	// And through the table, which finds items by stateKey
+	if err := saveDoorState(context.Background(), state); err != nil {
+		t.Fatalf("saveDoorState: %v", err)
+	}
+	stored, err := getDoorState(context.Background(), "dev1")
+	if err != nil || stored == nil || !reflect.DeepEqual(*stored, *state) {
+		t.Errorf("getDoorState = %+v, %v; want %+v", stored, err, *state)
+	}
+}
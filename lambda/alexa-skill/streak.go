@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Streaks are opt-in: with STREAKS_ENABLED=true, "how many nights in a row
+// have I closed the door" counts back from last night through the events
+// table. A night is good if the door wasn't left open past its alert
+// threshold at any time between OVERNIGHT_START and OVERNIGHT_END, the same
+// night as the monitor's morning report. Nights the history can't account
+// for, such as a missing event, are skipped rather than ending the streak.
+
+var (
+	streaksEnabled bool
+	overnightStart = 22 * 60 // Minutes after local midnight
+	overnightEnd   = 6 * 60
+)
+
+// streakMaxNights is as far back as a streak is counted; events expire
+// after 90 days, so there is nothing older
+const streakMaxNights = 90
+
+// nightResult is how one night went
+type nightResult int
+
+const (
+	nightGood nightResult = iota
+	nightBad
+	nightUnknown
+)
+
+// doorSpan is a stretch of time the door was in one status, as far as the
+// events show. An unknown span is one the events can't account for.
+type doorSpan struct {
+	Status string // "open", "closed" or "unknown"
+	From   time.Time
+	To     time.Time
+	Opened time.Time // For an open span, when that open session began
+}
+
+// handleGetStreak reports how many nights in a row the door has been closed
+func handleGetStreak(ctx context.Context, deviceID string) (AlexaResponse, error) {
+	name := spokenName(deviceID)
+	if !streaksEnabled || eventsTable == "" {
+		return buildResponse("Streaks aren't turned on for this skill.", true), nil
+	}
+
+	current := now()
+	since := current.AddDate(0, 0, -streakMaxNights-1)
+	events, err := queryDoorEvents(ctx, deviceID, since)
+	if err != nil {
+		fmt.Printf("Error getting door events: %v\n", err)
+		return buildErrorResponse("Sorry, I couldn't look up the door's history. Please try again."), nil
+	}
+
+	threshold := time.Duration(thresholdMinutes) * time.Minute
+	state, err := getDoorState(ctx, deviceID)
+	if err != nil {
+		fmt.Printf("Error getting door state: %v\n", err)
+	}
+	if state == nil {
+		state = &DoorState{}
+	}
+	if state.AlertThresholdMins > 0 {
+		threshold = time.Duration(state.AlertThresholdMins) * time.Minute
+	}
+
+	spans := doorSpans(events, state, since, current)
+	streak, skipped, broken := countStreak(spans, threshold, current)
+	fmt.Printf("Streak for %s: %d nights, %d skipped, broken %t\n", deviceID, streak, skipped, broken)
+
+	var speech string
+	switch {
+	case streak == 0 && broken && skipped == 0:
+		speech = fmt.Sprintf("%s was left open last night, so the streak starts again tonight.", capitalize(name))
+	case streak == 0 && broken:
+		speech = fmt.Sprintf("%s was left open recently, so there's no streak yet.", capitalize(name))
+	case streak == 0:
+		speech = fmt.Sprintf("I don't have enough history of %s to count a streak yet.", name)
+	case streak == 1:
+		speech = fmt.Sprintf("You closed %s last night. That's one night in a row.", name)
+	default:
+		speech = fmt.Sprintf("You've closed %s every night for %d days.", name, streak)
+	}
+	if streak > 0 && skipped == 1 {
+		speech += " That doesn't count one night I have no record of."
+	} else if streak > 0 && skipped > 1 {
+		speech += fmt.Sprintf(" That doesn't count %d nights I have no record of.", skipped)
+	}
+	return buildResponse(speech, true), nil
+}
+
+// doorSpans turns events, oldest first, into the door's status over time,
+// from the first event to now. A gap where one event's status doesn't match
+// the next one's previous status means a transition went unrecorded, so that
+// stretch is unknown, as is the time after the last event if the stored
+// status disagrees with it. Without events, a door the stored state shows
+// closed since before since was closed all along.
+func doorSpans(events []DoorEvent, state *DoorState, since, current time.Time) []doorSpan {
+	stored := knownStatus(state.Status)
+	if len(events) == 0 {
+		if stored != "closed" || state.LastClosedTime <= 0 {
+			return nil
+		}
+		from := time.Unix(state.LastClosedTime, 0)
+		if from.Before(since) {
+			from = since
+		}
+		return []doorSpan{{Status: "closed", From: from, To: current}}
+	}
+
+	var spans []doorSpan
+	var opened time.Time
+	add := func(status string, from, to time.Time) {
+		status = knownStatus(status)
+		switch {
+		case status == "open" && opened.IsZero():
+			opened = from
+		case status != "open":
+			opened = time.Time{}
+		}
+		spans = append(spans, doorSpan{Status: status, From: from, To: to, Opened: opened})
+	}
+
+	for i, event := range events {
+		to := current
+		if i+1 < len(events) {
+			to = time.Unix(events[i+1].Timestamp, 0)
+			if next := events[i+1].PreviousStatus; next != "" && next != event.Status {
+				add("unknown", time.Unix(event.Timestamp, 0), to)
+				continue
+			}
+		} else if stored != "unknown" && stored != event.Status {
+			add("unknown", time.Unix(event.Timestamp, 0), to)
+			continue
+		}
+		add(event.Status, time.Unix(event.Timestamp, 0), to)
+	}
+	return spans
+}
+
+// knownStatus keeps open and closed; anything else can't say whether the
+// door was left open
+func knownStatus(status string) string {
+	if status == "open" || status == "closed" {
+		return status
+	}
+	return "unknown"
+}
+
+// countStreak counts good nights back from last night, up to the first bad
+// one. Unknown nights are skipped and counted separately. broken is set if
+// the count stopped at a bad night rather than the start of the history.
+func countStreak(spans []doorSpan, threshold time.Duration, current time.Time) (streak, skipped int, broken bool) {
+	start, end := overnightWindow(current)
+	for night := 0; night < streakMaxNights; night++ {
+		if len(spans) == 0 || !spans[0].From.Before(start) {
+			// Before the history starts
+			break
+		}
+		switch judgeNight(spans, start, end, threshold) {
+		case nightBad:
+			return streak, skipped, true
+		case nightUnknown:
+			skipped++
+		default:
+			streak++
+		}
+		start, end = overnightWindow(start)
+	}
+	return streak, skipped, false
+}
+
+// judgeNight decides how one night went. The door counts as left open if
+// it had been open for at least the threshold at any point in the night.
+func judgeNight(spans []doorSpan, start, end time.Time, threshold time.Duration) nightResult {
+	result := nightGood
+	for _, span := range spans {
+		if !span.From.Before(end) || !span.To.After(start) {
+			continue
+		}
+		switch span.Status {
+		case "open":
+			if span.To.Sub(span.Opened) >= threshold && span.Opened.Add(threshold).Before(end) {
+				return nightBad
+			}
+		case "unknown":
+			result = nightUnknown
+		}
+	}
+	return result
+}
+
+// overnightWindow returns the start and end of the most recent night to
+// have ended by now, in local time, matching the monitor's morning report
+func overnightWindow(current time.Time) (time.Time, time.Time) {
+	local := current.In(localTimezone)
+	at := func(day time.Time, mins int) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), 0, mins, 0, 0, localTimezone)
+	}
+
+	end := at(local, overnightEnd)
+	if end.After(local) {
+		end = at(local.AddDate(0, 0, -1), overnightEnd)
+	}
+
+	start := at(end, overnightStart)
+	if overnightStart >= overnightEnd {
+		// Crosses midnight, so it started the evening before
+		start = at(end.AddDate(0, 0, -1), overnightStart)
+	}
+	return start, end
+}
+
+// parseClock parses a local time of day, "HH:MM", into minutes after
+// midnight
+func parseClock(value string) (int, error) {
+	var hours, mins int
+	if _, err := fmt.Sscanf(value, "%d:%d", &hours, &mins); err != nil {
+		return 0, fmt.Errorf("%q is not HH:MM", value)
+	}
+	if hours < 0 || mins < 0 || mins > 59 || hours > 24 || (hours == 24 && mins != 0) {
+		return 0, fmt.Errorf("%q is not a time of day", value)
+	}
+	return hours*60 + mins, nil
+}
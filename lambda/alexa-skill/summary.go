@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// doorSummary is one door's line in an all-door summary
+type doorSummary struct {
+	Device  Device
+	Name    string // Spoken name, read after the door's state is loaded
+	Reading statusReading
+	Err     error
+}
+
+// handleGetAllStatus reads every door the user can access and describes them
+// in a stable order. With a single door it answers as GetStatusIntent does.
+func handleGetAllStatus(ctx context.Context, request AlexaRequest) (AlexaResponse, error) {
+	userID := request.Session.User.UserID
+	if len(devices) == 0 {
+		if !userCanAccess(userID, particleDeviceID) {
+			fmt.Printf("User %s is not allowed to use %s\n", redactID(userID), particleDeviceID)
+			speech := fmt.Sprintf("Sorry, you don't have access to %s.", spokenName(particleDeviceID))
+			return buildResponse(speech, true), nil
+		}
+		return handleGetStatus(ctx, particleDeviceID, false, supportsAPL(request), request.Request.Locale)
+	}
+
+	var allowed []Device
+	for _, device := range devices {
+		if userCanAccess(userID, device.ID) {
+			allowed = append(allowed, device)
+		}
+	}
+	if len(allowed) == 0 {
+		return buildResponse("Sorry, you don't have access to any of the doors.", true), nil
+	}
+
+	summaries := fetchAllStatuses(ctx, allowed)
+
+	sortDoorSummaries(summaries)
+
+	lines := make([]string, 0, len(summaries))
+	for _, summary := range summaries {
+		if summary.Err == nil && summary.Reading.Source == sourceLive {
+			if err := updateDoorStatus(ctx, summary.Device.ID, summary.Reading.Status); err != nil {
+				fmt.Printf("Error updating status in DynamoDB: %v\n", err)
+			}
+		}
+		lines = append(lines, summary.speech())
+	}
+
+	return buildResponse(strings.Join(lines, " "), true), nil
+}
+
+// sortDoorSummaries orders doors by their sortOrder, with unnumbered doors
+// after the numbered ones, then alphabetically by spoken name, so a summary
+// reads the same way every time
+func sortDoorSummaries(summaries []doorSummary) {
+	sort.SliceStable(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.Device.SortOrder != b.Device.SortOrder {
+			if a.Device.SortOrder == 0 || b.Device.SortOrder == 0 {
+				return b.Device.SortOrder == 0
+			}
+			return a.Device.SortOrder < b.Device.SortOrder
+		}
+		return strings.TrimPrefix(a.Name, "the ") < strings.TrimPrefix(b.Name, "the ")
+	})
+}
+
+// fanOutMargin is left before the invocation deadline when reading doors,
+// for recording the readings and building the response
+const fanOutMargin = time.Second
+
+// fetchAllStatuses reads each door, at most MAX_CONCURRENT_DEVICE_CALLS at a
+// time, each into its own slot. Reads still waiting or running when the
+// deadline nears are cancelled and reported as failed for their door.
+func fetchAllStatuses(ctx context.Context, doors []Device) []doorSummary {
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-fanOutMargin))
+		defer cancel()
+	}
+
+	summaries := make([]doorSummary, len(doors))
+	slots := make(chan struct{}, maxDeviceCalls)
+	var wg sync.WaitGroup
+	for i, device := range doors {
+		wg.Add(1)
+		go func(i int, device Device) {
+			defer wg.Done()
+
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				summaries[i] = doorSummary{Device: device, Name: spokenName(device.ID), Err: ctx.Err()}
+				return
+			}
+
+			loadFriendlyName(ctx, device.ID)
+			reading, err := fetchDoorStatus(ctx, device.ID, defaultStatusOptions())
+			summaries[i] = doorSummary{Device: device, Name: spokenName(device.ID), Reading: reading, Err: err}
+		}(i, device)
+	}
+	wg.Wait()
+	return summaries
+}
+
+// speech describes one door as a sentence
+func (s doorSummary) speech() string {
+	if s.Err != nil {
+		fmt.Printf("Error getting status of %s: %v\n", s.Device.ID, s.Err)
+		if errors.Is(s.Err, errDeviceNotResponding) {
+			return fmt.Sprintf("The controller for %s didn't respond.", s.Name)
+		}
+		return fmt.Sprintf("I couldn't get the status of %s.", s.Name)
+	}
+	if s.Reading.Status == "unknown" || s.Reading.Status == "" {
+		return fmt.Sprintf("I can't tell whether %s is open.", s.Name)
+	}
+	if s.Reading.Source != sourceLive {
+		age := int64(now().Sub(s.Reading.AsOf).Minutes())
+		return fmt.Sprintf("%s was %s as of %s ago.", capitalize(s.Name), s.Reading.describe(), humanizeDuration(age))
+	}
+	return fmt.Sprintf("%s is %s.", capitalize(s.Name), s.Reading.describe())
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestAllStatusSingleDoor asks for every door's status without DEVICE_MAP,
+// which answers for the one door as GetStatusIntent would, access check
+// included
+func TestAllStatusSingleDoor(t *testing.T) {
+	current := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	fixClock(t, current)
+	var calls int32
+	fakeParticle(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if strings.HasSuffix(r.URL.Path, "/"+statusVariable) {
+			io.WriteString(w, `{"result":"open"}`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+	fakeDoorState(t, fmt.Sprintf(`{"deviceId":{"S":"dev1"},"status":{"S":"open"},"lastChecked":{"N":"%d"},"lastOpenedTime":{"N":"%d"}}`,
+		current.Unix(), current.Add(-90*time.Minute).Unix()))
+
+	savedDevice, savedDevices, savedAccess := particleDeviceID, devices, userAccess
+	particleDeviceID, devices, userAccess = "dev1", nil, map[string][]string{"owner": {"*"}}
+	defer func() { particleDeviceID, devices, userAccess = savedDevice, savedDevices, savedAccess }()
+
+	stranger := localeRequest("GetAllStatusIntent", "en-GB")
+	stranger.Session.User.UserID = "stranger"
+	response, err := handleGetAllStatus(context.Background(), stranger)
+	if err != nil {
+		t.Fatalf("handleGetAllStatus: %v", err)
+	}
+	if got := spoken(response); !strings.Contains(got, "don't have access") {
+		t.Errorf("stranger heard %q, want an access refusal", got)
+	}
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Errorf("stranger's request made %d Particle calls, want none", n)
+	}
+
+	response, err = handleGetAllStatus(context.Background(), localeRequest("GetAllStatusIntent", "en-GB"))
+	if err != nil {
+		t.Fatalf("handleGetAllStatus: %v", err)
+	}
+	if got := spoken(response); !strings.Contains(got, "It's been open for") {
+		t.Errorf("owner heard %q, want the en-GB status", got)
+	}
+	if len(response.Response.Directives) != 1 {
+		t.Errorf("directives = %d, want the status screen", len(response.Response.Directives))
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	lambdasvc "github.com/aws/aws-sdk-go/service/lambda"
+)
+
+// Test notifications are sent by the monitor, which owns alert delivery
+// (primary and fallback topics, per-person recipients), so the test goes
+// through the same path a real alert does.
+
+var (
+	monitorFunction string // MONITOR_FUNCTION_NAME
+	lambdaClient    *lambdasvc.Lambda
+)
+
+// monitorResult is the part of the monitor's result the skill reads
+type monitorResult struct {
+	Error string `json:"error,omitempty"`
+}
+
+// handleTestNotification asks the monitor to send a test alert and says
+// whether it went out
+func handleTestNotification(ctx context.Context) (AlexaResponse, error) {
+	if monitorFunction == "" || !alertsConfigured {
+		return buildResponse("Notifications aren't set up, so there's nothing to test.", true), nil
+	}
+
+	if err := sendTestNotification(ctx); err != nil {
+		fmt.Printf("Error sending test notification: %v\n", err)
+		return buildErrorResponse("Sorry, the test notification couldn't be sent. Please check the notification settings."), nil
+	}
+	return buildResponse("I've sent a test notification; check your email or phone.", true), nil
+}
+
+// sendTestNotification invokes the monitor's test_notification mode and
+// waits for the result
+func sendTestNotification(ctx context.Context) error {
+	out, err := lambdaClient.InvokeWithContext(ctx, &lambdasvc.InvokeInput{
+		FunctionName: aws.String(monitorFunction),
+		Payload:      []byte(`{"mode":"test_notification"}`),
+	})
+	if err != nil {
+		return fmt.Errorf("error invoking monitor: %w", err)
+	}
+	if out.FunctionError != nil {
+		return fmt.Errorf("monitor failed (%s): %s", aws.StringValue(out.FunctionError), string(out.Payload))
+	}
+
+	var result monitorResult
+	if err := json.Unmarshal(out.Payload, &result); err != nil {
+		return fmt.Errorf("error unmarshaling monitor result: %w", err)
+	}
+	if result.Error != "" {
+		return fmt.Errorf("monitor: %s", result.Error)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+type invocationTimingKey struct{}
+
+// invocationTiming adds up how long one invocation waited on Particle and
+// DynamoDB, for its summary log line
+type invocationTiming struct {
+	mu       sync.Mutex
+	particle time.Duration
+	dynamo   time.Duration
+}
+
+// withInvocationTiming starts an invocation's timing
+func withInvocationTiming(ctx context.Context) context.Context {
+	return context.WithValue(ctx, invocationTimingKey{}, &invocationTiming{})
+}
+
+// invocationTimes returns the time spent on Particle and DynamoDB so far,
+// in milliseconds
+func invocationTimes(ctx context.Context) (particleMs, dynamoMs int64) {
+	timing, ok := ctx.Value(invocationTimingKey{}).(*invocationTiming)
+	if !ok {
+		return 0, 0
+	}
+
+	timing.mu.Lock()
+	defer timing.mu.Unlock()
+	return timing.particle.Milliseconds(), timing.dynamo.Milliseconds()
+}
+
+// chargeTime adds spent to one of the invocation's totals
+func chargeTime(ctx context.Context, spent time.Duration, particle bool) {
+	timing, ok := ctx.Value(invocationTimingKey{}).(*invocationTiming)
+	if !ok {
+		// Not started by a handler, e.g. during init
+		return
+	}
+
+	timing.mu.Lock()
+	defer timing.mu.Unlock()
+	if particle {
+		timing.particle += spent
+	} else {
+		timing.dynamo += spent
+	}
+}
+
+// timedTransport charges each Particle round trip to the invocation that
+// made it
+type timedTransport struct {
+	base http.RoundTripper
+}
+
+func (t timedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	chargeTime(req.Context(), time.Since(start), true)
+	return resp, err
+}
+
+// timeDynamoCalls charges each DynamoDB call, including its retries, to the
+// invocation that made it
+func timeDynamoCalls(c *client.Client) {
+	c.Handlers.Complete.PushBack(func(r *request.Request) {
+		chargeTime(r.Context(), time.Since(r.Time), false)
+	})
+}
+
+// RequestSummary is the one JSON log line written at the end of each Alexa
+// request, for Logs Insights
+type RequestSummary struct {
+	RequestType string `json:"requestType"`
+	Intent      string `json:"intent,omitempty"`
+	Device      string `json:"device,omitempty"`
+	Action      string `json:"action,omitempty"` // What the skill did to the door, e.g. "pressed"
+	Failed      bool   `json:"failed"`           // The response reports an error
+	Notified    bool   `json:"notified"`         // A notification was sent
+	ParticleMs  int64  `json:"particleMs"`
+	DynamoMs    int64  `json:"dynamoMs"`
+	DurationMs  int64  `json:"durationMs"`
+	Error       string `json:"error,omitempty"`
+
+	mu sync.Mutex
+}
+
+type requestSummaryKey struct{}
+
+// withRequestSummary starts a request's summary and timing
+func withRequestSummary(ctx context.Context, request AlexaRequest) (context.Context, *RequestSummary) {
+	summary := &RequestSummary{RequestType: request.Request.Type, Intent: request.Request.Intent.Name}
+	ctx = context.WithValue(ctx, requestSummaryKey{}, summary)
+	return withInvocationTiming(ctx), summary
+}
+
+// noteSummary records part of the outcome on the request's summary, if the
+// request has one
+func noteSummary(ctx context.Context, note func(*RequestSummary)) {
+	summary, ok := ctx.Value(requestSummaryKey{}).(*RequestSummary)
+	if !ok {
+		return
+	}
+
+	summary.mu.Lock()
+	defer summary.mu.Unlock()
+	note(summary)
+}
+
+// log completes the summary and writes it out
+func (s *RequestSummary) log(ctx context.Context, start time.Time, response AlexaResponse, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Failed = response.failed
+	if err != nil {
+		s.Error = err.Error()
+	}
+	s.ParticleMs, s.DynamoMs = invocationTimes(ctx)
+	s.DurationMs = time.Since(start).Milliseconds()
+	if line, marshalErr := json.Marshal(s); marshalErr == nil {
+		fmt.Println(string(line))
+	}
+}
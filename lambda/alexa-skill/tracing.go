@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-xray-sdk-go/xray"
+)
+
+// tracingEnabled is set by ENABLE_XRAY. The function's tracing mode must also
+// be Active for the segments to be sent.
+var tracingEnabled bool
+
+// enableTracing instruments the shared Particle HTTP client and the given AWS
+// clients so each call is recorded as a subsegment of the invocation. It runs
+// at the end of init() so cold-start calls, which have no segment, aren't
+// wrapped.
+func enableTracing(clients ...*client.Client) {
+	httpClient = xray.Client(httpClient)
+	for _, c := range clients {
+		if c != nil {
+			xray.AWS(c)
+		}
+	}
+	fmt.Println("X-Ray tracing enabled")
+}
+
+// startSpan opens a named subsegment, e.g. "particle.pressButton", when
+// tracing is enabled. Callers must call the returned function when done.
+func startSpan(ctx context.Context, name string) (context.Context, func()) {
+	if !tracingEnabled {
+		return ctx, func() {}
+	}
+
+	ctx, seg := xray.BeginSubsegment(ctx, name)
+	if seg == nil {
+		return ctx, func() {}
+	}
+	return ctx, func() { seg.Close(nil) }
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// userPrefsPrefix starts the door state table key of each user's preference
+// item, e.g. "user#amzn1.ask.account...". The monitor skips these items.
+const userPrefsPrefix = "user#"
+
+// defaultToLastDoor is DEFAULT_TO_LAST_DOOR: with several doors, a command
+// that doesn't name one goes to the door the user last operated instead of
+// asking which
+var defaultToLastDoor bool
+
+// UserPrefs is a user's preference item
+type UserPrefs struct {
+	LastOperatedDevice string `json:"lastOperatedDevice,omitempty"`
+	LastOperatedAt     int64  `json:"lastOperatedAt,omitempty"`
+}
+
+// lastOperatedDevice returns the device the user last operated, if it is
+// still configured and they can still use it
+func lastOperatedDevice(ctx context.Context, userID string) (string, bool) {
+	if !defaultToLastDoor || userID == "" {
+		return "", false
+	}
+
+	prefs, err := loadUserPrefs(ctx, userID)
+	if err != nil {
+		fmt.Printf("Error loading preferences for %s: %v\n", redactID(userID), err)
+		return "", false
+	}
+	if prefs.LastOperatedDevice == "" {
+		return "", false
+	}
+
+	for _, device := range devices {
+		if device.ID == prefs.LastOperatedDevice && userCanAccess(userID, device.ID) {
+			return device.ID, true
+		}
+	}
+	fmt.Printf("Ignoring last operated device %s, which is no longer available\n", prefs.LastOperatedDevice)
+	return "", false
+}
+
+// loadUserPrefs reads a user's preference item. A missing item is empty.
+func loadUserPrefs(ctx context.Context, userID string) (UserPrefs, error) {
+	result, err := dynamoClient.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(doorStateTable),
+		Key:       stateKey(userPrefsPrefix + userID),
+	})
+	if err != nil {
+		return UserPrefs{}, fmt.Errorf("error getting preferences from DynamoDB: %w", err)
+	}
+
+	var prefs UserPrefs
+	if result.Item == nil {
+		return prefs, nil
+	}
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &prefs); err != nil {
+		return UserPrefs{}, fmt.Errorf("error unmarshaling preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+// rememberLastOperated records the door the user just operated. Only these
+// attributes are set, so the rest of the item is left alone; a failure is
+// logged and doesn't affect the response.
+func rememberLastOperated(ctx context.Context, userID, deviceID string) {
+	if !defaultToLastDoor || userID == "" || len(devices) < 2 {
+		return
+	}
+
+	_, err := dynamoClient.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(doorStateTable),
+		Key:              stateKey(userPrefsPrefix + userID),
+		UpdateExpression: aws.String("SET lastOperatedDevice = :device, lastOperatedAt = :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":device": {S: aws.String(deviceID)},
+			":now":    {N: aws.String(fmt.Sprint(now().Unix()))},
+		},
+	})
+	if err != nil {
+		fmt.Printf("Error saving last operated device for %s: %v\n", redactID(userID), err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// verbosity is how much the press and status responses say, from
+// RESPONSE_VERBOSITY
+type verbosity int
+
+const (
+	verbosityTerse verbosity = iota
+	verbosityNormal
+	verbosityVerbose
+)
+
+var verbosityLevels = map[string]verbosity{
+	"terse":   verbosityTerse,
+	"normal":  verbosityNormal,
+	"verbose": verbosityVerbose,
+}
+
+var responseVerbosity = verbosityNormal
+
+// parseVerbosity reads a RESPONSE_VERBOSITY value
+func parseVerbosity(raw string) (verbosity, error) {
+	level, ok := verbosityLevels[strings.ToLower(strings.TrimSpace(raw))]
+	if !ok {
+		return verbosityNormal, fmt.Errorf("RESPONSE_VERBOSITY must be terse, normal or verbose, not %q", raw)
+	}
+	return level, nil
+}
+
+// phrasings holds every response that varies with verbosity. A level
+// without an entry uses the normal phrasing; an empty one says nothing.
+// {placeholders} are filled in by phrase.
+var phrasings = map[string]map[verbosity]string{
+	"pressed": {
+		verbosityTerse:   "Done.",
+		verbosityNormal:  "{Door} button pressed. The relay has been activated for {hold}.",
+		verbosityVerbose: "{Door} button pressed. The relay has been activated for {hold}.{lastPress}",
+	},
+	"lastPress": {
+		verbosityNormal:  "",
+		verbosityVerbose: " Before this, the button was last pressed {ago} ago.",
+	},
+	"statusLive": {
+		verbosityTerse:  "{Name} is {status}{obstruction}.",
+		verbosityNormal: "{Name} is {status} right now{obstruction}.",
+	},
+	"statusStale": {
+		verbosityTerse:  "{Name} was {status} {age} ago{obstruction}.",
+		verbosityNormal: "{Name} was {status} as of {age} ago{obstruction}.",
+	},
+	"checkedNow": {
+		verbosityTerse:  "",
+		verbosityNormal: "I checked it just now.",
+	},
+	"closedFor": {
+		verbosityNormal:  "",
+		verbosityVerbose: "It has been closed for {duration}.",
+	},
+}
+
+// phrase fills in the phrasing for key at the configured verbosity. vars
+// are placeholder name and value pairs.
+func phrase(key string, vars ...string) string {
+	return fillPhrase(phrasings[key], vars...)
+}
+
+// fillPhrase picks a phrasing's text for the configured verbosity and fills
+// in its placeholders
+func fillPhrase(levels map[verbosity]string, vars ...string) string {
+	text, ok := levels[responseVerbosity]
+	if !ok {
+		text = levels[verbosityNormal]
+	}
+
+	pairs := make([]string, 0, len(vars))
+	for i := 0; i+1 < len(vars); i += 2 {
+		pairs = append(pairs, "{"+vars[i]+"}", vars[i+1])
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// speakOpenDuration reports whether status responses include how long the
+// door has been open
+func speakOpenDuration() bool {
+	return responseVerbosity > verbosityTerse
+}
+
+// verboseResponses reports whether responses add extra context, such as
+// when the status was read and how long the door has been closed
+func verboseResponses() bool {
+	return responseVerbosity >= verbosityVerbose
+}
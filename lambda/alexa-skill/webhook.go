@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Particle can push the door status instead of the skill polling for it. The
+// firmware publishes door/status on every change and every 10 minutes, and a
+// Particle webhook on that event POSTs it to /webhook on this function's URL
+// with the PARTICLE_WEBHOOK_SECRET in an X-Webhook-Secret header. The status
+// is recorded on DoorState like a live reading, and status requests use it
+// while it is recent instead of asking Particle.
+
+var (
+	webhookSecret      string        // PARTICLE_WEBHOOK_SECRET
+	pushedStatusMaxAge time.Duration // PUSHED_STATUS_MAX_AGE_MINUTES
+)
+
+// webhookEvents are the event names accepted from the webhook
+var webhookEvents = map[string]bool{"door/status": true, "doorStatus": true}
+
+// webhookEvent is the body of Particle's default JSON webhook
+type webhookEvent struct {
+	Event       string `json:"event"`
+	Data        string `json:"data"`
+	PublishedAt string `json:"published_at"`
+	CoreID      string `json:"coreid"` // The publishing device's ID
+}
+
+// handleWebhook records a status pushed by Particle
+func handleWebhook(ctx context.Context, request events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+	if request.RequestContext.HTTP.Method != http.MethodPost {
+		return textResponse(http.StatusMethodNotAllowed, "method not allowed"), nil
+	}
+	// Function URLs lower-case header names
+	if !hmac.Equal([]byte(request.Headers["x-webhook-secret"]), []byte(webhookSecret)) {
+		fmt.Println("Rejected webhook with a missing or wrong secret")
+		return textResponse(http.StatusForbidden, "forbidden"), nil
+	}
+
+	body := []byte(request.Body)
+	if request.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(request.Body)
+		if err != nil {
+			return textResponse(http.StatusBadRequest, "bad body encoding"), nil
+		}
+		body = decoded
+	}
+
+	var event webhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		fmt.Printf("Error unmarshaling webhook: %v\n", err)
+		return textResponse(http.StatusBadRequest, "bad body"), nil
+	}
+	if !webhookEvents[event.Event] {
+		return textResponse(http.StatusBadRequest, fmt.Sprintf("unexpected event %q", event.Event)), nil
+	}
+	if !knownDevice(event.CoreID) {
+		fmt.Printf("Rejected webhook from unknown device %s\n", event.CoreID)
+		return textResponse(http.StatusForbidden, "unknown device"), nil
+	}
+
+	reading := newStatusReading(event.Data, sourcePushed, now())
+	if reading.Status == "" {
+		return textResponse(http.StatusBadRequest, "no status"), nil
+	}
+
+	// Order by when the device published, not when the webhook arrived
+	publishedAt, err := time.Parse(time.RFC3339, event.PublishedAt)
+	if err != nil {
+		publishedAt = now()
+	}
+	fmt.Printf("Webhook: %s is %s as of %s\n", event.CoreID, reading.Status, publishedAt.Format(time.RFC3339))
+
+	applied, err := saveDoorStatus(ctx, event.CoreID, reading.Status, publishedAt, true)
+	if err != nil {
+		fmt.Printf("Error saving pushed status: %v\n", err)
+		// Particle retries failed webhooks
+		return textResponse(http.StatusInternalServerError, "could not save status"), nil
+	}
+	if !applied {
+		// An out-of-order push changes nothing, including what is cached
+		return textResponse(http.StatusOK, "ok"), nil
+	}
+	if statusCache != nil {
+		statusCache.For(event.CoreID).Set(event.Data)
+	}
+	invalidateResponses(event.CoreID)
+
+	return textResponse(http.StatusOK, "ok"), nil
+}
+
+// pushedStatus returns the door's pushed status, if the webhook has pushed
+// within PUSHED_STATUS_MAX_AGE_MINUTES. The firmware re-publishes an
+// unchanged status every 10 minutes, so an older push means the webhook or
+// the device has stopped and the sensor should be read instead.
+func pushedStatus(ctx context.Context, deviceID string) (statusReading, bool) {
+	if webhookSecret == "" || pushedStatusMaxAge <= 0 {
+		return statusReading{}, false
+	}
+
+	state, err := getDoorState(ctx, deviceID)
+	if err != nil || state == nil || state.PushedAt == 0 {
+		return statusReading{}, false
+	}
+	if age := now().Sub(time.Unix(state.PushedAt, 0)); age > pushedStatusMaxAge {
+		fmt.Printf("Pushed status is %s old - reading the sensor\n", age.Round(time.Second))
+		return statusReading{}, false
+	}
+
+	// LastChecked also moves with live readings, so it is the newer of the two
+	return newStatusReading(state.Status, sourcePushed, time.Unix(state.LastChecked, 0)), true
+}
+
+// knownDevice reports whether a device ID is one of the configured doors
+func knownDevice(deviceID string) bool {
+	if deviceID == "" {
+		return false
+	}
+	if deviceID == particleDeviceID {
+		return true
+	}
+	for _, device := range devices {
+		if device.ID == deviceID {
+			return true
+		}
+	}
+	return false
+}
+
+func textResponse(status int, body string) events.LambdaFunctionURLResponse {
+	return events.LambdaFunctionURLResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "text/plain; charset=utf-8"},
+		Body:       body,
+	}
+}
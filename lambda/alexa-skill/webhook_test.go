@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// fakeDoorTable is a door state table for the length of the test: PutItem
+// keeps the item under its key and GetItem returns it. Other calls succeed
+// and are ignored.
+func fakeDoorTable(t *testing.T) {
+	t.Helper()
+	var mu sync.Mutex
+	items := map[string]json.RawMessage{}
+	fakeDynamo(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Key  map[string]struct{ S string }
+			Item json.RawMessage
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("DynamoDB request is not JSON: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+
+		mu.Lock()
+		defer mu.Unlock()
+		switch target := r.Header.Get("X-Amz-Target"); {
+		case strings.HasSuffix(target, ".PutItem"):
+			var item map[string]struct{ S string }
+			json.Unmarshal(body.Item, &item)
+			items[item[stateKeyName].S] = body.Item
+		case strings.HasSuffix(target, ".GetItem"):
+			if item, ok := items[body.Key[stateKeyName].S]; ok {
+				fmt.Fprintf(w, `{"Item":%s}`, item)
+				return
+			}
+		}
+		io.WriteString(w, `{}`)
+	})
+}
+
+// push sends the webhook a door/status event from dev1
+func push(t *testing.T, status string, publishedAt time.Time) {
+	t.Helper()
+	body := fmt.Sprintf(`{"event":"door/status","data":%q,"published_at":%q,"coreid":"dev1"}`, status, publishedAt.Format(time.RFC3339))
+	var request events.LambdaFunctionURLRequest
+	request.RequestContext.HTTP.Method = http.MethodPost
+	request.Headers = map[string]string{"x-webhook-secret": webhookSecret}
+	request.Body = body
+
+	response, err := handleWebhook(context.Background(), request)
+	if err != nil || response.StatusCode != http.StatusOK {
+		t.Fatalf("webhook = %d %s, %v; want 200", response.StatusCode, response.Body, err)
+	}
+}
+
+func TestWebhookIgnoresOutOfOrderPush(t *testing.T) {
+	current := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	fixClock(t, current)
+	fakeDoorTable(t)
+
+	secret, device, cache := webhookSecret, particleDeviceID, statusCache
+	webhookSecret, particleDeviceID, statusCache = "test-secret", "dev1", newKeyedCache[string, string](time.Minute)
+	defer func() { webhookSecret, particleDeviceID, statusCache = secret, device, cache }()
+
+	push(t, "open", current.Add(-5*time.Second))
+	push(t, "closed", current.Add(-10*time.Second)) // Published earlier, delivered late
+
+	if cached, _, ok := statusCache.For("dev1").Peek(); !ok || cached != "open" {
+		t.Errorf("cached status = %q (cached %t), want the newer push, open", cached, ok)
+	}
+	state, err := getDoorState(context.Background(), "dev1")
+	if err != nil || state == nil {
+		t.Fatalf("getDoorState = %+v, %v", state, err)
+	}
+	if state.Status != "open" || state.PushedAt != current.Add(-5*time.Second).Unix() {
+		t.Errorf("stored status = %s pushed at %d, want the newer push", state.Status, state.PushedAt)
+	}
+}
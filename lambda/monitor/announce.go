@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// With ANNOUNCE_ON_OPEN=true the monitor sends an Alexa notification to the
+// skill's users when it sees the door open, through the Proactive Events
+// API. Users must allow notifications for the skill first ("Alexa, ask
+// garage door to turn on notifications"). It has its own OpenAnnounced flag,
+// so it is sent once per open session whatever happens to the alerts.
+
+var (
+	announceOnOpen    bool
+	alexaClientID     string // ALEXA_CLIENT_ID, from the skill's Permissions page
+	alexaClientSecret string // ALEXA_CLIENT_SECRET
+	alexaAPIEndpoint  string // ALEXA_API_ENDPOINT, for the skill's region
+	alexaEventsStage  string // ALEXA_EVENTS_STAGE: development or live
+)
+
+// announceMaxAge is how recently the door must have opened to be announced,
+// so a door found open long after the fact isn't called "just opened"
+const announceMaxAge = 30 * time.Minute
+
+// alexaHTTPClient is separate from the Particle client so its calls aren't
+// timed as Particle calls
+var alexaHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// alexaTokens caches the Proactive Events access token, which lasts an hour
+var alexaTokens = newCachedValue[string](50 * time.Minute)
+
+// announceOpen sends the open announcement once per open session. Returns
+// whether it was sent.
+func announceOpen(ctx context.Context, state *DoorState, current time.Time) bool {
+	if !announceOnOpen || state.Status != "open" || state.OpenAnnounced {
+		return false
+	}
+	if current.Sub(time.Unix(state.LastOpenedTime, 0)) > announceMaxAge {
+		// Too late to be news; don't try again this session
+		state.OpenAnnounced = true
+		return false
+	}
+
+	if err := sendProactiveEvent(ctx, state, current); err != nil {
+		fmt.Printf("Error announcing open door: %v\n", err)
+		return false
+	}
+
+	fmt.Println("Open announcement sent")
+	state.OpenAnnounced = true
+	return true
+}
+
+// sendProactiveEvent sends a message alert from the door to every user
+// subscribed to the skill's notifications. The Proactive Events API only
+// takes fixed schemas, so Echo devices say there is a new message from the
+// door rather than reading free text.
+func sendProactiveEvent(ctx context.Context, state *DoorState, current time.Time) error {
+	token, _, err := alexaTokens.Get(func() (string, error) {
+		return fetchAlexaToken(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	event := map[string]interface{}{
+		"timestamp":   current.UTC().Format(time.RFC3339),
+		"referenceId": fmt.Sprintf("%s-open-%d", state.DeviceID, state.LastOpenedTime),
+		"expiryTime":  current.Add(time.Hour).UTC().Format(time.RFC3339),
+		"event": map[string]interface{}{
+			"name": "AMAZON.MessageAlert.Activated",
+			"payload": map[string]interface{}{
+				"state": map[string]string{"status": "UNREAD", "freshness": "NEW"},
+				"messageGroup": map[string]interface{}{
+					"creator": map[string]string{"name": "your " + ownedName(state.DeviceID)},
+					"count":   1,
+					"urgency": "URGENT",
+				},
+			},
+		},
+		"relevantAudience": map[string]interface{}{"type": "Multicast", "payload": map[string]string{}},
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error marshaling event: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/proactiveEvents/stages/%s", alexaAPIEndpoint, alexaEventsStage)
+	if alexaEventsStage == "live" {
+		endpoint = alexaAPIEndpoint + "/v1/proactiveEvents"
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := alexaHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		respBody, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			alexaTokens.Invalidate()
+		}
+		return fmt.Errorf("proactive events API error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// fetchAlexaToken gets a Proactive Events access token with the skill's
+// client credentials
+func fetchAlexaToken(ctx context.Context) (string, error) {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {alexaClientID},
+		"client_secret": {alexaClientSecret},
+		"scope":         {"alexa::proactive_events"},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.amazon.com/auth/o2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("error creating token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := alexaHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error requesting token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(respBody, &token); err != nil {
+		return "", fmt.Errorf("error unmarshaling token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("token response has no access token")
+	}
+	return token.AccessToken, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Mirrors cachedValue in the skill's cache.go; keep the two in step.
+
+// cachedValue holds a single value with an expiry. It is safe for concurrent
+// use, since one run can read it from several goroutines, e.g. the per-door
+// checks of a multi-door run, and refreshes are single-flight: when the value
+// expires, only one caller runs the fetch while the others wait for and share
+// its result.
+type cachedValue[T any] struct {
+	mu        sync.RWMutex
+	value     T
+	fetchedAt time.Time
+	valid     bool
+	ttl       time.Duration
+
+	// refreshMu serializes fetches so a stampede of reads after expiry
+	// triggers a single upstream call
+	refreshMu sync.Mutex
+}
+
+// newCachedValue creates an empty cache whose entries live for ttl
+func newCachedValue[T any](ttl time.Duration) *cachedValue[T] {
+	return &cachedValue[T]{ttl: ttl}
+}
+
+// Peek returns the cached value and when it was fetched, if it hasn't expired
+func (c *cachedValue[T]) Peek() (T, time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.valid || time.Since(c.fetchedAt) >= c.ttl {
+		var zero T
+		return zero, time.Time{}, false
+	}
+	return c.value, c.fetchedAt, true
+}
+
+// Get returns the cached value and when it was fetched, calling fetch to
+// refresh it if it is missing or expired. Fetch errors are returned as-is
+// and nothing is cached.
+func (c *cachedValue[T]) Get(fetch func() (T, error)) (T, time.Time, error) {
+	if value, fetchedAt, ok := c.Peek(); ok {
+		return value, fetchedAt, nil
+	}
+
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	// Another caller may have refreshed while we waited
+	if value, fetchedAt, ok := c.Peek(); ok {
+		return value, fetchedAt, nil
+	}
+
+	value, err := fetch()
+	if err != nil {
+		var zero T
+		return zero, time.Time{}, err
+	}
+
+	c.Set(value)
+	return value, time.Now(), nil
+}
+
+// Set stores a value, restarting its expiry
+func (c *cachedValue[T]) Set(value T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.value = value
+	c.fetchedAt = time.Now()
+	c.valid = true
+}
+
+// Invalidate drops the cached value so the next Get fetches again
+func (c *cachedValue[T]) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero T
+	c.value = zero
+	c.valid = false
+}
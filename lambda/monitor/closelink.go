@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// signCloseLink computes the signature for a close link. It must match the
+// skill's copy, which verifies it.
+func signCloseLink(deviceID string, expires int64, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(closeLinkSecret))
+	fmt.Fprintf(mac, "%s|%d|%s", deviceID, expires, nonce)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newCloseLink issues a single-use link that closes the door, recording its
+// nonce on state so the skill can consume it. Returns "" when close links
+// aren't configured.
+func newCloseLink(state *DoorState, current time.Time) string {
+	if closeLinkSecret == "" || closeLinkBaseURL == "" {
+		return ""
+	}
+
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		fmt.Printf("Error generating close link: %v\n", err)
+		return ""
+	}
+	nonce := hex.EncodeToString(buf)
+	expires := current.Add(closeLinkTTL).Unix()
+
+	state.CloseLinkNonce = nonce
+
+	query := url.Values{
+		"device":  {state.DeviceID},
+		"expires": {strconv.FormatInt(expires, 10)},
+		"nonce":   {nonce},
+		"sig":     {signCloseLink(state.DeviceID, expires, nonce)},
+	}
+	return strings.TrimSuffix(closeLinkBaseURL, "/") + "/close?" + query.Encode()
+}
@@ -0,0 +1,75 @@
+package main
+
+import "fmt"
+
+// A flaky reed switch can flip between open and closed from one run to the
+// next. With STATUS_STABLE_RUNS above 1 or STATUS_STABLE_MINUTES set, a
+// change between open and closed only counts once it has been seen for that
+// many consecutive runs and that long; until then the door keeps its old
+// status and the new one waits on DoorState as PendingStatus.
+
+var (
+	statusStableRuns int   // STATUS_STABLE_RUNS, consecutive sightings needed
+	statusStableSecs int64 // STATUS_STABLE_MINUTES, in seconds
+)
+
+// debounceEnabled reports whether status changes have to settle first
+func debounceEnabled() bool {
+	return statusStableRuns > 1 || statusStableSecs > 0
+}
+
+// pendingChange is the result of debouncing one reading
+type pendingChange struct {
+	Status    string // Status to treat as current
+	Confirmed bool   // Status is a change that has just settled
+	Since     int64  // When a confirmed change was first seen
+
+	// The change still waiting to settle, if any
+	PendingStatus string
+	PendingSince  int64
+	PendingRuns   int
+}
+
+// debounceStatus decides whether a reading changes the door's status.
+// Only changes between open and closed wait; anything to or from another
+// status, such as the first reading or an unknown one, counts at once.
+func debounceStatus(previous *DoorState, observed string, current int64) pendingChange {
+	settles := func(status string) bool { return status == "open" || status == "closed" }
+	if !debounceEnabled() || observed == previous.Status || !settles(observed) || !settles(previous.Status) {
+		return pendingChange{Status: observed}
+	}
+
+	change := pendingChange{PendingStatus: observed, PendingSince: current, PendingRuns: 1}
+	if previous.PendingStatus == observed {
+		change.PendingSince = previous.PendingSince
+		change.PendingRuns = previous.PendingRuns + 1
+	}
+
+	if change.PendingRuns >= statusStableRuns && current-change.PendingSince >= statusStableSecs {
+		fmt.Printf("Status %s stable for %d run(s) since %d - accepting it\n", observed, change.PendingRuns, change.PendingSince)
+		return pendingChange{Status: observed, Confirmed: true, Since: change.PendingSince}
+	}
+
+	fmt.Printf("Status %s not yet stable (%d run(s) since %d) - keeping %s\n", observed, change.PendingRuns, change.PendingSince, previous.Status)
+	change.Status = previous.Status
+	return change
+}
+
+// apply records the pending change on the new state. A confirmed change is
+// dated from when it was first seen, so open durations include the time it
+// took to settle.
+func (c pendingChange) apply(state *DoorState) {
+	state.PendingStatus = c.PendingStatus
+	state.PendingSince = c.PendingSince
+	state.PendingRuns = c.PendingRuns
+
+	if !c.Confirmed {
+		return
+	}
+	switch c.Status {
+	case "open":
+		state.LastOpenedTime = c.Since
+	case "closed":
+		state.LastClosedTime = c.Since
+	}
+}
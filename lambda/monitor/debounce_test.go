@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// TestFlappingStatusWaitsToSettle has a closed door's sensor flip between
+// open and closed every run, then settle on open. With STATUS_STABLE_RUNS 3
+// and STATUS_STABLE_MINUTES 10 nothing changes until the open reading has
+// held for both, and the open door is then timed from its first sighting.
+func TestFlappingStatusWaitsToSettle(t *testing.T) {
+	status := "closed"
+	sent, check := monitorDoor(t, &status)
+	db := fakeDoorState(t) // In place of monitorDoor's, to read the events written
+	useEventQueue(t, 0)
+
+	runs, secs := statusStableRuns, statusStableSecs
+	statusStableRuns, statusStableSecs = 3, 10*60
+	defer func() { statusStableRuns, statusStableSecs = runs, secs }()
+
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	at := func(mins int) time.Time { return start.Add(time.Duration(mins) * time.Minute) }
+	storedStatus := func() string {
+		t.Helper()
+		state, err := getDoorState(context.Background(), "dev1")
+		if err != nil || state == nil {
+			t.Fatalf("getDoorState = %+v, %v", state, err)
+		}
+		return state.Status
+	}
+	eventStatuses := func() []string {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		var statuses []string
+		for _, item := range db.puts[testEventsTable] {
+			var event struct{ Status struct{ S string } }
+			json.Unmarshal(item, &event)
+			statuses = append(statuses, event.Status.S)
+		}
+		return statuses
+	}
+
+	// The first reading counts at once
+	check(at(0))
+	if got := eventStatuses(); len(got) != 1 || got[0] != "closed" {
+		t.Fatalf("events = %v, want the first reading", got)
+	}
+
+	for i, flap := range []string{"open", "closed", "open", "closed", "open", "closed"} {
+		status = flap
+		check(at(5 + i*5))
+		if got := storedStatus(); got != "closed" {
+			t.Fatalf("status after %s at minute %d = %s, want closed until a change settles", flap, 5+i*5, got)
+		}
+	}
+	if got := eventStatuses(); len(got) != 1 {
+		t.Errorf("events while flapping = %v, want none after the first", got)
+	}
+
+	// Open settles on its third run, 10 minutes after it was first seen
+	status = "open"
+	check(at(40))
+	check(at(45))
+	if got := storedStatus(); got != "closed" {
+		t.Fatalf("status after two open runs = %s, want still closed", got)
+	}
+	check(at(50))
+	state, err := getDoorState(context.Background(), "dev1")
+	if err != nil || state.Status != "open" || state.LastOpenedTime != at(40).Unix() {
+		t.Fatalf("state after settling = %+v, %v; want open since minute 40", state, err)
+	}
+	if got := eventStatuses(); len(got) != 2 || got[1] != "open" {
+		t.Errorf("events = %v, want one more, for the settled open", got)
+	}
+
+	// The 30 minute threshold runs from the first open sighting
+	check(at(69))
+	if alerts := sent.all(); len(alerts) != 0 {
+		t.Fatalf("alerted before the threshold: %+v", alerts)
+	}
+	check(at(70))
+	if alerts := sent.all(); len(alerts) != 1 {
+		t.Errorf("alerts = %+v, want one at the threshold", alerts)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// shouldNotify claims the right to report a transition. The skill and the
+// monitor can both observe the same transition, so whichever reaches DynamoDB
+// first records its signature with a conditional write and the other skips.
+// Signatures are bucketed by NOTIFY_DEDUP_WINDOW_SECONDS so the two
+// observations needn't have identical timestamps.
+func shouldNotify(ctx context.Context, state *DoorState, status string, timestamp int64) bool {
+	if doorStateTable == "" || notifyDedupWindow <= 0 {
+		return true
+	}
+
+	signature := fmt.Sprintf("%s|%s|%d", state.DeviceID, status, timestamp/notifyDedupWindow)
+	if state.LastNotifiedKey == signature {
+		return false
+	}
+
+	_, err := dynamoClient.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(doorStateTable),
+		Key:                 stateKey(state.DeviceID),
+		UpdateExpression:    aws.String("SET lastNotifiedKey = :sig"),
+		ConditionExpression: aws.String("attribute_not_exists(lastNotifiedKey) OR lastNotifiedKey <> :sig"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":sig": {S: aws.String(signature)},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			fmt.Printf("Transition %s already reported - skipping\n", signature)
+			return false
+		}
+		// Better to report twice than not at all
+		fmt.Printf("Error claiming transition %s: %v\n", signature, err)
+		return true
+	}
+
+	// Keep the claim when the full state is written back
+	state.LastNotifiedKey = signature
+	return true
+}
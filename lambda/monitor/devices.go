@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Device is one door controller from the device map
+type Device struct {
+	Name       string // Name the user says for the Door slot, e.g. "workshop"
+	ID         string // Particle device ID
+	SpokenName string // How responses refer to the door, e.g. "the workshop roll-up"
+}
+
+// deviceMapEntry is the object form of a DEVICE_MAP value
+type deviceMapEntry struct {
+	ID         string `json:"id"`
+	SpokenName string `json:"spokenName"`
+}
+
+// defaultSpokenName is used when no friendly name is configured
+const defaultSpokenName = "the garage door"
+
+// devices is loaded from DEVICE_MAP, shared with the skill, and used to name
+// the door in notifications
+var devices []Device
+
+// loadDeviceMap parses DEVICE_MAP, a JSON object of door name to either a
+// Particle device ID or an object with the ID and a spoken name, e.g.
+// {"garage":"e00fce68...","workshop":{"id":"e00fce69...","spokenName":"the workshop roll-up"}}
+func loadDeviceMap(raw string) ([]Device, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var byName map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &byName); err != nil {
+		return nil, fmt.Errorf("error parsing DEVICE_MAP: %w", err)
+	}
+
+	loaded := make([]Device, 0, len(byName))
+	for name, value := range byName {
+		var entry deviceMapEntry
+		if err := json.Unmarshal(value, &entry.ID); err != nil {
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return nil, fmt.Errorf("error parsing DEVICE_MAP entry %q: %w", name, err)
+			}
+		}
+		if entry.ID == "" {
+			return nil, fmt.Errorf("DEVICE_MAP entry %q has no device ID", name)
+		}
+		loaded = append(loaded, Device{
+			Name:       strings.ToLower(name),
+			ID:         entry.ID,
+			SpokenName: entry.SpokenName,
+		})
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].Name < loaded[j].Name })
+
+	return loaded, nil
+}
+
+// friendlyNames holds the spoken names set by voice, by device ID, as read
+// from DoorState. Doors are checked in parallel, so it is guarded.
+var (
+	friendlyNamesMu sync.RWMutex
+	friendlyNames   = map[string]string{}
+)
+
+// rememberFriendlyName records the stored name read for a device
+func rememberFriendlyName(deviceID, name string) {
+	friendlyNamesMu.Lock()
+	defer friendlyNamesMu.Unlock()
+	friendlyNames[deviceID] = name
+}
+
+// monitoredDevices lists every device the monitor checks: PARTICLE_DEVICE_ID
+// and each door in DEVICE_MAP, once each
+func monitoredDevices() []string {
+	var ids []string
+	seen := map[string]bool{}
+	add := func(id string) {
+		key := strings.ToLower(id)
+		if id != "" && !seen[key] {
+			seen[key] = true
+			ids = append(ids, id)
+		}
+	}
+	add(particleDeviceID)
+	for _, device := range devices {
+		add(device.ID)
+	}
+	return ids
+}
+
+// primaryDevice is the door single-door diagnostics such as the self-test
+// use: PARTICLE_DEVICE_ID, or the first door in DEVICE_MAP without it
+func primaryDevice() string {
+	if ids := monitoredDevices(); len(ids) > 0 {
+		return ids[0]
+	}
+	return ""
+}
+
+// maxDeviceChecks is how many doors a run checks at once, from
+// MAX_CONCURRENT_DEVICE_CALLS, to stay within Particle's rate limits
+var maxDeviceChecks = 3
+
+// runForEachDevice runs a check or nightly close for every monitored door,
+// at most MAX_CONCURRENT_DEVICE_CALLS at a time. With a single door it
+// reports straight into result. With more, each door gets its own result
+// under Devices, the top level says whether any door notified or closed,
+// and a door that fails doesn't stop the others: their errors are joined.
+func runForEachDevice(ctx context.Context, result *MonitorResult, run func(context.Context, string, *MonitorResult) error) error {
+	ids := monitoredDevices()
+	if len(ids) == 0 {
+		return fmt.Errorf("no devices configured: set PARTICLE_DEVICE_ID or DEVICE_MAP")
+	}
+	if len(ids) == 1 {
+		result.DeviceID = ids[0]
+		return run(ctx, ids[0], result)
+	}
+
+	results := make([]MonitorResult, len(ids))
+	errs := make([]error, len(ids))
+	slots := make(chan struct{}, maxDeviceChecks)
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			results[i] = MonitorResult{Mode: result.Mode, DeviceID: id}
+			defer func() {
+				// HandleMonitor can't recover a panic in another goroutine
+				if r := recover(); r != nil {
+					fmt.Printf("PANIC checking %s: %v\n%s", id, r, debug.Stack())
+					errs[i] = fmt.Errorf("%s: panicked: %v", id, r)
+				}
+				if errs[i] != nil {
+					results[i].Error = errs[i].Error()
+				}
+			}()
+
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				errs[i] = fmt.Errorf("%s: %w", id, ctx.Err())
+				return
+			}
+
+			fmt.Printf("Checking device %s\n", id)
+			if err := run(ctx, id, &results[i]); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", id, err)
+			}
+		}(i, id)
+	}
+	wg.Wait()
+
+	result.DeviceID = ""
+	result.Devices = results
+	for _, r := range results {
+		result.Notified = result.Notified || r.Notified
+		result.AutoClosed = result.AutoClosed || r.AutoClosed
+	}
+	return errors.Join(errs...)
+}
+
+// spokenName is how notifications refer to a device, e.g. "the workshop
+// door". A name set by voice wins over DEVICE_MAP.
+func spokenName(deviceID string) string {
+	friendlyNamesMu.RLock()
+	name := friendlyNames[deviceID]
+	friendlyNamesMu.RUnlock()
+	if name != "" {
+		return name
+	}
+	for _, device := range devices {
+		if device.ID != deviceID {
+			continue
+		}
+		if device.SpokenName != "" {
+			return device.SpokenName
+		}
+		if strings.HasSuffix(device.Name, "door") {
+			return "the " + device.Name
+		}
+		return "the " + device.Name + " door"
+	}
+	return defaultSpokenName
+}
+
+// ownedName drops the article so a name reads naturally after "Your"
+func ownedName(deviceID string) string {
+	return strings.TrimPrefix(spokenName(deviceID), "the ")
+}
+
+// particleIDPattern matches a Particle device ID, 24 hex characters
+var particleIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{24}$`)
+
+// normalizeDeviceID checks that PARTICLE_DEVICE_ID is a device ID rather than
+// a device name, which otherwise only shows up as 404s from Particle. With
+// resolve set, a name is looked up in the account's device list and the
+// resolved ID is returned for init() to keep for the life of the container.
+func normalizeDeviceID(value string, resolve bool) string {
+	value = strings.TrimSpace(value)
+	if value == "" || particleIDPattern.MatchString(value) {
+		return strings.ToLower(value)
+	}
+
+	if !resolve {
+		fmt.Printf("ERROR: PARTICLE_DEVICE_ID %q is not a 24-character device ID. Use the ID from the Particle console, or set PARTICLE_RESOLVE_DEVICE_NAME=true to look it up by name.\n", value)
+		return value
+	}
+
+	id, err := resolveDeviceName(value)
+	if err != nil {
+		fmt.Printf("ERROR: could not resolve Particle device name %q: %v\n", value, err)
+		return value
+	}
+
+	fmt.Printf("Resolved Particle device name %q to ID %s\n", value, id)
+	return id
+}
+
+// resolveDeviceName finds a device ID by name in the Particle device list
+func resolveDeviceName(name string) (string, error) {
+	// Runs in init(), so keep it from dragging out a cold start
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", particleAPIBase+"/devices", nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", particleAccessToken))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("particle API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var list []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return "", fmt.Errorf("error unmarshaling response: %w", err)
+	}
+
+	for _, device := range list {
+		if strings.EqualFold(device.Name, name) {
+			return device.ID, nil
+		}
+	}
+	return "", fmt.Errorf("no device named %q on this account", name)
+}
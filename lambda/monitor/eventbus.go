@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+)
+
+// Door transitions are also published to an EventBridge bus when
+// EVENT_BUS_NAME is set, so rules and other automation can react to them.
+// Both Lambdas publish, but only whichever claimed the transition in
+// shouldNotify, so each one is published once.
+const (
+	eventBusSource     = "garage-door"
+	eventBusDetailType = "Door Status Changed"
+)
+
+var (
+	eventBusName      string
+	eventBridgeClient *eventbridge.EventBridge // Only created when eventBusName is set
+)
+
+// DoorTransitionDetail is the detail of a transition event
+type DoorTransitionDetail struct {
+	DeviceID       string `json:"deviceId"`
+	Name           string `json:"name"` // Spoken name, e.g. "the garage door"
+	PreviousStatus string `json:"previousStatus"`
+	Status         string `json:"status"`
+	Timestamp      int64  `json:"timestamp"` // Unix timestamp of the transition
+	Source         string `json:"source"`    // Which component observed the transition
+}
+
+// publishTransition sends a transition to the event bus. Best-effort:
+// failures are only logged.
+func publishTransition(ctx context.Context, deviceID, previousStatus, status string, timestamp int64) {
+	if eventBridgeClient == nil {
+		return
+	}
+
+	detail, err := json.Marshal(DoorTransitionDetail{
+		DeviceID:       deviceID,
+		Name:           spokenName(deviceID),
+		PreviousStatus: previousStatus,
+		Status:         status,
+		Timestamp:      timestamp,
+		Source:         "monitor",
+	})
+	if err != nil {
+		fmt.Printf("Error marshaling transition event: %v\n", err)
+		return
+	}
+
+	out, err := eventBridgeClient.PutEventsWithContext(ctx, &eventbridge.PutEventsInput{
+		Entries: []*eventbridge.PutEventsRequestEntry{{
+			EventBusName: aws.String(eventBusName),
+			Source:       aws.String(eventBusSource),
+			DetailType:   aws.String(eventBusDetailType),
+			Detail:       aws.String(string(detail)),
+			Time:         aws.Time(time.Unix(timestamp, 0)),
+		}},
+	})
+	if err != nil {
+		fmt.Printf("Error publishing transition to %s: %v\n", eventBusName, err)
+		return
+	}
+	if aws.Int64Value(out.FailedEntryCount) > 0 {
+		entry := out.Entries[0]
+		fmt.Printf("Transition rejected by %s: %s %s\n", eventBusName, aws.StringValue(entry.ErrorCode), aws.StringValue(entry.ErrorMessage))
+		return
+	}
+	fmt.Printf("Published %s -> %s to %s\n", previousStatus, status, eventBusName)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// How long door events are kept before DynamoDB expires them
+const eventRetention = 90 * 24 * time.Hour
+
+// DoorEvent is one status transition in the events table
+type DoorEvent struct {
+	DeviceID       string `json:"deviceId"`
+	Timestamp      int64  `json:"timestamp"` // Unix timestamp of the transition
+	Status         string `json:"status"`
+	PreviousStatus string `json:"previousStatus,omitempty"`
+	Source         string `json:"source"`    // Which component observed the transition
+	ExpiresAt      int64  `json:"expiresAt"` // DynamoDB TTL attribute
+}
+
+// Failed event writes are buffered here and retried at the start of the next
+// invocation. The buffer only lives as long as the container, which is why
+// failures are also flagged on DoorState.EventLogGapSince.
+var (
+	pendingEventsMu sync.Mutex
+	pendingEvents   []DoorEvent
+
+	// eventsDropped is set once the queue overflows, since those events
+	// can never be replayed
+	eventsDropped bool
+
+	// eventLogRecovered is set when this invocation replayed every buffered
+	// event, so the gap marker on DoorState can be cleared
+	eventLogRecovered bool
+)
+
+// recordDoorEvent writes a transition to the events table. If the write
+// fails the event is queued for retry (when EVENT_RETRY_QUEUE_SIZE is set)
+// and state is marked so the gap in history is detectable.
+func recordDoorEvent(ctx context.Context, state *DoorState, previousStatus, status string, timestamp int64) {
+	if eventsTable == "" {
+		return
+	}
+
+	event := DoorEvent{
+		DeviceID:       state.DeviceID,
+		Timestamp:      timestamp,
+		Status:         status,
+		PreviousStatus: previousStatus,
+		Source:         "monitor",
+		ExpiresAt:      time.Unix(timestamp, 0).Add(eventRetention).Unix(),
+	}
+
+	if err := putDoorEvent(ctx, event); err != nil {
+		fmt.Printf("Error recording door event: %v\n", err)
+		if state.EventLogGapSince == 0 {
+			state.EventLogGapSince = timestamp
+		}
+		queuePendingEvent(event)
+	}
+}
+
+// queuePendingEvent buffers a failed event, dropping the oldest one when
+// the queue is full
+func queuePendingEvent(event DoorEvent) {
+	if eventRetryQueueSize <= 0 {
+		return
+	}
+
+	pendingEventsMu.Lock()
+	defer pendingEventsMu.Unlock()
+
+	if len(pendingEvents) >= eventRetryQueueSize {
+		fmt.Printf("Event retry queue full - dropping event from %d\n", pendingEvents[0].Timestamp)
+		pendingEvents = pendingEvents[1:]
+		eventsDropped = true
+	}
+	pendingEvents = append(pendingEvents, event)
+}
+
+// flushPendingEvents retries buffered event writes, keeping any that fail
+// again. Returns true if there were buffered events and all were written,
+// meaning the history gap they caused has been filled.
+func flushPendingEvents(ctx context.Context) bool {
+	pendingEventsMu.Lock()
+	defer pendingEventsMu.Unlock()
+
+	if len(pendingEvents) == 0 {
+		return false
+	}
+
+	fmt.Printf("Retrying %d pending door events\n", len(pendingEvents))
+
+	var remaining []DoorEvent
+	for i, event := range pendingEvents {
+		// Each replay is a retry, so stop once the invocation's budget is spent
+		if !allowRetry(ctx, 0) {
+			fmt.Printf("Retry budget spent - leaving %d events for later\n", len(pendingEvents)-i)
+			remaining = append(remaining, pendingEvents[i:]...)
+			break
+		}
+		start := time.Now()
+		if err := putDoorEvent(ctx, event); err != nil {
+			fmt.Printf("Error retrying door event: %v\n", err)
+			remaining = append(remaining, event)
+		}
+		chargeRetry(ctx, time.Since(start))
+	}
+	pendingEvents = remaining
+
+	return len(pendingEvents) == 0 && !eventsDropped
+}
+
+// putDoorEvent writes a single event item
+func putDoorEvent(ctx context.Context, event DoorEvent) error {
+	item, err := dynamodbattribute.MarshalMap(event)
+	if err != nil {
+		return fmt.Errorf("error marshaling event: %w", err)
+	}
+
+	_, err = dynamoClient.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(eventsTable),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("error putting event to DynamoDB: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testEventsTable is the events table while event logging is on in a test
+const testEventsTable = "door-events"
+
+// useEventQueue turns on event logging with a retry queue of size, starting
+// empty, for the length of the test
+func useEventQueue(t *testing.T, size int) {
+	t.Helper()
+	table, queueSize := eventsTable, eventRetryQueueSize
+	eventsTable, eventRetryQueueSize = testEventsTable, size
+	resetEventQueue := func() {
+		pendingEventsMu.Lock()
+		pendingEvents, eventsDropped, eventLogRecovered = nil, false, false
+		pendingEventsMu.Unlock()
+	}
+	resetEventQueue()
+	t.Cleanup(func() {
+		eventsTable, eventRetryQueueSize = table, queueSize
+		resetEventQueue()
+	})
+}
+
+// pendingTimestamps are the timestamps of the queued events, oldest first
+func pendingTimestamps() []int64 {
+	pendingEventsMu.Lock()
+	defer pendingEventsMu.Unlock()
+	var timestamps []int64
+	for _, event := range pendingEvents {
+		timestamps = append(timestamps, event.Timestamp)
+	}
+	return timestamps
+}
+
+// writtenTimestamps are the timestamps of the events written to the events
+// table, in the order they were written
+func (db *fakeDynamoDB) writtenTimestamps() []int64 {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var timestamps []int64
+	for _, item := range db.puts[testEventsTable] {
+		var event struct{ Timestamp struct{ N string } }
+		json.Unmarshal(item, &event)
+		timestamp, _ := strconv.ParseInt(event.Timestamp.N, 10, 64)
+		timestamps = append(timestamps, timestamp)
+	}
+	return timestamps
+}
+
+func TestEventQueueDropsOldestWhenFull(t *testing.T) {
+	db := fakeDoorState(t)
+	useEventQueue(t, 3)
+	db.failTable(testEventsTable, "InternalServerError")
+
+	state := &DoorState{DeviceID: "dev1"}
+	for timestamp := int64(1); timestamp <= 5; timestamp++ {
+		recordDoorEvent(context.Background(), state, "closed", "open", timestamp)
+	}
+	if got := pendingTimestamps(); !reflect.DeepEqual(got, []int64{3, 4, 5}) {
+		t.Errorf("queued = %v, want the newest 3", got)
+	}
+	if state.EventLogGapSince != 1 {
+		t.Errorf("EventLogGapSince = %d, want the first failed write, 1", state.EventLogGapSince)
+	}
+
+	// The dropped events can't be replayed, so the gap stays
+	db.failTable(testEventsTable, "")
+	if flushPendingEvents(context.Background()) {
+		t.Error("flush after an overflow reported the gap filled")
+	}
+	if got := db.writtenTimestamps(); !reflect.DeepEqual(got, []int64{3, 4, 5}) {
+		t.Errorf("replayed = %v, want the queued events", got)
+	}
+}
+
+func TestEventQueueReplaysInOrder(t *testing.T) {
+	db := fakeDoorState(t)
+	useEventQueue(t, 5)
+	db.failTable(testEventsTable, "InternalServerError")
+
+	state := &DoorState{DeviceID: "dev1"}
+	for _, timestamp := range []int64{10, 20, 30} {
+		recordDoorEvent(context.Background(), state, "closed", "open", timestamp)
+	}
+	// Still failing, so every event stays queued in its place
+	if flushPendingEvents(context.Background()) {
+		t.Error("failed flush reported the gap filled")
+	}
+
+	db.failTable(testEventsTable, "")
+	if !flushPendingEvents(context.Background()) {
+		t.Error("flush didn't report the gap filled")
+	}
+	if got := db.writtenTimestamps(); !reflect.DeepEqual(got, []int64{10, 20, 30}) {
+		t.Errorf("replayed = %v, want oldest first", got)
+	}
+	if got := pendingTimestamps(); len(got) != 0 {
+		t.Errorf("still queued: %v", got)
+	}
+}
+
+// TestEventLogGapClearsAfterFlush fails the write of a door's opening, then
+// runs the monitor again once the events table is back. The replay fills
+// the gap, so the next check clears the marker.
+func TestEventLogGapClearsAfterFlush(t *testing.T) {
+	status := "open"
+	_, check := monitorDoor(t, &status)
+	db := fakeDoorState(t) // In place of monitorDoor's, to fail the events table
+	useEventQueue(t, 5)
+	saved := particleDeviceID
+	particleDeviceID = "dev1"
+	defer func() { particleDeviceID = saved }()
+
+	opened := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	db.failTable(testEventsTable, "InternalServerError")
+	check(opened)
+	state, err := getDoorState(context.Background(), "dev1")
+	if err != nil || state.EventLogGapSince != opened.Unix() {
+		t.Fatalf("state = %+v, %v; want the gap marked from the failed write", state, err)
+	}
+
+	db.failTable(testEventsTable, "")
+	fixClock(t, opened.Add(5*time.Minute))
+	if _, err := HandleMonitor(context.Background(), MonitorEvent{Mode: modeCheck}); err != nil {
+		t.Fatalf("HandleMonitor: %v", err)
+	}
+	if got := db.writtenTimestamps(); !reflect.DeepEqual(got, []int64{opened.Unix()}) {
+		t.Errorf("events written = %v, want the replayed opening", got)
+	}
+	state, err = getDoorState(context.Background(), "dev1")
+	if err != nil || state.EventLogGapSince != 0 {
+		t.Errorf("state = %+v, %v; want the gap cleared", state, err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// {"mode":"export","days":7} writes every monitored door's recent events to
+// EXPORT_BUCKET as CSV ({"format":"json"} for JSON), oldest first, and
+// returns a presigned link to download it.
+
+var (
+	exportBucket string
+	s3Client     *s3.S3
+)
+
+const (
+	exportDefaultDays = 7
+	exportMaxDays     = 90 // Events expire after 90 days, so there is nothing older
+	exportURLTTL      = time.Hour
+)
+
+// exportRow is one event in an export
+type exportRow struct {
+	DeviceID       string `json:"deviceId"`
+	Time           string `json:"time"` // In NOTIFICATION_TZ
+	Timestamp      int64  `json:"timestamp"`
+	Status         string `json:"status"`
+	PreviousStatus string `json:"previousStatus,omitempty"`
+	Source         string `json:"source"`
+}
+
+// runExport uploads the last days of events and puts the download link on
+// the result
+func runExport(ctx context.Context, days int, format string, result *MonitorResult) error {
+	if exportBucket == "" {
+		return fmt.Errorf("EXPORT_BUCKET not configured")
+	}
+	if eventsTable == "" {
+		return fmt.Errorf("EVENTS_TABLE not configured")
+	}
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		return fmt.Errorf("unknown export format: %s", format)
+	}
+	if days <= 0 {
+		days = exportDefaultDays
+	}
+	if days > exportMaxDays {
+		fmt.Printf("Export of %d days capped at %d\n", days, exportMaxDays)
+		days = exportMaxDays
+	}
+
+	ids := monitoredDevices()
+	if len(ids) == 0 {
+		return fmt.Errorf("no devices configured: set PARTICLE_DEVICE_ID or DEVICE_MAP")
+	}
+
+	current := now()
+	var events []DoorEvent
+	for _, id := range ids {
+		deviceEvents, err := queryDoorEvents(ctx, id, current.AddDate(0, 0, -days))
+		if err != nil {
+			return fmt.Errorf("%s: %w", id, err)
+		}
+		events = append(events, deviceEvents...)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp < events[j].Timestamp })
+
+	rows := make([]exportRow, 0, len(events))
+	for _, event := range events {
+		rows = append(rows, exportRow{
+			DeviceID:       event.DeviceID,
+			Time:           time.Unix(event.Timestamp, 0).In(localTimezone).Format(time.RFC3339),
+			Timestamp:      event.Timestamp,
+			Status:         event.Status,
+			PreviousStatus: event.PreviousStatus,
+			Source:         event.Source,
+		})
+	}
+
+	body, contentType, err := encodeExport(rows, format)
+	if err != nil {
+		return err
+	}
+
+	// A single door keeps its own folder; several share one file
+	folder := "all"
+	if len(ids) == 1 {
+		folder = ids[0]
+	}
+	key := fmt.Sprintf("exports/%s/%s-%dd.%s", folder, current.In(localTimezone).Format("20060102-150405"), days, format)
+	if _, err := s3Client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(exportBucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String(contentType),
+	}); err != nil {
+		return fmt.Errorf("error uploading export to S3: %w", err)
+	}
+
+	req, _ := s3Client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(exportBucket),
+		Key:    aws.String(key),
+	})
+	url, err := req.Presign(exportURLTTL)
+	if err != nil {
+		return fmt.Errorf("error presigning export URL: %w", err)
+	}
+
+	fmt.Printf("Exported %d events over %d days to s3://%s/%s\n", len(rows), days, exportBucket, key)
+	result.ExportURL = url
+	result.Summary = fmt.Sprintf("%d events over the last %d days; the link expires in %s", len(rows), days, exportURLTTL)
+	return nil
+}
+
+// encodeExport renders the rows as CSV with a header, or as a JSON list
+func encodeExport(rows []exportRow, format string) ([]byte, string, error) {
+	if format == "json" {
+		body, err := json.MarshalIndent(rows, "", "  ")
+		if err != nil {
+			return nil, "", fmt.Errorf("error encoding export: %w", err)
+		}
+		return body, "application/json", nil
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"device_id", "time", "timestamp", "status", "previous_status", "source"})
+	for _, row := range rows {
+		w.Write([]string{row.DeviceID, row.Time, strconv.FormatInt(row.Timestamp, 10), row.Status, row.PreviousStatus, row.Source})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, "", fmt.Errorf("error encoding export: %w", err)
+	}
+	return buf.Bytes(), "text/csv", nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// configItemID is the door state table key of the feature flag item, which
+// can be edited in the console to change behavior without a redeploy
+const configItemID = "config"
+
+// userPrefsPrefix starts the keys of the skill's per-user preference items,
+// which share the door state table
+const userPrefsPrefix = "user#"
+
+// FeatureFlags override env settings. A nil flag isn't set in the item, so
+// the env setting applies. Mirrors the skill's copy, which reads the same item.
+type FeatureFlags struct {
+	AutoCloseEnabled     *bool `json:"autoCloseEnabled,omitempty"`
+	ConfirmationRequired *bool `json:"confirmationRequired,omitempty"`
+	MaintenanceMode      *bool `json:"maintenanceMode,omitempty"`
+	Away                 *bool `json:"away,omitempty"` // Nobody is home, e.g. set by home automation
+}
+
+// featureFlags caches the config item for FLAGS_TTL_SECONDS
+var featureFlags *cachedValue[FeatureFlags]
+
+// currentFlags returns the cached flags, reading the config item when they
+// expire. A missing item or a failed read leaves every flag unset.
+func currentFlags(ctx context.Context) FeatureFlags {
+	if featureFlags == nil || doorStateTable == "" {
+		return FeatureFlags{}
+	}
+
+	flags, _, err := featureFlags.Get(func() (FeatureFlags, error) {
+		return loadFeatureFlags(ctx)
+	})
+	if err != nil {
+		fmt.Printf("Error loading feature flags (using env settings): %v\n", err)
+		return FeatureFlags{}
+	}
+	return flags
+}
+
+// loadFeatureFlags reads the config item from the door state table
+func loadFeatureFlags(ctx context.Context) (FeatureFlags, error) {
+	result, err := dynamoClient.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(doorStateTable),
+		Key:       stateKey(configItemID),
+	})
+	if err != nil {
+		return FeatureFlags{}, fmt.Errorf("error getting config item from DynamoDB: %w", err)
+	}
+
+	var flags FeatureFlags
+	if result.Item == nil {
+		return flags, nil
+	}
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &flags); err != nil {
+		return FeatureFlags{}, fmt.Errorf("error unmarshaling config item: %w", err)
+	}
+	return flags, nil
+}
+
+// applyFeatureFlags resolves the flags for this run over their env settings.
+// Runs don't overlap within a container, so the package settings can be
+// updated in place.
+func applyFeatureFlags(ctx context.Context) {
+	flags := currentFlags(ctx)
+	maintenanceMode = flagOr(flags.MaintenanceMode, maintenanceModeEnv)
+	autoCloseEnabled = flagOr(flags.AutoCloseEnabled, true)
+	fmt.Printf("Feature flags: %s\n", describeFlags(flags))
+}
+
+// flagOr returns a flag's value, or fallback when it isn't set
+func flagOr(flag *bool, fallback bool) bool {
+	if flag == nil {
+		return fallback
+	}
+	return *flag
+}
+
+// describeFlags renders the set flags for logging
+func describeFlags(flags FeatureFlags) string {
+	described := ""
+	for _, flag := range []struct {
+		name  string
+		value *bool
+	}{
+		{"autoCloseEnabled", flags.AutoCloseEnabled},
+		{"confirmationRequired", flags.ConfirmationRequired},
+		{"maintenanceMode", flags.MaintenanceMode},
+		{"away", flags.Away},
+	} {
+		if flag.value != nil {
+			described += fmt.Sprintf(" %s=%t", flag.name, *flag.value)
+		}
+	}
+	if described == "" {
+		return "none set"
+	}
+	return described[1:]
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureOutput returns what run prints to stdout
+func captureOutput(t *testing.T, run func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe: %v", err)
+	}
+	saved := os.Stdout
+	os.Stdout = w
+	done := make(chan string)
+	go func() {
+		var out bytes.Buffer
+		io.Copy(&out, r)
+		done <- out.String()
+	}()
+
+	run()
+	os.Stdout = saved
+	w.Close()
+	return <-done
+}
+
+// TestPanickingRunStillLogsSummary runs a check without a DynamoDB client,
+// which panics on the state read. The run must fail rather than crash, and
+// still log its summary line with the error.
+func TestPanickingRunStillLogsSummary(t *testing.T) {
+	status := "open"
+	fakeParticle(t, &status)
+	saved, savedDevice, savedTable := dynamoClient, particleDeviceID, doorStateTable
+	dynamoClient, particleDeviceID, doorStateTable = nil, "dev1", "door-state"
+	defer func() { dynamoClient, particleDeviceID, doorStateTable = saved, savedDevice, savedTable }()
+
+	var err error
+	out := captureOutput(t, func() {
+		_, err = HandleMonitor(context.Background(), MonitorEvent{Mode: modeCheck})
+	})
+	if err == nil || !strings.Contains(err.Error(), "panicked") {
+		t.Errorf("HandleMonitor error = %v, want the panic", err)
+	}
+	if !strings.Contains(out, "PANIC in check run") {
+		t.Errorf("log is missing the panic:\n%s", out)
+	}
+
+	var summary *MonitorResult
+	for _, line := range strings.Split(out, "\n") {
+		var result MonitorResult
+		if json.Unmarshal([]byte(line), &result) == nil && result.Mode == modeCheck {
+			summary = &result
+		}
+	}
+	if summary == nil {
+		t.Fatalf("no summary line logged:\n%s", out)
+	}
+	if summary.DeviceID != "dev1" || !strings.Contains(summary.Error, "panicked") {
+		t.Errorf("summary = %+v, want dev1 with the panic as its error", *summary)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// openSession is one stretch of the door being open, from a pair of events
+type openSession struct {
+	Opened    time.Time
+	Closed    time.Time // When it closed, or now if StillOpen
+	StillOpen bool
+}
+
+// Duration is how long the session lasted, or has lasted so far
+func (s openSession) Duration() time.Duration {
+	return s.Closed.Sub(s.Opened)
+}
+
+// queryDoorEvents returns a device's events since a time, oldest first
+func queryDoorEvents(ctx context.Context, deviceID string, since time.Time) ([]DoorEvent, error) {
+	var events []DoorEvent
+	var unmarshalErr error
+
+	err := dynamoClient.QueryPagesWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(eventsTable),
+		KeyConditionExpression: aws.String("deviceId = :id AND #ts >= :since"),
+		ExpressionAttributeNames: map[string]*string{
+			"#ts": aws.String("timestamp"), // A reserved word
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":id":    {S: aws.String(deviceID)},
+			":since": {N: aws.String(fmt.Sprint(since.Unix()))},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		var pageEvents []DoorEvent
+		if err := dynamodbattribute.UnmarshalListOfMaps(page.Items, &pageEvents); err != nil {
+			unmarshalErr = err
+			return false
+		}
+		events = append(events, pageEvents...)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error querying events from DynamoDB: %w", err)
+	}
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("error unmarshaling events: %w", unmarshalErr)
+	}
+	return events, nil
+}
+
+// pairOpenSessions mirrors the skill's copy. It pairs each open event with the close that follows it.
+// A close with no open before it in the window started before the window,
+// so its length isn't known and it is skipped. Repeated opens keep the
+// first, and an open with no close yet is still open as of now.
+func pairOpenSessions(events []DoorEvent, current time.Time) []openSession {
+	var sessions []openSession
+	var opened time.Time
+	for _, event := range events {
+		switch event.Status {
+		case "open":
+			if opened.IsZero() {
+				opened = time.Unix(event.Timestamp, 0)
+			}
+		case "closed":
+			if !opened.IsZero() {
+				sessions = append(sessions, openSession{Opened: opened, Closed: time.Unix(event.Timestamp, 0)})
+				opened = time.Time{}
+			}
+		}
+	}
+	if !opened.IsZero() {
+		sessions = append(sessions, openSession{Opened: opened, Closed: current, StillOpen: true})
+	}
+	return sessions
+}
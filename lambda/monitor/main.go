@@ -1,61 +1,255 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"os"
+	"runtime/debug"
 	"strconv"
+	"strings"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/sns"
 )
 
-// Particle API configuration
+// particleAPIBase is the Particle cloud API root. PARTICLE_API_BASE overrides
+// it, e.g. to point at a mock server or proxy.
+var particleAPIBase = "https://api.particle.io/v1"
+
+// Monitor modes selected by the scheduled event's input
 const (
-	particleAPIBase = "https://api.particle.io/v1"
+	modeCheck        = "check"
+	modeNightlyClose = "nightly_close"
+	modeMigrate      = "migrate"
+	modeSelfTest     = "selftest"
+	modeTestNotify   = "test_notification"
+	modeMorning      = "morning_report"
+	modeExport       = "export"
 )
 
+// httpClient is shared by all Particle calls so warm invocations reuse its
+// pooled connections
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
 // Environment variables
 var (
-	particleAccessToken string
-	particleDeviceID    string
-	doorStateTable      string
-	notificationTopicARN string
-	thresholdMinutes    int
-	dynamoClient        *dynamodb.DynamoDB
-	snsClient           *sns.SNS
+	particleAccessToken   string
+	particleDeviceID      string
+	doorStateTable        string
+	eventsTable           string
+	eventRetryQueueSize   int
+	notifyDedupWindow     int64
+	notificationTopicARN  string
+	fallbackTopicARN      string
+	alertingEnabled       bool
+	thresholdMinutes      int
+	sensorGraceMinutes    int
+	statusVariable        string
+	openPositionMin       int
+	maintenanceMode       bool // MAINTENANCE_MODE, or the maintenanceMode flag for this run
+	maintenanceModeEnv    bool
+	autoCloseEnabled      bool // The autoCloseEnabled flag for this run
+	autoCloseMinutes      int
+	autoCloseMaxAttempts  int
+	autoCloseBackoff      time.Duration
+	localTimezone         *time.Location
+	maxReasonableOpenMins int
+	pollJitter            time.Duration
+	closeLinkSecret       string
+	closeLinkBaseURL      string
+	closeLinkTTL          time.Duration
+	closeVerifyDelay      time.Duration
+	closeVerifyTimeout    time.Duration
+	closePollInterval     time.Duration
+	dynamoClient          *dynamodb.DynamoDB
+	snsClient             *sns.SNS
+	fallbackSNSClient     *sns.SNS
 )
 
 // DoorState represents the state stored in DynamoDB
 type DoorState struct {
-	DeviceID          string `json:"deviceId"`
-	Status            string `json:"status"`            // "open", "closed", "moving", "unknown"
-	LastChecked       int64  `json:"lastChecked"`       // Unix timestamp
-	LastOpenedTime    int64  `json:"lastOpenedTime"`    // Unix timestamp when door was last opened
-	LastClosedTime    int64  `json:"lastClosedTime"`    // Unix timestamp when door was last closed
-	NotificationSent  bool   `json:"notificationSent"`  // Whether notification was sent for current open session
-	DurationOpenMins  int64  `json:"durationOpenMins"`  // Minutes door has been open
+	DeviceID           string `json:"deviceId"`
+	Status             string `json:"status"`                       // "open", "closed", "moving", "unknown"
+	LastChecked        int64  `json:"lastChecked"`                  // Unix timestamp
+	LastOpenedTime     int64  `json:"lastOpenedTime"`               // Unix timestamp when door was last opened
+	LastClosedTime     int64  `json:"lastClosedTime"`               // Unix timestamp when door was last closed
+	NotificationSent   bool   `json:"notificationSent"`             // Whether notification was sent for current open session
+	DurationOpenMins   int64  `json:"durationOpenMins"`             // Minutes door has been open
+	EventLogGapSince   int64  `json:"eventLogGapSince,omitempty"`   // Unix timestamp of the first event write that failed
+	UnknownSince       int64  `json:"unknownSince,omitempty"`       // Unix timestamp the sensor started reporting unknown
+	SensorAlertSent    bool   `json:"sensorAlertSent,omitempty"`    // Whether the sensor problem notification was sent
+	LastNotifiedKey    string `json:"lastNotifiedKey,omitempty"`    // Signature of the last transition reported, shared with the skill
+	SnoozeUntil        int64  `json:"snoozeUntil,omitempty"`        // Unix timestamp until which open-door alerts are silenced
+	SuppressAlertUntil int64  `json:"suppressAlertUntil,omitempty"` // Unix timestamp before which this open session's alert is held off
+
+	// Added in schema version 1; see applyStateDefaults
+	SchemaVersion      int  `json:"schemaVersion,omitempty"`      // DoorState layout the item was written with
+	AlertThresholdMins int  `json:"alertThresholdMins,omitempty"` // Minutes open before alerting, per door
+	MaintenanceMode    bool `json:"maintenanceMode,omitempty"`    // Disable automated actions for this door only
+
+	CloseLinkNonce string `json:"closeLinkNonce,omitempty"` // Nonce of the unused close link in the last alert
+
+	// Recipients alerted this open session, by name; see NOTIFICATION_RECIPIENTS
+	RecipientsNotified map[string]bool `json:"recipientsNotified,omitempty"`
+
+	AutoCloseAttempts        int   `json:"autoCloseAttempts,omitempty"`        // Auto-close presses this open session
+	LastAutoCloseAttempt     int64 `json:"lastAutoCloseAttempt,omitempty"`     // Unix timestamp of the last auto-close press
+	ManualInterventionNeeded bool  `json:"manualInterventionNeeded,omitempty"` // Auto-close gave up; cleared when the door closes
+
+	RelayAlreadyActiveCount int64 `json:"relayAlreadyActiveCount,omitempty"` // Consecutive "already active" presses from the skill
+
+	FriendlyName string `json:"friendlyName,omitempty"` // Spoken name set by voice, used over DEVICE_MAP
+
+	ObstructionAlertSent bool `json:"obstructionAlertSent,omitempty"` // A close was blocked by an obstruction this open session
+
+	AutoCloseDeferredSince int64 `json:"autoCloseDeferredSince,omitempty"` // Unix timestamp auto-close was first held off for motion
+
+	AwayAlertSent bool `json:"awayAlertSent,omitempty"` // The door-open-while-away alert went out this open session
+
+	AllClearPending bool `json:"allClearPending,omitempty"` // The door closed after an open-too-long alert; the all-clear is still to send
+
+	PushedAt int64 `json:"pushedAt,omitempty"` // Last status pushed by the Particle webhook; see the skill
+
+	OpenAnnounced bool `json:"openAnnounced,omitempty"` // The open announcement went out this open session
+
+	AssumedStatus string `json:"assumedStatus,omitempty"` // Guessed from presses without a sensor; see the skill
+
+	PendingStatus string `json:"pendingStatus,omitempty"` // A change still settling; see STATUS_STABLE_RUNS
+	PendingSince  int64  `json:"pendingSince,omitempty"`  // Unix timestamp PendingStatus was first seen
+	PendingRuns   int    `json:"pendingRuns,omitempty"`   // Consecutive runs PendingStatus has been seen
+
+	AlertSeverity string `json:"alertSeverity,omitempty"` // Severity of the last open-door alert this open session; see ALERT_SEVERITY_BANDS
+}
+
+// MonitorEvent is the input from EventBridge; scheduled rules set Mode via
+// their constant input, plain scheduled events leave it empty
+type MonitorEvent struct {
+	Mode string `json:"mode"`
+
+	// For export runs
+	Days   int    `json:"days,omitempty"`
+	Format string `json:"format,omitempty"`
+}
+
+// MonitorResult summarizes one run. It is logged as a single JSON line for
+// Logs Insights and returned to synchronous callers.
+type MonitorResult struct {
+	Mode         string `json:"mode"`
+	Status       string `json:"status,omitempty"` // Door status at the end of the run
+	DurationMins int64  `json:"durationMins"`     // Minutes open, if open
+	Notified     bool   `json:"notified"`         // An open-door or sensor alert was sent
+	AutoClosed   bool   `json:"autoClosed"`       // The monitor pressed the button to close the door
+	Error        string `json:"error,omitempty"`
+
+	OpenRatio *float64 `json:"openRatio,omitempty"` // Fraction of the past 24 hours open, when metrics are on
+
+	DeviceID string          `json:"device,omitempty"`
+	Devices  []MonitorResult `json:"devices,omitempty"` // Each door's result, when a run covers more than one
+
+	// Time spent waiting on Particle and DynamoDB, and in the whole run
+	ParticleMs int64 `json:"particleMs"`
+	DynamoMs   int64 `json:"dynamoMs"`
+	DurationMs int64 `json:"durationMs"`
+
+	// Set by selftest runs; Summary also by morning reports and exports
+	Checks  []SelfTestCheck `json:"checks,omitempty"`
+	Summary string          `json:"summary,omitempty"`
+
+	ExportURL string `json:"exportUrl,omitempty"` // Presigned download link, for export runs
 }
 
+// errDeviceNotResponding means Particle answered but the device didn't, which
+// Particle reports as a 200 with an error field, e.g. {"error":"Timed out."}
+var errDeviceNotResponding = errors.New("device did not respond")
+
 // Particle variable response
 type ParticleVariableResponse struct {
-	Result string `json:"result"`
-	Error  string `json:"error,omitempty"`
+	Result json.RawMessage `json:"result"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Particle function response
+type ParticleFunctionResponse struct {
+	ID          string `json:"id"`
+	Connected   bool   `json:"connected"`
+	ReturnValue int    `json:"return_value"`
+	Error       string `json:"error,omitempty"`
 }
 
 func init() {
+	if raw := os.Getenv("PARTICLE_API_BASE"); raw != "" {
+		if base, err := parseAPIBase(raw); err != nil {
+			fmt.Printf("WARNING: %v - using %s\n", err, particleAPIBase)
+		} else {
+			particleAPIBase = base
+			fmt.Printf("Particle API base: %s\n", particleAPIBase)
+		}
+	}
 	particleAccessToken = os.Getenv("PARTICLE_ACCESS_TOKEN")
-	particleDeviceID = os.Getenv("PARTICLE_DEVICE_ID")
+	if err := configureProxy(os.Getenv("PARTICLE_PROXY_URL")); err != nil {
+		fmt.Printf("WARNING: %v\n", err)
+	}
+	httpClient.Transport = breakerTransport{base: timedTransport{base: httpClient.Transport}, breaker: particleBreaker}
+	particleBreaker.threshold = 5
+	if n, err := strconv.Atoi(os.Getenv("PARTICLE_BREAKER_THRESHOLD")); err == nil && n >= 0 {
+		particleBreaker.threshold = n
+	}
+	particleBreaker.cooldown = 30 * time.Second
+	if secs, err := strconv.Atoi(os.Getenv("PARTICLE_BREAKER_COOLDOWN_SECONDS")); err == nil && secs > 0 {
+		particleBreaker.cooldown = time.Duration(secs) * time.Second
+	}
+	particleDeviceID = normalizeDeviceID(os.Getenv("PARTICLE_DEVICE_ID"), os.Getenv("PARTICLE_RESOLVE_DEVICE_NAME") == "true")
+
+	var err error
+	devices, err = loadDeviceMap(os.Getenv("DEVICE_MAP"))
+	if err != nil {
+		fmt.Printf("WARNING: ignoring DEVICE_MAP: %v\n", err)
+	}
+	if n, err := strconv.Atoi(os.Getenv("MAX_CONCURRENT_DEVICE_CALLS")); err == nil && n > 0 {
+		maxDeviceChecks = n
+	}
 	doorStateTable = os.Getenv("DOOR_STATE_TABLE")
+	if name := os.Getenv("STATE_KEY_NAME"); name != "" {
+		stateKeyName = name
+	}
 	notificationTopicARN = os.Getenv("NOTIFICATION_TOPIC_ARN")
+	fallbackTopicARN = os.Getenv("NOTIFICATION_TOPIC_ARN_FALLBACK")
+	strictTopicValidation = os.Getenv("TOPIC_VALIDATION") == "strict"
+	verifyTopicsAtStartup = os.Getenv("VERIFY_TOPICS") == "true"
+	eventsTable = os.Getenv("EVENTS_TABLE")
+	eventRetryQueueSize, _ = strconv.Atoi(os.Getenv("EVENT_RETRY_QUEUE_SIZE"))
+	retryBudgetTotal = 10 * time.Second
+	if ms, err := strconv.Atoi(os.Getenv("RETRY_BUDGET_MS")); err == nil && ms >= 0 {
+		retryBudgetTotal = time.Duration(ms) * time.Millisecond
+	}
+	dynamoMaxRetries = client.DefaultRetryerMaxNumRetries
+	if n, err := strconv.Atoi(os.Getenv("DYNAMODB_MAX_RETRIES")); err == nil && n >= 0 {
+		dynamoMaxRetries = n
+	}
+	dynamoMaxThrottleDelay = time.Second
+	if ms, err := strconv.Atoi(os.Getenv("DYNAMODB_MAX_THROTTLE_DELAY_MS")); err == nil && ms > 0 {
+		dynamoMaxThrottleDelay = time.Duration(ms) * time.Millisecond
+	}
+
+	notifyDedupWindow = 300
+	if secs, err := strconv.ParseInt(os.Getenv("NOTIFY_DEDUP_WINDOW_SECONDS"), 10, 64); err == nil && secs >= 0 {
+		notifyDedupWindow = secs
+	}
 
 	thresholdStr := os.Getenv("THRESHOLD_MINUTES")
 	if thresholdStr == "" {
@@ -68,12 +262,243 @@ func init() {
 		}
 	}
 
+	obstructionVariable = "obstructed"
+	if name, ok := os.LookupEnv("OBSTRUCTION_VAR"); ok {
+		obstructionVariable = name
+	}
+
+	statusVariable = os.Getenv("PARTICLE_STATUS_VAR")
+	if statusVariable == "" {
+		statusVariable = "doorStatus"
+	}
+	openPositionMin, _ = strconv.Atoi(os.Getenv("OPEN_POSITION_THRESHOLD"))
+	if statusMap, err = loadStatusMap(os.Getenv("STATUS_MAP")); err != nil {
+		fmt.Printf("WARNING: ignoring STATUS_MAP: %v\n", err)
+	}
+
+	sensorGraceMinutes = 30
+	if graceStr := os.Getenv("SENSOR_FAULT_GRACE_MINUTES"); graceStr != "" {
+		if mins, err := strconv.Atoi(graceStr); err == nil && mins >= 0 {
+			sensorGraceMinutes = mins
+		}
+	}
+
+	maintenanceModeEnv = os.Getenv("MAINTENANCE_MODE") == "true"
+	maintenanceMode = maintenanceModeEnv
+	autoCloseEnabled = true
+	autoCloseMinutes, _ = strconv.Atoi(os.Getenv("AUTO_CLOSE_MINUTES"))
+	autoCloseMaxAttempts = 3
+	if attempts, err := strconv.Atoi(os.Getenv("AUTO_CLOSE_MAX_ATTEMPTS")); err == nil && attempts > 0 {
+		autoCloseMaxAttempts = attempts
+	}
+	autoCloseBackoff = 30 * time.Minute
+	if mins, err := strconv.Atoi(os.Getenv("AUTO_CLOSE_BACKOFF_MINUTES")); err == nil && mins >= 0 {
+		autoCloseBackoff = time.Duration(mins) * time.Minute
+	}
+
+	if secs, err := strconv.Atoi(os.Getenv("POLL_JITTER_SECONDS")); err == nil && secs > 0 {
+		pollJitter = time.Duration(secs) * time.Second
+	}
+
+	localTimezone = time.UTC
+	if tz := os.Getenv("NOTIFICATION_TZ"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			fmt.Printf("WARNING: invalid NOTIFICATION_TZ %q, using UTC: %v\n", tz, err)
+		} else {
+			localTimezone = loc
+		}
+	}
+
+	for name, value := range map[string]*int{"OVERNIGHT_START": &overnightStart, "OVERNIGHT_END": &overnightEnd} {
+		if raw := os.Getenv(name); raw != "" {
+			if mins, err := parseClock(raw); err != nil {
+				fmt.Printf("WARNING: ignoring %s: %v\n", name, err)
+			} else {
+				*value = mins
+			}
+		}
+	}
+	if overnightStart == overnightEnd {
+		fmt.Println("WARNING: OVERNIGHT_START and OVERNIGHT_END are the same - using 22:00 to 06:00")
+		overnightStart, overnightEnd = 22*60, 6*60
+	}
+
+	thresholdSchedule, err = loadThresholdSchedule(os.Getenv("THRESHOLD_SCHEDULE"))
+	if err != nil {
+		fmt.Printf("WARNING: ignoring THRESHOLD_SCHEDULE: %v\n", err)
+	}
+	for _, profile := range thresholdSchedule {
+		fmt.Printf("Threshold profile %q: %v %s-%s, %d minutes\n", profile.Name, profile.Days, profile.Start, profile.End, profile.ThresholdMinutes)
+	}
+
+	maxReasonableOpenMins = 10080 // A week
+	if mins, err := strconv.Atoi(os.Getenv("MAX_REASONABLE_OPEN_MINS")); err == nil && mins >= 0 {
+		maxReasonableOpenMins = mins
+	}
+
+	metricsNamespace = os.Getenv("METRICS_NAMESPACE")
+
+	temperatureVariable = os.Getenv("TEMPERATURE_VAR")
+	if temperatureVariable != "" {
+		coldTemperature = 32
+		if value, err := strconv.ParseFloat(os.Getenv("COLD_TEMPERATURE"), 64); err == nil {
+			coldTemperature = value
+		}
+		coldThresholdMinutes = 30
+		if mins, err := strconv.Atoi(os.Getenv("COLD_THRESHOLD_MINUTES")); err == nil && mins > 0 {
+			coldThresholdMinutes = mins
+		}
+	}
+
+	closeLinkSecret = os.Getenv("CLOSE_LINK_SECRET")
+	closeLinkBaseURL = os.Getenv("CLOSE_LINK_BASE_URL")
+	closeLinkTTL = time.Hour
+	if mins, err := strconv.Atoi(os.Getenv("CLOSE_LINK_TTL_MINUTES")); err == nil && mins > 0 {
+		closeLinkTTL = time.Duration(mins) * time.Minute
+	}
+
+	closeVerifyDelay = 5 * time.Second
+	if delayStr := os.Getenv("CLOSE_VERIFY_DELAY_SECONDS"); delayStr != "" {
+		if secs, err := strconv.Atoi(delayStr); err == nil && secs >= 0 {
+			closeVerifyDelay = time.Duration(secs) * time.Second
+		}
+	}
+	closeVerifyTimeout = 30 * time.Second
+	if secs, err := strconv.Atoi(os.Getenv("CLOSE_VERIFY_TIMEOUT_SECONDS")); err == nil && secs > 0 {
+		closeVerifyTimeout = time.Duration(secs) * time.Second
+	}
+	announceOnOpen = os.Getenv("ANNOUNCE_ON_OPEN") == "true"
+	alexaClientID = os.Getenv("ALEXA_CLIENT_ID")
+	alexaClientSecret = os.Getenv("ALEXA_CLIENT_SECRET")
+	if announceOnOpen && (alexaClientID == "" || alexaClientSecret == "") {
+		fmt.Println("WARNING: ANNOUNCE_ON_OPEN needs ALEXA_CLIENT_ID and ALEXA_CLIENT_SECRET - announcements are off")
+		announceOnOpen = false
+	}
+	alexaAPIEndpoint = strings.TrimSuffix(os.Getenv("ALEXA_API_ENDPOINT"), "/")
+	if alexaAPIEndpoint == "" {
+		alexaAPIEndpoint = "https://api.amazonalexa.com"
+	}
+	alexaEventsStage = os.Getenv("ALEXA_EVENTS_STAGE")
+	if alexaEventsStage != "live" {
+		alexaEventsStage = "development"
+	}
+	motionVariable = os.Getenv("MOTION_VAR")
+	motionWindow = 5 * time.Minute
+	if mins, err := strconv.Atoi(os.Getenv("MOTION_WINDOW_MINUTES")); err == nil && mins > 0 {
+		motionWindow = time.Duration(mins) * time.Minute
+	}
+	motionHardLimit = time.Hour
+	if mins, err := strconv.Atoi(os.Getenv("MOTION_HARD_LIMIT_MINUTES")); err == nil && mins >= 0 {
+		motionHardLimit = time.Duration(mins) * time.Minute
+	}
+
+	statusStableRuns, _ = strconv.Atoi(os.Getenv("STATUS_STABLE_RUNS"))
+	if mins, err := strconv.ParseInt(os.Getenv("STATUS_STABLE_MINUTES"), 10, 64); err == nil && mins > 0 {
+		statusStableSecs = mins * 60
+	}
+
+	closePollInterval = 3 * time.Second
+	if secs, err := strconv.Atoi(os.Getenv("CLOSE_POLL_SECONDS")); err == nil && secs > 0 {
+		closePollInterval = time.Duration(secs) * time.Second
+	}
+
 	// Initialize AWS clients
-	sess := session.Must(session.NewSession())
-	dynamoClient = dynamodb.New(sess)
+	sess := session.Must(session.NewSession(request.WithRetryer(
+		&aws.Config{EnforceShouldRetryCheck: aws.Bool(true)},
+		budgetRetryer{client.DefaultRetryer{NumMaxRetries: client.DefaultRetryerMaxNumRetries}},
+	)))
+	dynamoClient = dynamodb.New(sess, dynamoRetryConfig())
+	timeDynamoCalls(dynamoClient.Client)
 	snsClient = sns.New(sess)
+	if notificationTopicARN != "" {
+		// Publish in the topic's own region, which needn't be the function's
+		if region, err := topicRegion(notificationTopicARN); err != nil {
+			topicConfigError("NOTIFICATION_TOPIC_ARN", err)
+		} else if region != aws.StringValue(sess.Config.Region) {
+			fmt.Printf("NOTIFICATION_TOPIC_ARN is in %s - publishing there\n", region)
+			snsClient = sns.New(sess, aws.NewConfig().WithRegion(region))
+		}
+	}
+	if fallbackTopicARN != "" {
+		region, err := topicRegion(fallbackTopicARN)
+		if err != nil {
+			topicConfigError("NOTIFICATION_TOPIC_ARN_FALLBACK", err)
+			fallbackTopicARN = ""
+		} else {
+			fallbackSNSClient = sns.New(sess, aws.NewConfig().WithRegion(region))
+		}
+	}
+	recipients, err = loadRecipients(os.Getenv("NOTIFICATION_RECIPIENTS"), sess)
+	if err != nil {
+		topicConfigError("NOTIFICATION_RECIPIENTS", err)
+	}
+	severityBands, err = loadSeverityBands(os.Getenv("ALERT_SEVERITY_BANDS"))
+	if err != nil {
+		fmt.Printf("WARNING: ignoring ALERT_SEVERITY_BANDS: %v\n", err)
+	}
+	urgentTopicARN = os.Getenv("URGENT_TOPIC_ARN")
+	if urgentTopicARN != "" {
+		region, err := topicRegion(urgentTopicARN)
+		if err != nil {
+			topicConfigError("URGENT_TOPIC_ARN", err)
+			urgentTopicARN = ""
+		} else {
+			urgentSNSClient = sns.New(sess, aws.NewConfig().WithRegion(region))
+		}
+	}
+	alertingEnabled = notificationTopicARN != "" || fallbackTopicARN != "" || len(recipients) > 0
+	if verifyTopicsAtStartup && alertingEnabled {
+		verifyCtx, cancel := context.WithTimeout(context.Background(), topicVerifyTimeout)
+		if err := verifyTopics(verifyCtx); err != nil {
+			topicConfigError("notification topics", err)
+		}
+		cancel()
+	}
+
+	eventBusName = os.Getenv("EVENT_BUS_NAME")
+	if eventBusName != "" {
+		eventBridgeClient = eventbridge.New(sess)
+	}
+	exportBucket = os.Getenv("EXPORT_BUCKET")
+	if exportBucket != "" {
+		s3Client = s3.New(sess)
+	}
+
+	tracingEnabled = os.Getenv("ENABLE_XRAY") == "true"
+	if tracingEnabled {
+		clients := []*client.Client{dynamoClient.Client, snsClient.Client}
+		if fallbackSNSClient != nil {
+			clients = append(clients, fallbackSNSClient.Client)
+		}
+		if urgentSNSClient != nil {
+			clients = append(clients, urgentSNSClient.Client)
+		}
+		for _, recipientClient := range recipientClients {
+			clients = append(clients, recipientClient.Client)
+		}
+		if eventBridgeClient != nil {
+			clients = append(clients, eventBridgeClient.Client)
+		}
+		if s3Client != nil {
+			clients = append(clients, s3Client.Client)
+		}
+		enableTracing(clients...)
+	}
+
+	flagsTTL := time.Minute
+	if secs, err := strconv.Atoi(os.Getenv("FLAGS_TTL_SECONDS")); err == nil && secs > 0 {
+		flagsTTL = time.Duration(secs) * time.Second
+	}
+	featureFlags = newCachedValue[FeatureFlags](flagsTTL)
 
 	fmt.Printf("Monitor initialized - threshold: %d minutes\n", thresholdMinutes)
+	if maintenanceMode {
+		fmt.Println("Maintenance mode enabled - automated door actions are disabled")
+	}
+	if !alertingEnabled {
+		fmt.Println("No notification channels configured - alerting is disabled")
+	}
 }
 
 func main() {
@@ -81,11 +506,99 @@ func main() {
 }
 
 // HandleMonitor is the main Lambda handler for scheduled monitoring
-func HandleMonitor(ctx context.Context, event interface{}) error {
-	fmt.Println("Door monitor triggered")
+func HandleMonitor(ctx context.Context, event MonitorEvent) (result MonitorResult, err error) {
+	mode := event.Mode
+	if mode == "" {
+		mode = modeCheck
+	}
+	fmt.Printf("Door monitor triggered (mode: %s)\n", mode)
+	ctx = withRetryBudget(ctx)
+	ctx = withInvocationTiming(ctx)
+	start := time.Now()
+
+	// The result doubles as the run's one-line summary
+	result = MonitorResult{Mode: mode, DeviceID: particleDeviceID}
+	defer func() {
+		if err != nil {
+			result.Error = err.Error()
+		}
+		result.ParticleMs, result.DynamoMs = invocationTimes(ctx)
+		result.DurationMs = time.Since(start).Milliseconds()
+		if line, marshalErr := json.Marshal(result); marshalErr == nil {
+			fmt.Println(string(line))
+		}
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("PANIC in %s run: %v\n%s", mode, r, debug.Stack())
+			err = fmt.Errorf("monitor %s run panicked: %v", mode, r)
+		}
+	}()
+
+	// Write out buffered metrics before the container can be frozen
+	defer flushMetrics(ctx)
+
+	if mode == modeCheck || mode == modeNightlyClose {
+		sleepJitter(ctx)
+	}
+
+	// Replay event writes that failed in an earlier invocation first
+	eventLogRecovered = flushPendingEvents(ctx)
+
+	applyFeatureFlags(ctx)
+
+	switch mode {
+	case modeCheck:
+		err = runForEachDevice(ctx, &result, runStatusCheck)
+	case modeNightlyClose:
+		err = runForEachDevice(ctx, &result, runNightlyClose)
+	case modeMigrate:
+		err = runMigration(ctx)
+	case modeSelfTest:
+		// Failures are reported in the result rather than failing the
+		// invocation, so the caller gets every check back
+		runSelfTest(ctx, &result)
+	case modeTestNotify:
+		err = sendTestNotification(ctx)
+	case modeMorning:
+		err = runMorningReport(ctx, &result)
+	case modeExport:
+		err = runExport(ctx, event.Days, event.Format, &result)
+	default:
+		err = fmt.Errorf("unknown monitor mode: %s", mode)
+	}
+	return result, err
+}
+
+// sleepJitter waits a random 0-POLL_JITTER_SECONDS so deployments on the
+// same schedule don't all hit Particle at once. It never uses more than half
+// the time left before the invocation deadline.
+func sleepJitter(ctx context.Context) {
+	if pollJitter <= 0 {
+		return
+	}
+
+	delay := time.Duration(rand.Int63n(int64(pollJitter)))
+	if deadline, ok := ctx.Deadline(); ok {
+		if limit := time.Until(deadline) / 2; delay > limit {
+			delay = limit
+		}
+	}
+	if delay <= 0 {
+		return
+	}
+
+	fmt.Printf("Waiting %v before polling\n", delay.Round(time.Millisecond))
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+	}
+}
 
+// runStatusCheck tracks a door's state and alerts if it has been open too long
+func runStatusCheck(ctx context.Context, deviceID string, result *MonitorResult) error {
 	// Get current door status from Particle
-	status, err := getDoorStatus()
+	status, err := getDoorStatus(ctx, deviceID)
 	if err != nil {
 		fmt.Printf("Error getting door status: %v\n", err)
 		return err
@@ -94,39 +607,38 @@ func HandleMonitor(ctx context.Context, event interface{}) error {
 	fmt.Printf("Current door status: %s\n", status)
 
 	// Get previous state from DynamoDB
-	previousState, err := getDoorState()
-	if err != nil {
-		fmt.Printf("Error getting previous state: %v\n", err)
-		// Continue with empty state
+	previousState, err := getDoorState(ctx, deviceID)
+	if err != nil && isThrottled(err) {
+		// Carrying on with an empty state would overwrite the stored one,
+		// so leave this check to the next run
+		fmt.Printf("Door state table is throttled - skipping this check: %v\n", err)
+		result.Status = status
+		return nil
+	}
+	if err != nil || previousState == nil {
+		if err != nil {
+			fmt.Printf("Error getting previous state: %v\n", err)
+		}
+		// Continue with empty state, as for a door seen for the first time
 		previousState = &DoorState{
-			DeviceID: particleDeviceID,
+			DeviceID: deviceID,
 			Status:   "unknown",
 		}
 	}
 
-	// Update state
-	currentTime := time.Now().Unix()
-	newState := DoorState{
-		DeviceID:         particleDeviceID,
-		Status:           status,
-		LastChecked:      currentTime,
-		LastOpenedTime:   previousState.LastOpenedTime,
-		LastClosedTime:   previousState.LastClosedTime,
-		NotificationSent: previousState.NotificationSent,
-	}
-
-	// Detect state changes
-	if status != previousState.Status {
-		fmt.Printf("State changed: %s -> %s\n", previousState.Status, status)
+	// Update state, once a change has settled
+	currentTime := now().Unix()
+	change := debounceStatus(previousState, status, currentTime)
+	status = change.Status
+	newState := nextDoorState(ctx, previousState, status, currentTime)
+	change.apply(&newState)
+	threshold := alertThreshold(&newState, time.Unix(currentTime, 0))
 
-		if status == "open" {
-			newState.LastOpenedTime = currentTime
-			newState.NotificationSent = false
-		} else if status == "closed" {
-			newState.LastClosedTime = currentTime
-			newState.NotificationSent = false
-		}
+	// Separate from the threshold alert below, which it doesn't affect
+	if notifyOpenWhileAway(ctx, &newState) {
+		result.Notified = true
 	}
+	announceOpen(ctx, &newState, time.Unix(currentTime, 0))
 
 	// Calculate duration if door is open
 	if status == "open" && newState.LastOpenedTime > 0 {
@@ -135,22 +647,100 @@ func HandleMonitor(ctx context.Context, event interface{}) error {
 
 		fmt.Printf("Door has been open for %d minutes\n", newState.DurationOpenMins)
 
-		// Check if notification should be sent
-		if newState.DurationOpenMins >= int64(thresholdMinutes) && !newState.NotificationSent {
-			err := sendNotification(newState.DurationOpenMins)
+		// A corrupt LastOpenedTime would otherwise produce an absurd alert
+		suspect := maxReasonableOpenMins > 0 && newState.DurationOpenMins > int64(maxReasonableOpenMins)
+		if suspect {
+			fmt.Printf("WARNING: open duration %d minutes exceeds %d - treating lastOpenedTime %d as suspect and restarting the clock\n",
+				newState.DurationOpenMins, maxReasonableOpenMins, newState.LastOpenedTime)
+			newState.LastOpenedTime = currentTime
+			newState.DurationOpenMins = 0
+		}
+
+		// Cold weather makes an open door matter sooner; only worth reading
+		// while an alert is still to come
+		var cold *coldReading
+		if !newState.NotificationSent {
+			cold = coldConditions(ctx, deviceID)
+			threshold = cold.capThreshold(threshold)
+		}
+
+		// Check if notification should be sent. An alert goes out again if
+		// the door reaches a higher severity than the last one.
+		severity, rank := alertSeverity(newState.DurationOpenMins, threshold)
+		escalated := newState.DurationOpenMins >= threshold && severityEscalated(&newState, rank)
+		if suspect {
+			fmt.Println("Skipping alert this cycle")
+		} else if newState.SnoozeUntil > 0 {
+			fmt.Printf("Alerts snoozed until %s\n", time.Unix(newState.SnoozeUntil, 0).In(localTimezone).Format(time.RFC3339))
+		} else if newState.SuppressAlertUntil > currentTime {
+			fmt.Printf("Alert delayed until %d\n", newState.SuppressAlertUntil)
+		} else if len(recipients) > 0 {
+			if escalated {
+				newState.RecipientsNotified = nil
+			}
+			if (!newState.NotificationSent || escalated) && notifyRecipients(ctx, &newState, threshold, cold, severity) {
+				result.Notified = true
+				recordAlertSeverity(ctx, &newState, severity)
+			}
+		} else if alertingEnabled && newState.DurationOpenMins >= threshold && (!newState.NotificationSent || escalated) {
+			err := sendNotification(ctx, &newState, cold, severity)
 			if err != nil {
 				fmt.Printf("Error sending notification: %v\n", err)
 			} else {
 				newState.NotificationSent = true
+				result.Notified = true
 				fmt.Println("Notification sent successfully")
+				recordAlertSeverity(ctx, &newState, severity)
 			}
 		}
 	} else {
 		newState.DurationOpenMins = 0
 	}
 
+	if shouldAutoClose(&newState) {
+		deferred, warning := deferAutoClose(ctx, &newState, time.Unix(currentTime, 0))
+		if doorObstructed(ctx, deviceID) {
+			// Pressing would just bounce the door off whatever is in the way
+			if notifyObstruction(ctx, &newState, fmt.Sprintf("It has been open for %d minutes.", newState.DurationOpenMins)) {
+				result.Notified = true
+			}
+		} else if deferred {
+			fmt.Println("Auto-close deferred until the next check")
+		} else if closedState, err := autoClose(ctx, &newState, warning); err != nil {
+			fmt.Printf("Error auto-closing door: %v\n", err)
+		} else {
+			newState = closedState
+			result.AutoClosed = true
+		}
+	}
+
+	if newState.AllClearPending && newState.Status == "closed" && notifyAllClear(ctx, &newState) {
+		result.Notified = true
+	}
+
+	// A sensor that keeps reporting unknown is a fault, not an open door
+	if status == "unknown" && newState.UnknownSince > 0 {
+		unknownMins := (currentTime - newState.UnknownSince) / 60
+		fmt.Printf("Door sensor has reported unknown for %d minutes\n", unknownMins)
+
+		if alertingEnabled && unknownMins >= int64(sensorGraceMinutes) && !newState.SensorAlertSent {
+			err := sendSensorNotification(ctx, deviceID, unknownMins)
+			if err != nil {
+				fmt.Printf("Error sending sensor notification: %v\n", err)
+			} else {
+				newState.SensorAlertSent = true
+				result.Notified = true
+				fmt.Println("Sensor problem notification sent successfully")
+			}
+		}
+	}
+
+	result.Status = newState.Status
+	result.DurationMins = newState.DurationOpenMins
+	recordOpenRatio(ctx, &newState, time.Unix(currentTime, 0), result)
+
 	// Save state to DynamoDB
-	err = saveDoorState(&newState)
+	err = saveDoorState(ctx, &newState)
 	if err != nil {
 		fmt.Printf("Error saving state: %v\n", err)
 		return err
@@ -160,50 +750,510 @@ func HandleMonitor(ctx context.Context, event interface{}) error {
 	return nil
 }
 
-// getDoorStatus fetches current door status from Particle device
-func getDoorStatus() (string, error) {
-	url := fmt.Sprintf("%s/devices/%s/doorStatus?access_token=%s",
+// runNightlyClose closes a door if it is open at the scheduled time,
+// regardless of how long it has been open
+func runNightlyClose(ctx context.Context, deviceID string, result *MonitorResult) error {
+	status, err := getDoorStatus(ctx, deviceID)
+	if err != nil {
+		fmt.Printf("Error getting door status: %v\n", err)
+		return err
+	}
+
+	fmt.Printf("Current door status: %s\n", status)
+	result.Status = status
+
+	if status != "open" {
+		fmt.Println("Door is not open - nothing to close for the night")
+		return nil
+	}
+
+	if maintenanceMode {
+		fmt.Println("Maintenance mode enabled - skipping nightly close")
+		return nil
+	}
+
+	if doorObstructed(ctx, deviceID) {
+		previousState, err := getDoorState(ctx, deviceID)
+		if err != nil || previousState == nil {
+			previousState = &DoorState{DeviceID: deviceID, Status: status}
+		}
+		newState := nextDoorState(ctx, previousState, status, now().Unix())
+		result.Notified = notifyObstruction(ctx, &newState, "It's still open for the night.")
+		return saveDoorState(ctx, &newState)
+	}
+
+	finalStatus, err := closeDoor(ctx, deviceID)
+	if err != nil {
+		fmt.Printf("Error pressing button for nightly close: %v\n", err)
+		notifyErr := publishNotification(ctx, "Garage Door Nightly Close Failed",
+			fmt.Sprintf(" GARAGE DOOR ALERT\n\nYour %s is open and I couldn't reach the controller to close it for the night.\n\nTime: %s",
+				ownedName(deviceID), now().Format("2006-01-02 15:04:05 MST")))
+		if notifyErr != nil {
+			fmt.Printf("Error sending notification: %v\n", notifyErr)
+		}
+		return err
+	}
+
+	fmt.Printf("Door status after nightly close: %s\n", finalStatus)
+	result.Status = finalStatus
+	result.AutoClosed = true
+
+	var subject, message string
+	if finalStatus == "closed" {
+		subject = "Garage Door Closed For The Night"
+		message = fmt.Sprintf("Your %s was open, so I closed it for the night.\n\nTime: %s",
+			ownedName(deviceID), now().Format("2006-01-02 15:04:05 MST"))
+	} else {
+		subject = "Garage Door Nightly Close Not Confirmed"
+		message = fmt.Sprintf(" GARAGE DOOR ALERT\n\nI tried to close your %s for the night, but it still reports %s. Please check it.\n\nTime: %s",
+			ownedName(deviceID), finalStatus, now().Format("2006-01-02 15:04:05 MST"))
+	}
+	if err := publishNotification(ctx, subject, message); err != nil {
+		fmt.Printf("Error sending notification: %v\n", err)
+	} else {
+		result.Notified = alertingEnabled
+	}
+
+	previousState, err := getDoorState(ctx, deviceID)
+	if err != nil || previousState == nil {
+		previousState = &DoorState{
+			DeviceID: deviceID,
+			Status:   status,
+		}
+	}
+	newState := nextDoorState(ctx, previousState, finalStatus, now().Unix())
+	if err := saveDoorState(ctx, &newState); err != nil {
+		fmt.Printf("Error saving state: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// shouldAutoClose reports whether the door has been open past
+// AUTO_CLOSE_MINUTES. Auto-close is held off while alerts are snoozed, since
+// that means someone is working with the door open.
+func shouldAutoClose(state *DoorState) bool {
+	if autoCloseMinutes <= 0 || state.Status != "open" {
+		return false
+	}
+	if !autoCloseEnabled {
+		fmt.Println("Auto-close turned off by the autoCloseEnabled flag")
+		return false
+	}
+	if state.DurationOpenMins < int64(autoCloseMinutes) {
+		return false
+	}
+	if maintenanceMode || state.MaintenanceMode {
+		fmt.Println("Maintenance mode enabled - skipping auto-close")
+		return false
+	}
+	if state.SnoozeUntil > 0 {
+		fmt.Println("Alerts snoozed - skipping auto-close")
+		return false
+	}
+	if state.ManualInterventionNeeded {
+		fmt.Println("Auto-close gave up on this door - skipping until it closes")
+		return false
+	}
+	if next := nextAutoCloseAttempt(state); now().Before(next) {
+		fmt.Printf("Backing off auto-close after %d attempts until %s\n", state.AutoCloseAttempts, next.Format(time.RFC3339))
+		return false
+	}
+	return true
+}
+
+// nextAutoCloseAttempt is the earliest time auto-close may press again. The
+// wait after a failed attempt doubles each time, starting at
+// AUTO_CLOSE_BACKOFF_MINUTES.
+func nextAutoCloseAttempt(state *DoorState) time.Time {
+	if state.AutoCloseAttempts == 0 {
+		return time.Time{}
+	}
+	wait := autoCloseBackoff << (state.AutoCloseAttempts - 1)
+	return time.Unix(state.LastAutoCloseAttempt, 0).Add(wait)
+}
+
+// autoClose closes a door that has been open too long and reports the
+// outcome, returning the state updated with the verified status. After
+// AUTO_CLOSE_MAX_ATTEMPTS presses that don't close the door it stops trying
+// and asks for someone to check the door. A non-empty warning is added to
+// the notification.
+func autoClose(ctx context.Context, state *DoorState, warning string) (DoorState, error) {
+	openMins := state.DurationOpenMins
+	state.AutoCloseAttempts++
+	state.LastAutoCloseAttempt = now().Unix()
+	fmt.Printf("Door open %d minutes - auto-closing (attempt %d of %d)\n", openMins, state.AutoCloseAttempts, autoCloseMaxAttempts)
+
+	finalStatus, err := closeDoor(ctx, state.DeviceID)
+	if err != nil {
+		return *state, err
+	}
+
+	fmt.Printf("Door status after auto-close: %s\n", finalStatus)
+
+	gaveUp := finalStatus != "closed" && state.AutoCloseAttempts >= autoCloseMaxAttempts
+	obstructed := finalStatus != "closed" && doorObstructed(ctx, state.DeviceID)
+	var subject, message string
+	if obstructed {
+		// The close failed because something is in the way, so trying again won't help
+		gaveUp = true
+		state.ObstructionAlertSent = true
+		subject = "Garage Door Obstructed"
+		message = fmt.Sprintf(" GARAGE DOOR OBSTRUCTED\n\nI tried to close your %s, but it still reports %s and the opener reports an obstruction. I've stopped trying; please clear it and close the door by hand.\n\nTime: %s",
+			ownedName(state.DeviceID), finalStatus, now().Format("2006-01-02 15:04:05 MST"))
+	} else if finalStatus == "closed" {
+		subject = "Garage Door Closed Automatically"
+		message = fmt.Sprintf("Your %s was open for %d minutes, so I closed it.\n\nTime: %s",
+			ownedName(state.DeviceID), openMins, now().Format("2006-01-02 15:04:05 MST"))
+	} else if gaveUp {
+		subject = "Garage Door Needs Attention"
+		message = fmt.Sprintf(" GARAGE DOOR NEEDS ATTENTION\n\nI tried %d times to close your %s, but it still reports %s. Something may be blocking it or the opener may be faulty. I've stopped trying; please close it by hand.\n\nTime: %s",
+			state.AutoCloseAttempts, ownedName(state.DeviceID), finalStatus, now().Format("2006-01-02 15:04:05 MST"))
+	} else {
+		subject = "Garage Door Auto-Close Not Confirmed"
+		message = fmt.Sprintf(" GARAGE DOOR ALERT\n\nI tried to close your %s after %d minutes open, but it still reports %s. Please check it.\n\nTime: %s",
+			ownedName(state.DeviceID), openMins, finalStatus, now().Format("2006-01-02 15:04:05 MST"))
+	}
+	if warning != "" {
+		message += "\n\n" + warning
+	}
+	if err := publishNotification(ctx, subject, message); err != nil {
+		fmt.Printf("Error sending notification: %v\n", err)
+	}
+
+	state.AutoCloseDeferredSince = 0
+	newState := nextDoorState(ctx, state, finalStatus, now().Unix())
+	newState.AllClearPending = false // The message above already says it closed
+	if finalStatus == "open" {
+		newState.DurationOpenMins = state.DurationOpenMins
+	}
+	if gaveUp {
+		fmt.Println("Auto-close attempts exhausted - manual intervention needed")
+		newState.ManualInterventionNeeded = true
+	}
+	return newState, nil
+}
+
+// closeDoor presses the button and polls until the door reports closed or
+// the verify timeout passes, returning the last status read. An error means
+// the press itself failed.
+func closeDoor(ctx context.Context, deviceID string) (string, error) {
+	pressed, err := pressButton(ctx, deviceID)
+	if err != nil {
+		return "", err
+	}
+	if !pressed {
+		fmt.Println("Relay already active - not pressing again")
+	}
+
+	finalStatus, err := waitForClosed(ctx, deviceID)
+	if err != nil {
+		fmt.Printf("Error re-checking door status: %v\n", err)
+		finalStatus = "unknown"
+	}
+	return finalStatus, nil
+}
+
+// nextDoorState derives the state to persist from the previous state and a
+// fresh status reading, tracking open/close transitions
+func nextDoorState(ctx context.Context, previousState *DoorState, status string, currentTime int64) DoorState {
+	newState := DoorState{
+		DeviceID:           previousState.DeviceID,
+		Status:             status,
+		LastChecked:        currentTime,
+		LastOpenedTime:     previousState.LastOpenedTime,
+		LastClosedTime:     previousState.LastClosedTime,
+		NotificationSent:   previousState.NotificationSent,
+		EventLogGapSince:   previousState.EventLogGapSince,
+		UnknownSince:       previousState.UnknownSince,
+		SensorAlertSent:    previousState.SensorAlertSent,
+		LastNotifiedKey:    previousState.LastNotifiedKey,
+		SnoozeUntil:        previousState.SnoozeUntil,
+		SuppressAlertUntil: previousState.SuppressAlertUntil,
+
+		SchemaVersion:      previousState.SchemaVersion,
+		AlertThresholdMins: previousState.AlertThresholdMins,
+		MaintenanceMode:    previousState.MaintenanceMode,
+
+		RecipientsNotified: previousState.RecipientsNotified,
+
+		AutoCloseAttempts:        previousState.AutoCloseAttempts,
+		LastAutoCloseAttempt:     previousState.LastAutoCloseAttempt,
+		ManualInterventionNeeded: previousState.ManualInterventionNeeded,
+
+		RelayAlreadyActiveCount: previousState.RelayAlreadyActiveCount,
+
+		FriendlyName: previousState.FriendlyName,
+
+		ObstructionAlertSent: previousState.ObstructionAlertSent,
+
+		AutoCloseDeferredSince: previousState.AutoCloseDeferredSince,
+
+		AwayAlertSent: previousState.AwayAlertSent,
+
+		AllClearPending: previousState.AllClearPending,
+		PushedAt:        previousState.PushedAt,
+		OpenAnnounced:   previousState.OpenAnnounced,
+		AssumedStatus:   previousState.AssumedStatus,
+		AlertSeverity:   previousState.AlertSeverity,
+	}
+	applyStateDefaults(&newState)
+
+	// Reminders resume once a snooze runs out with the door still open
+	if newState.SnoozeUntil > 0 && currentTime >= newState.SnoozeUntil {
+		fmt.Println("Alert snooze expired")
+		newState.SnoozeUntil = 0
+		newState.NotificationSent = false
+		newState.RecipientsNotified = nil
+		newState.AlertSeverity = ""
+	}
+
+	// Track how long the sensor has been unable to report a status
+	if status == "unknown" {
+		if newState.UnknownSince == 0 {
+			newState.UnknownSince = currentTime
+		}
+	} else {
+		newState.UnknownSince = 0
+		newState.SensorAlertSent = false
+		newState.AssumedStatus = "" // A real reading replaces any guess
+	}
+
+	if eventLogRecovered {
+		newState.EventLogGapSince = 0
+	}
+
+	// Detect state changes
+	if status != previousState.Status {
+		fmt.Printf("State changed: %s -> %s\n", previousState.Status, status)
+		if shouldNotify(ctx, &newState, status, currentTime) {
+			recordDoorEvent(ctx, &newState, previousState.Status, status, currentTime)
+			publishTransition(ctx, newState.DeviceID, previousState.Status, status, currentTime)
+		}
+
+		if status == "open" {
+			newState.LastOpenedTime = currentTime
+			newState.NotificationSent = false
+			newState.RecipientsNotified = nil
+			newState.AwayAlertSent = false
+			newState.AllClearPending = false
+			newState.OpenAnnounced = false
+			newState.AlertSeverity = ""
+		} else if status == "closed" {
+			newState.LastClosedTime = currentTime
+			newState.AllClearPending = newState.NotificationSent || len(newState.RecipientsNotified) > 0
+			newState.NotificationSent = false
+			newState.RecipientsNotified = nil
+			newState.SnoozeUntil = 0
+			newState.SuppressAlertUntil = 0
+			newState.CloseLinkNonce = ""
+			newState.AutoCloseAttempts = 0
+			newState.LastAutoCloseAttempt = 0
+			newState.ManualInterventionNeeded = false
+			newState.ObstructionAlertSent = false
+			newState.AutoCloseDeferredSince = 0
+			newState.AwayAlertSent = false
+			newState.AlertSeverity = ""
+		}
+	}
+
+	return newState
+}
+
+// closeDeadlineReserve is left before the invocation deadline for the last
+// status read, the notification and the state write
+const closeDeadlineReserve = 5 * time.Second
+
+// waitForClosed waits CLOSE_VERIFY_DELAY_SECONDS for the door to start
+// moving, then re-reads its status every CLOSE_POLL_SECONDS until it reports
+// closed. It gives up CLOSE_VERIFY_TIMEOUT_SECONDS after it starts, or
+// earlier if the invocation deadline is closer, and returns the last status
+// it read. A failed read is retried on the next poll.
+func waitForClosed(ctx context.Context, deviceID string) (string, error) {
+	stop := time.Now().Add(closeVerifyTimeout)
+	if deadline, ok := ctx.Deadline(); ok && deadline.Add(-closeDeadlineReserve).Before(stop) {
+		stop = deadline.Add(-closeDeadlineReserve)
+	}
+
+	var status string
+	var lastErr error
+	wait := closeVerifyDelay
+	for poll := 1; ; poll++ {
+		if remaining := time.Until(stop); wait > remaining {
+			wait = remaining
+		}
+		if wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				if status != "" {
+					return status, nil
+				}
+				return "", ctx.Err()
+			}
+		}
+
+		current, err := getDoorStatus(ctx, deviceID)
+		if err != nil {
+			fmt.Printf("Close poll %d failed: %v\n", poll, err)
+			lastErr = err
+			// Polling again after a failure is a retry
+			if !allowRetry(ctx, closePollInterval) {
+				break
+			}
+		} else {
+			fmt.Printf("Close poll %d: %s\n", poll, current)
+			status = current
+			if status == "closed" {
+				return status, nil
+			}
+		}
+
+		if !time.Now().Add(closePollInterval).Before(stop) {
+			break
+		}
+		wait = closePollInterval
+	}
+
+	if status == "" {
+		return "", lastErr
+	}
+	fmt.Printf("Door did not report closed within %s\n", closeVerifyTimeout)
+	return status, nil
+}
+
+// getDoorStatus fetches a door's current status from its Particle device
+func getDoorStatus(ctx context.Context, deviceID string) (string, error) {
+	raw, err := getParticleVariable(ctx, deviceID, statusVariable)
+	if err != nil {
+		return "", err
+	}
+	return normalizeDoorStatus(raw), nil
+}
+
+// getParticleVariable reads a cloud variable, returning its raw JSON value
+func getParticleVariable(ctx context.Context, deviceID, name string) (json.RawMessage, error) {
+	ctx, end := startSpan(ctx, "particle."+name)
+	defer end()
+
+	url := fmt.Sprintf("%s/devices/%s/%s?access_token=%s",
 		particleAPIBase,
-		particleDeviceID,
+		deviceID,
+		name,
 		particleAccessToken,
 	)
 
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("error making request: %w", err)
+		return nil, fmt.Errorf("error making request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("error reading response: %w", err)
+		return nil, fmt.Errorf("error reading response: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("particle API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("particle API error (status %d): %s", resp.StatusCode, string(body))
 	}
 
 	var result ParticleVariableResponse
 	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("error unmarshaling response: %w", err)
+		return nil, fmt.Errorf("error unmarshaling response: %w", err)
 	}
 
 	if result.Error != "" {
-		return "", fmt.Errorf("particle error: %s", result.Error)
+		return nil, fmt.Errorf("%w: %s", errDeviceNotResponding, result.Error)
 	}
 
 	return result.Result, nil
 }
 
-// getDoorState retrieves the current state from DynamoDB
-func getDoorState() (*DoorState, error) {
-	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+// normalizeDoorStatus turns a raw status variable value into a status,
+// through STATUS_MAP first. Openers that report a 0-100 position instead are treated as open above
+// OPEN_POSITION_THRESHOLD and closed otherwise.
+func normalizeDoorStatus(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		text = string(raw)
+	}
+	if status, ok := mapStatus(text); ok {
+		return status
+	}
+
+	position, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil {
+		return text
+	}
+
+	fmt.Printf("Door position: %.0f%%\n", position)
+	if position > float64(openPositionMin) {
+		return "open"
+	}
+	return "closed"
+}
+
+// pressButton pulses the relay via the Particle cloud function.
+// Returns false if the relay was already active.
+func pressButton(ctx context.Context, deviceID string) (bool, error) {
+	ctx, end := startSpan(ctx, "particle.pressButton")
+	defer end()
+
+	url := fmt.Sprintf("%s/devices/%s/pressButton", particleAPIBase, deviceID)
+
+	jsonData, err := json.Marshal(map[string]string{"arg": ""})
+	if err != nil {
+		return false, fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return false, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", particleAccessToken))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, fmt.Errorf("error reading response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("particle API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var funcResp ParticleFunctionResponse
+	if err := json.Unmarshal(body, &funcResp); err != nil {
+		return false, fmt.Errorf("error unmarshaling response: %w", err)
+	}
+
+	if funcResp.Error != "" {
+		return false, fmt.Errorf("%w: %s", errDeviceNotResponding, funcResp.Error)
+	}
+
+	// Return value of 1 means success, 0 means already active
+	return funcResp.ReturnValue == 1, nil
+}
+
+// getDoorState retrieves a door's current state from DynamoDB
+func getDoorState(ctx context.Context, deviceID string) (*DoorState, error) {
+	result, err := dynamoClient.GetItemWithContext(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(doorStateTable),
-		Key: map[string]*dynamodb.AttributeValue{
-			"deviceId": {
-				S: aws.String(particleDeviceID),
-			},
-		},
+		Key:       stateKey(deviceID),
 	})
 
 	if err != nil {
@@ -215,22 +1265,24 @@ func getDoorState() (*DoorState, error) {
 	}
 
 	var state DoorState
-	err = dynamodbattribute.UnmarshalMap(result.Item, &state)
+	err = unmarshalStateItem(result.Item, &state)
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshaling state: %w", err)
 	}
+	applyStateDefaults(&state)
+	rememberFriendlyName(state.DeviceID, state.FriendlyName)
 
 	return &state, nil
 }
 
 // saveDoorState saves the current state to DynamoDB
-func saveDoorState(state *DoorState) error {
-	item, err := dynamodbattribute.MarshalMap(state)
+func saveDoorState(ctx context.Context, state *DoorState) error {
+	item, err := marshalStateItem(state)
 	if err != nil {
 		return fmt.Errorf("error marshaling state: %w", err)
 	}
 
-	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+	_, err = dynamoClient.PutItemWithContext(ctx, &dynamodb.PutItemInput{
 		TableName: aws.String(doorStateTable),
 		Item:      item,
 	})
@@ -243,26 +1295,122 @@ func saveDoorState(state *DoorState) error {
 }
 
 // sendNotification sends an SNS notification about the open door
-func sendNotification(durationMins int64) error {
+func sendNotification(ctx context.Context, state *DoorState, cold *coldReading, severity severityBand) error {
+	subject, message := openDoorAlert(state, cold, severity)
+	return publishNotification(ctx, subject, message)
+}
+
+// openDoorAlert formats the open-door alert, with a link to close the door
+// when close links are configured and the severity when bands are
+func openDoorAlert(state *DoorState, cold *coldReading, severity severityBand) (string, string) {
+	durationMins := state.DurationOpenMins
 	hours := durationMins / 60
 	mins := durationMins % 60
 
+	heading, subject := "GARAGE DOOR ALERT", "Garage Door Open Alert"
+	if severity.Label != "" {
+		label := strings.ToUpper(severity.Label)
+		heading += " (" + label + ")"
+		subject += " [" + label + "]"
+	}
+
 	var message string
 	if hours > 0 {
-		message = fmt.Sprintf(" GARAGE DOOR ALERT\n\nYour garage door has been open for %d hours and %d minutes.\n\nTime: %s",
-			hours, mins, time.Now().Format("2006-01-02 15:04:05 MST"))
+		message = fmt.Sprintf(" %s\n\nYour %s has been open for %d hours and %d minutes.\n\nTime: %s",
+			heading, ownedName(state.DeviceID), hours, mins, now().Format("2006-01-02 15:04:05 MST"))
 	} else {
-		message = fmt.Sprintf(" GARAGE DOOR ALERT\n\nYour garage door has been open for %d minutes.\n\nTime: %s",
-			mins, time.Now().Format("2006-01-02 15:04:05 MST"))
+		message = fmt.Sprintf(" %s\n\nYour %s has been open for %d minutes.\n\nTime: %s",
+			heading, ownedName(state.DeviceID), mins, now().Format("2006-01-02 15:04:05 MST"))
+	}
+
+	if cold != nil {
+		message += "\n\n" + cold.note()
 	}
 
-	subject := fmt.Sprintf("Garage Door Open Alert - %d mins", durationMins)
+	if link := newCloseLink(state, now()); link != "" {
+		message += fmt.Sprintf("\n\nClose it: %s", link)
+	}
 
-	_, err := snsClient.Publish(&sns.PublishInput{
-		TopicArn: aws.String(notificationTopicARN),
-		Subject:  aws.String(subject),
-		Message:  aws.String(message),
-	})
+	subject = fmt.Sprintf("%s - %d mins", subject, durationMins)
+
+	return subject, message
+}
+
+// notifyAllClear follows up an open-too-long alert once the door has closed,
+// saying how long it was open in all. A failed send stays pending for the
+// next check.
+func notifyAllClear(ctx context.Context, state *DoorState) bool {
+	message := fmt.Sprintf("All clear - your %s is now closed.", ownedName(state.DeviceID))
+	if state.LastOpenedTime > 0 && state.LastClosedTime > state.LastOpenedTime {
+		openMins := (state.LastClosedTime - state.LastOpenedTime) / 60
+		if hours := openMins / 60; hours > 0 {
+			message += fmt.Sprintf(" It was open for %d hours and %d minutes in total.", hours, openMins%60)
+		} else {
+			message += fmt.Sprintf(" It was open for %d minutes in total.", openMins)
+		}
+	}
+	message += fmt.Sprintf("\n\nTime: %s", now().Format("2006-01-02 15:04:05 MST"))
+
+	if err := publishNotification(ctx, "Garage Door Closed - All Clear", message); err != nil {
+		fmt.Printf("Error sending all-clear notification: %v\n", err)
+		return false
+	}
+	state.AllClearPending = false
+	fmt.Println("All-clear notification sent")
+	return true
+}
+
+// sendSensorNotification alerts that the door sensor hasn't reported a
+// usable status, separately from the open-too-long alert
+func sendSensorNotification(ctx context.Context, deviceID string, unknownMins int64) error {
+	message := fmt.Sprintf(" GARAGE DOOR SENSOR PROBLEM\n\nThe sensor for your %s has not reported whether the door is open or closed for %d minutes. The controller may be offline or the sensor may be disconnected.\n\nTime: %s",
+		ownedName(deviceID), unknownMins, now().Format("2006-01-02 15:04:05 MST"))
+	subject := "Garage Door Sensor Problem"
+
+	return publishNotification(ctx, subject, message)
+}
+
+// publishNotification publishes a message to the notification topic, falling
+// back to the topic in the secondary region if that fails. Without either
+// topic it goes to every recipient, and it is a no-op when nothing is
+// configured.
+func publishNotification(ctx context.Context, subject, message string) error {
+	if !alertingEnabled {
+		return nil
+	}
+	if notificationTopicARN == "" && fallbackTopicARN == "" {
+		return publishToRecipients(ctx, subject, message)
+	}
+
+	var primaryErr error
+	if notificationTopicARN != "" {
+		primaryErr = publishToTopic(ctx, notificationTopicARN, subject, message)
+		if primaryErr == nil {
+			fmt.Println("Notification delivered via primary topic")
+			return nil
+		}
+		if fallbackTopicARN == "" {
+			return primaryErr
+		}
+		fmt.Printf("Primary notification failed, trying fallback: %v\n", primaryErr)
+	}
+
+	if err := publishToTopic(ctx, fallbackTopicARN, subject, message); err != nil {
+		if primaryErr != nil {
+			return fmt.Errorf("%v; fallback: %w", primaryErr, err)
+		}
+		return err
+	}
+
+	fmt.Println("Notification delivered via fallback topic")
+	return nil
+}
+
+// publishToTopic publishes a message to one SNS topic
+func publishToTopic(ctx context.Context, topicARN, subject, message string) error {
+	start := time.Now()
+	err := notifier.Publish(ctx, topicARN, subject, message)
+	recordNotificationMetrics("sns", time.Since(start), err)
 
 	if err != nil {
 		return fmt.Errorf("error publishing to SNS: %w", err)
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// fakeParticle points the Particle client at a test server for the length of
+// the test, reporting *status for the status variable. Other variables
+// aren't found. The breaker is turned off so errors don't trip it for later
+// tests.
+func fakeParticle(t *testing.T, status *string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/"+statusVariable) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"result":%q}`, *status)
+	}))
+
+	base, token, threshold := particleAPIBase, particleAccessToken, particleBreaker.threshold
+	particleAPIBase, particleAccessToken, particleBreaker.threshold = server.URL, "test-token", 0
+	t.Cleanup(func() {
+		server.Close()
+		particleAPIBase, particleAccessToken, particleBreaker.threshold = base, token, threshold
+	})
+}
+
+// fakeDynamoDB is a DynamoDB for the length of a test. PutItem keeps the
+// item under its table and key, GetItem returns it and Scan returns every
+// item in the table. UpdateItem is recorded but doesn't change the item;
+// every other call succeeds and is ignored.
+type fakeDynamoDB struct {
+	t       *testing.T
+	mu      sync.Mutex
+	items   map[string]json.RawMessage // By table, then key
+	puts    map[string][]json.RawMessage
+	updates map[string][]json.RawMessage // Whole UpdateItem requests
+	fail    map[string]string            // Exception returned for every call to a table
+}
+
+// fakeDoorState points the DynamoDB client at a fakeDynamoDB for the length
+// of the test
+func fakeDoorState(t *testing.T) *fakeDynamoDB {
+	t.Helper()
+	db := &fakeDynamoDB{
+		t:       t,
+		items:   map[string]json.RawMessage{},
+		puts:    map[string][]json.RawMessage{},
+		updates: map[string][]json.RawMessage{},
+		fail:    map[string]string{},
+	}
+	server := httptest.NewServer(db)
+
+	client, table := dynamoClient, doorStateTable
+	dynamoClient = dynamodb.New(session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("test", "test", ""),
+		MaxRetries:  aws.Int(0),
+	})))
+	doorStateTable = "door-state"
+	t.Cleanup(func() {
+		server.Close()
+		dynamoClient, doorStateTable = client, table
+	})
+	return db
+}
+
+func (db *fakeDynamoDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	raw, _ := io.ReadAll(r.Body)
+	var body struct {
+		TableName string
+		Key       map[string]struct{ S string }
+		Item      json.RawMessage
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		db.t.Errorf("DynamoDB request is not JSON: %v", err)
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if exception := db.fail[body.TableName]; exception != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"__type":"com.amazonaws.dynamodb.v20120810#%s","message":"test failure"}`, exception)
+		return
+	}
+	switch target := r.Header.Get("X-Amz-Target"); {
+	case strings.HasSuffix(target, ".PutItem"):
+		var item map[string]struct{ S string }
+		json.Unmarshal(body.Item, &item)
+		db.items[body.TableName+"/"+item[stateKeyName].S] = body.Item
+		db.puts[body.TableName] = append(db.puts[body.TableName], body.Item)
+	case strings.HasSuffix(target, ".GetItem"):
+		if item, ok := db.items[body.TableName+"/"+body.Key[stateKeyName].S]; ok {
+			fmt.Fprintf(w, `{"Item":%s}`, item)
+			return
+		}
+	case strings.HasSuffix(target, ".UpdateItem"):
+		db.updates[body.TableName] = append(db.updates[body.TableName], raw)
+	case strings.HasSuffix(target, ".Scan"):
+		items := []json.RawMessage{}
+		for key, item := range db.items {
+			if strings.HasPrefix(key, body.TableName+"/") {
+				items = append(items, item)
+			}
+		}
+		page, _ := json.Marshal(map[string]interface{}{"Items": items, "Count": len(items)})
+		w.Write(page)
+		return
+	}
+	io.WriteString(w, `{}`)
+}
+
+// failTable makes every call to table fail with exception until it's
+// cleared with an empty one
+func (db *fakeDynamoDB) failTable(table, exception string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.fail[table] = exception
+}
+
+// putCount is how many items were written to table
+func (db *fakeDynamoDB) putCount(table string) int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return len(db.puts[table])
+}
+
+// fixClock stops the clock at at for the length of the test
+func fixClock(t *testing.T, at time.Time) {
+	t.Helper()
+	saved := now
+	now = func() time.Time { return at }
+	t.Cleanup(func() { now = saved })
+}
+
+// testTopic is the notification topic while alerting is on in a test
+const testTopic = "arn:aws:sns:us-east-1:123456789012:garage-door"
+
+// monitorDoor sets up dev1 with a 30 minute threshold, alerting to testTopic
+// through a recording notifier, and returns a function that runs a status
+// check at a given time with the door reporting status
+func monitorDoor(t *testing.T, status *string) (*recordingNotifier, func(at time.Time)) {
+	t.Helper()
+	fakeParticle(t, status)
+	fakeDoorState(t)
+	sent := useRecordingNotifier(t)
+
+	topic, enabled, threshold, zone := notificationTopicARN, alertingEnabled, thresholdMinutes, localTimezone
+	notificationTopicARN, alertingEnabled, thresholdMinutes, localTimezone = testTopic, true, 30, time.UTC
+	t.Cleanup(func() {
+		notificationTopicARN, alertingEnabled, thresholdMinutes, localTimezone = topic, enabled, threshold, zone
+	})
+
+	check := func(at time.Time) {
+		t.Helper()
+		fixClock(t, at)
+		if err := runStatusCheck(context.Background(), "dev1", &MonitorResult{}); err != nil {
+			t.Fatalf("status check at %s: %v", at.Format("15:04"), err)
+		}
+	}
+	return sent, check
+}
+
+func TestOpenDoorAlertsOnceAtThreshold(t *testing.T) {
+	status := "open"
+	sent, check := monitorDoor(t, &status)
+	opened := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	for _, mins := range []int{0, 15, 29} {
+		check(opened.Add(time.Duration(mins) * time.Minute))
+	}
+	if len(sent.all()) != 0 {
+		t.Fatalf("alerted before the threshold: %+v", sent.all())
+	}
+
+	check(opened.Add(30 * time.Minute))
+	alerts := sent.all()
+	if len(alerts) != 1 {
+		t.Fatalf("alerts at the threshold = %d, want 1", len(alerts))
+	}
+	if alerts[0].Channel != testTopic || !strings.HasPrefix(alerts[0].Subject, "Garage Door Open Alert") || !strings.Contains(alerts[0].Message, "open for 30 minutes") {
+		t.Errorf("alert = %+v, want the open-door alert on the notification topic", alerts[0])
+	}
+
+	for _, mins := range []int{31, 45, 90} {
+		check(opened.Add(time.Duration(mins) * time.Minute))
+	}
+	if n := len(sent.all()); n != 1 {
+		t.Fatalf("alerts while still open = %d, want the one", n)
+	}
+
+	status = "closed"
+	check(opened.Add(95 * time.Minute))
+	alerts = sent.all()
+	if len(alerts) != 2 {
+		t.Fatalf("alerts after closing = %d, want the alert and an all-clear", len(alerts))
+	}
+	if alerts[1].Subject != "Garage Door Closed - All Clear" || !strings.Contains(alerts[1].Message, "open for 1 hours and 35 minutes in total") {
+		t.Errorf("all-clear = %+v", alerts[1])
+	}
+
+	check(opened.Add(100 * time.Minute))
+	if n := len(sent.all()); n != 2 {
+		t.Errorf("alerts once closed = %d, want no more than the all-clear", n)
+	}
+}
+
+func TestClosedBeforeThresholdSendsNothing(t *testing.T) {
+	status := "open"
+	sent, check := monitorDoor(t, &status)
+	opened := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	check(opened)
+	check(opened.Add(20 * time.Minute))
+	status = "closed"
+	check(opened.Add(25 * time.Minute))
+	check(opened.Add(40 * time.Minute))
+
+	if alerts := sent.all(); len(alerts) != 0 {
+		t.Errorf("alerts = %+v, want none, not even an all-clear", alerts)
+	}
+}
+
+func TestSnoozeHoldsAlertUntilItRunsOut(t *testing.T) {
+	status := "open"
+	sent, check := monitorDoor(t, &status)
+	opened := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	check(opened)
+
+	// Snoozed for an hour, as the skill would
+	state, err := getDoorState(context.Background(), "dev1")
+	if err != nil || state == nil {
+		t.Fatalf("getDoorState = %+v, %v", state, err)
+	}
+	state.SnoozeUntil = opened.Add(time.Hour).Unix()
+	if err := saveDoorState(context.Background(), state); err != nil {
+		t.Fatalf("saveDoorState: %v", err)
+	}
+
+	for _, mins := range []int{30, 45, 59} {
+		check(opened.Add(time.Duration(mins) * time.Minute))
+	}
+	if alerts := sent.all(); len(alerts) != 0 {
+		t.Fatalf("alerted while snoozed: %+v", alerts)
+	}
+
+	check(opened.Add(60 * time.Minute))
+	check(opened.Add(65 * time.Minute))
+	alerts := sent.all()
+	if len(alerts) != 1 || !strings.Contains(alerts[0].Message, "open for 1 hours and 0 minutes") {
+		t.Errorf("alerts after the snooze = %+v, want one at the hour", alerts)
+	}
+}
+
+// TestScheduleHoldsAlertOvernight uses THRESHOLD_SCHEDULE, the monitor's
+// way of going quiet at set hours, to hold the alert through the night
+func TestScheduleHoldsAlertOvernight(t *testing.T) {
+	status := "open"
+	sent, check := monitorDoor(t, &status)
+
+	saved := thresholdSchedule
+	var err error
+	thresholdSchedule, err = loadThresholdSchedule(`[{"name":"overnight","days":["weekdays","weekends"],"start":"00:00","end":"07:00","thresholdMinutes":600}]`)
+	if err != nil {
+		t.Fatalf("loadThresholdSchedule: %v", err)
+	}
+	defer func() { thresholdSchedule = saved }()
+
+	opened := time.Date(2026, 10, 16, 1, 0, 0, 0, time.UTC)
+	for _, at := range []time.Time{opened, opened.Add(30 * time.Minute), opened.Add(5*time.Hour + 59*time.Minute)} {
+		check(at)
+	}
+	if alerts := sent.all(); len(alerts) != 0 {
+		t.Fatalf("alerted overnight: %+v", alerts)
+	}
+
+	check(opened.Add(6 * time.Hour))
+	check(opened.Add(6*time.Hour + 5*time.Minute))
+	alerts := sent.all()
+	if len(alerts) != 1 || !strings.Contains(alerts[0].Message, "open for 6 hours and 0 minutes") {
+		t.Errorf("alerts after the schedule ends = %+v, want one at 07:00", alerts)
+	}
+}
+
+func TestAlertEscalatesBySeverity(t *testing.T) {
+	status := "open"
+	sent, check := monitorDoor(t, &status)
+
+	const urgent = "arn:aws:sns:us-east-1:123456789012:garage-door-urgent"
+	bands, topic := severityBands, urgentTopicARN
+	var err error
+	severityBands, err = loadSeverityBands(`[{"label":"low","minutesPast":0},{"label":"high","minutesPast":60,"urgent":true}]`)
+	if err != nil {
+		t.Fatalf("loadSeverityBands: %v", err)
+	}
+	urgentTopicARN = urgent
+	defer func() { severityBands, urgentTopicARN = bands, topic }()
+
+	opened := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	for _, mins := range []int{0, 30, 45, 89} {
+		check(opened.Add(time.Duration(mins) * time.Minute))
+	}
+	alerts := sent.all()
+	if len(alerts) != 1 || !strings.Contains(alerts[0].Subject, "[LOW]") {
+		t.Fatalf("alerts before escalating = %+v, want one low alert", alerts)
+	}
+
+	check(opened.Add(90 * time.Minute))
+	check(opened.Add(120 * time.Minute))
+	alerts = sent.all()
+	if len(alerts) != 3 {
+		t.Fatalf("alerts after escalating = %d, want the low alert, a high alert and its urgent copy", len(alerts))
+	}
+	if alerts[1].Channel != testTopic || !strings.Contains(alerts[1].Subject, "[HIGH]") {
+		t.Errorf("escalated alert = %+v, want a high alert on the notification topic", alerts[1])
+	}
+	if alerts[2].Channel != urgent || !strings.Contains(alerts[2].Message, "1 hours and 30 minutes") {
+		t.Errorf("urgent alert = %+v, want a copy on the urgent topic", alerts[2])
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// metricsNamespace is the CloudWatch namespace from METRICS_NAMESPACE.
+// Metrics are only emitted when it is set.
+var metricsNamespace string
+
+// Metrics are buffered during an invocation and written by flushMetrics
+// before the handler returns, since a frozen container may never run again
+var (
+	pendingMetricsMu sync.Mutex
+	pendingMetrics   [][]byte
+)
+
+// metricsFlushTimeout bounds how long flushMetrics may take
+const metricsFlushTimeout = time.Second
+
+// metric is one value for emitMetrics
+type metric struct {
+	Name  string
+	Unit  string // CloudWatch unit, e.g. "Count" or "Milliseconds"
+	Value float64
+}
+
+// emitMetrics buffers metrics in CloudWatch embedded metric format, which
+// CloudWatch turns into metrics from the log without any API calls or extra
+// permissions
+func emitMetrics(dimensions map[string]string, metrics ...metric) {
+	if metricsNamespace == "" || len(metrics) == 0 {
+		return
+	}
+
+	dimensionKeys := make([]string, 0, len(dimensions))
+	for key := range dimensions {
+		dimensionKeys = append(dimensionKeys, key)
+	}
+	sort.Strings(dimensionKeys)
+
+	definitions := make([]map[string]string, len(metrics))
+	for i, m := range metrics {
+		definitions[i] = map[string]string{"Name": m.Name, "Unit": m.Unit}
+	}
+
+	entry := map[string]interface{}{
+		"_aws": map[string]interface{}{
+			"Timestamp": time.Now().UnixMilli(),
+			"CloudWatchMetrics": []map[string]interface{}{{
+				"Namespace":  metricsNamespace,
+				"Dimensions": [][]string{dimensionKeys},
+				"Metrics":    definitions,
+			}},
+		},
+	}
+	for key, value := range dimensions {
+		entry[key] = value
+	}
+	for _, m := range metrics {
+		entry[m.Name] = m.Value
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		fmt.Printf("Error marshaling metrics: %v\n", err)
+		return
+	}
+
+	pendingMetricsMu.Lock()
+	defer pendingMetricsMu.Unlock()
+	pendingMetrics = append(pendingMetrics, line)
+}
+
+// flushMetrics writes out the buffered metrics. It is safe to call more
+// than once, and gives up on anything left after metricsFlushTimeout or when
+// ctx is done, so it can't hold the invocation past its deadline.
+func flushMetrics(ctx context.Context) {
+	pendingMetricsMu.Lock()
+	lines := pendingMetrics
+	pendingMetrics = nil
+	pendingMetricsMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, metricsFlushTimeout)
+	defer cancel()
+
+	for i, line := range lines {
+		if ctx.Err() != nil {
+			fmt.Printf("Dropping %d metric lines: %v\n", len(lines)-i, ctx.Err())
+			return
+		}
+		fmt.Println(string(line))
+	}
+}
+
+// recordNotificationMetrics records one publish attempt on a channel, so an
+// alarm on NotificationFailure (or missing NotificationSuccess) catches
+// alerts that aren't being delivered
+func recordNotificationMetrics(channel string, latency time.Duration, err error) {
+	success, failure := 1.0, 0.0
+	if err != nil {
+		success, failure = 0, 1
+	}
+	emitMetrics(map[string]string{"Channel": channel},
+		metric{Name: "NotificationSuccess", Unit: "Count", Value: success},
+		metric{Name: "NotificationFailure", Unit: "Count", Value: failure},
+		metric{Name: "NotificationLatencyMs", Unit: "Milliseconds", Value: float64(latency.Milliseconds())},
+	)
+}
+
+// openRatioWindow is the period DoorOpenRatio covers
+const openRatioWindow = 24 * time.Hour
+
+// recordOpenRatio emits DoorOpenRatio, the fraction of the past 24 hours the
+// door was open, from the events table and the door's current state
+func recordOpenRatio(ctx context.Context, state *DoorState, current time.Time, result *MonitorResult) {
+	if metricsNamespace == "" || eventsTable == "" {
+		return
+	}
+
+	// Look back twice as far so an open before the window pairs with its close
+	since := current.Add(-2 * openRatioWindow)
+	events, err := queryDoorEvents(ctx, state.DeviceID, since)
+	if err != nil {
+		fmt.Printf("Error computing open ratio: %v\n", err)
+		return
+	}
+
+	sessions := pairOpenSessions(events, current)
+	switch {
+	case len(events) > 0 && events[0].Status == "closed":
+		// Already open when the lookback started
+		leading := openSession{Opened: since, Closed: time.Unix(events[0].Timestamp, 0)}
+		sessions = append([]openSession{leading}, sessions...)
+	case len(events) == 0 && state.Status == "open" && state.LastOpenedTime > 0:
+		sessions = []openSession{{Opened: time.Unix(state.LastOpenedTime, 0), Closed: current, StillOpen: true}}
+	}
+
+	ratio := openRatio(sessions, current.Add(-openRatioWindow), current)
+	result.OpenRatio = &ratio
+	fmt.Printf("Door open ratio over the past %s: %.3f\n", openRatioWindow, ratio)
+	emitMetrics(map[string]string{"DeviceId": state.DeviceID},
+		metric{Name: "DoorOpenRatio", Unit: "None", Value: ratio},
+	)
+}
+
+// openRatio is the fraction of start to end covered by the sessions
+func openRatio(sessions []openSession, start, end time.Time) float64 {
+	var open time.Duration
+	for _, session := range sessions {
+		from, to := session.Opened, session.Closed
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		if to.After(from) {
+			open += to.Sub(from)
+		}
+	}
+	return float64(open) / float64(end.Sub(start))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// stateSchemaVersion is the DoorState layout this code writes. Bump it when
+// adding a field whose zero value isn't a safe default, and fill the field
+// in applyStateDefaults.
+const stateSchemaVersion = 1
+
+// applyStateDefaults fills in fields that items written before they existed
+// lack, so a missing threshold reads as the configured default rather than
+// zero ("alert immediately")
+func applyStateDefaults(state *DoorState) {
+	if state.SchemaVersion >= stateSchemaVersion {
+		return
+	}
+	if state.AlertThresholdMins <= 0 {
+		state.AlertThresholdMins = thresholdMinutes
+	}
+	state.SchemaVersion = stateSchemaVersion
+}
+
+// runMigration backfills the defaults into every door state item written with
+// an older schema. Reads already apply them, so this only makes the stored
+// items match; it is safe to run more than once. Only the new attributes are
+// set, so attributes this function doesn't model are left alone.
+func runMigration(ctx context.Context) error {
+	var scanned, migrated int
+
+	err := dynamoClient.ScanPagesWithContext(ctx, &dynamodb.ScanInput{
+		TableName: aws.String(doorStateTable),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			scanned++
+
+			var state DoorState
+			if err := unmarshalStateItem(item, &state); err != nil {
+				fmt.Printf("Skipping unreadable item: %v\n", err)
+				continue
+			}
+			if state.DeviceID == configItemID || strings.HasPrefix(state.DeviceID, userPrefsPrefix) {
+				continue
+			}
+			if state.SchemaVersion >= stateSchemaVersion {
+				continue
+			}
+
+			if err := migrateDoorState(ctx, state.DeviceID); err != nil {
+				fmt.Printf("Error migrating %s: %v\n", state.DeviceID, err)
+				continue
+			}
+			migrated++
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("error scanning door states: %w", err)
+	}
+
+	fmt.Printf("Migration complete - %d of %d items updated\n", migrated, scanned)
+	return nil
+}
+
+// migrateDoorState sets the schema version and any missing defaults on one item
+func migrateDoorState(ctx context.Context, deviceID string) error {
+	_, err := dynamoClient.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(doorStateTable),
+		Key:              stateKey(deviceID),
+		UpdateExpression: aws.String("SET schemaVersion = :version, alertThresholdMins = if_not_exists(alertThresholdMins, :threshold)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":version":   {N: aws.String(fmt.Sprint(stateSchemaVersion))},
+			":threshold": {N: aws.String(fmt.Sprint(thresholdMinutes))},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error updating item in DynamoDB: %w", err)
+	}
+	return nil
+}
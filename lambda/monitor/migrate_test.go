@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// seedStates stores a door state table with items from before schema
+// version 1, one already migrated, and the config and preference items that
+// share the table
+func seedStates(t *testing.T) *fakeDynamoDB {
+	t.Helper()
+	db := fakeDoorState(t)
+	saved := thresholdMinutes
+	thresholdMinutes = 30
+	t.Cleanup(func() { thresholdMinutes = saved })
+
+	items := []map[string]*dynamodb.AttributeValue{
+		{"deviceId": {S: aws.String("dev1")}, "status": {S: aws.String("open")}},
+		{"deviceId": {S: aws.String("dev2")}, "status": {S: aws.String("closed")}, "alertThresholdMins": {N: aws.String("45")}},
+		{"deviceId": {S: aws.String("dev3")}, "status": {S: aws.String("closed")}, "schemaVersion": {N: aws.String("1")}, "alertThresholdMins": {N: aws.String("60")}},
+		{"deviceId": {S: aws.String(configItemID)}},
+		{"deviceId": {S: aws.String(userPrefsPrefix + "owner")}, "lastOperatedDevice": {S: aws.String("dev1")}},
+	}
+	for _, item := range items {
+		_, err := dynamoClient.PutItemWithContext(context.Background(), &dynamodb.PutItemInput{
+			TableName: aws.String(doorStateTable),
+			Item:      item,
+		})
+		if err != nil {
+			t.Fatalf("seeding %s: %v", aws.StringValue(item["deviceId"].S), err)
+		}
+	}
+	return db
+}
+
+func TestOldSchemaReadsWithDefaults(t *testing.T) {
+	seedStates(t)
+
+	tests := []struct {
+		deviceID      string
+		wantThreshold int
+	}{
+		{"dev1", 30}, // No threshold yet, so the configured one
+		{"dev2", 45}, // Set by hand before the version existed; kept
+		{"dev3", 60},
+	}
+	for _, tt := range tests {
+		state, err := getDoorState(context.Background(), tt.deviceID)
+		if err != nil || state == nil {
+			t.Fatalf("getDoorState(%s) = %+v, %v", tt.deviceID, state, err)
+		}
+		if state.AlertThresholdMins != tt.wantThreshold || state.SchemaVersion != stateSchemaVersion {
+			t.Errorf("%s read with threshold %d at version %d, want %d at version %d",
+				tt.deviceID, state.AlertThresholdMins, state.SchemaVersion, tt.wantThreshold, stateSchemaVersion)
+		}
+	}
+}
+
+func TestMigrationRewritesOldItems(t *testing.T) {
+	db := seedStates(t)
+
+	if err := runMigration(context.Background()); err != nil {
+		t.Fatalf("runMigration: %v", err)
+	}
+
+	db.mu.Lock()
+	updates := db.updates[doorStateTable]
+	db.mu.Unlock()
+
+	var migrated []string
+	for _, raw := range updates {
+		var update struct {
+			Key                       map[string]struct{ S string }
+			UpdateExpression          string
+			ExpressionAttributeValues map[string]struct{ N string }
+		}
+		if err := json.Unmarshal(raw, &update); err != nil {
+			t.Fatalf("UpdateItem request: %v", err)
+		}
+		deviceID := update.Key[stateKeyName].S
+		migrated = append(migrated, deviceID)
+
+		if update.ExpressionAttributeValues[":version"].N != "1" || update.ExpressionAttributeValues[":threshold"].N != "30" {
+			t.Errorf("%s updated with %+v, want version 1 and threshold 30", deviceID, update.ExpressionAttributeValues)
+		}
+		// A threshold set before the version existed must survive
+		if !strings.Contains(update.UpdateExpression, "if_not_exists(alertThresholdMins") {
+			t.Errorf("%s update %q overwrites the threshold", deviceID, update.UpdateExpression)
+		}
+	}
+	sort.Strings(migrated)
+	if strings.Join(migrated, ",") != "dev1,dev2" {
+		t.Errorf("migrated %v, want only the old door items, dev1 and dev2", migrated)
+	}
+}
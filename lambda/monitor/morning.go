@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The morning report says whether the door was opened overnight, for
+// {"mode":"morning_report"}. The night runs from OVERNIGHT_START to
+// OVERNIGHT_END in NOTIFICATION_TZ and usually crosses midnight.
+var (
+	overnightStart = 22 * 60 // Minutes after local midnight
+	overnightEnd   = 6 * 60
+)
+
+// runMorningReport summarizes the last night's open sessions for every
+// monitored door from the events table and sends them as one report
+// through the notification channels. A door whose events can't be read is
+// left out and its error returned, but the other doors are still reported.
+func runMorningReport(ctx context.Context, result *MonitorResult) error {
+	if eventsTable == "" {
+		return fmt.Errorf("EVENTS_TABLE not configured")
+	}
+	ids := monitoredDevices()
+	if len(ids) == 0 {
+		return fmt.Errorf("no devices configured: set PARTICLE_DEVICE_ID or DEVICE_MAP")
+	}
+
+	current := now()
+	start, end := overnightWindow(current)
+	fmt.Printf("Morning report for %s to %s\n", start.Format(time.RFC3339), end.Format(time.RFC3339))
+
+	var summaries []string
+	var errs []error
+	for _, id := range ids {
+		sessions, err := nightSessions(ctx, id, start, current)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", id, err))
+			continue
+		}
+		summaries = append(summaries, morningReportSummary(id, overnightSessions(sessions, start, end)))
+	}
+	if len(summaries) == 0 {
+		return errors.Join(errs...)
+	}
+
+	summary := strings.Join(summaries, " ")
+	result.Summary = summary
+	fmt.Println(summary)
+
+	if !alertingEnabled {
+		fmt.Println("Alerting disabled - not sending the morning report")
+		return errors.Join(errs...)
+	}
+	message := fmt.Sprintf("%s\n\nNight: %s to %s", strings.Join(summaries, "\n"),
+		start.Format("Mon 3:04 PM"), end.Format("Mon 3:04 PM MST"))
+	if err := publishNotification(ctx, "Garage Door Morning Report", message); err != nil {
+		return fmt.Errorf("error sending morning report: %w", err)
+	}
+	result.Notified = true
+	return errors.Join(errs...)
+}
+
+// nightSessions pairs a door's open sessions from a day before the night
+// started until now
+func nightSessions(ctx context.Context, deviceID string, start, current time.Time) ([]openSession, error) {
+	// Start a day early so a door opened in the evening pairs with its close
+	since := start.Add(-24 * time.Hour)
+	events, err := queryDoorEvents(ctx, deviceID, since)
+	if err != nil {
+		return nil, err
+	}
+	sessions := pairOpenSessions(events, current)
+
+	// A door opened before then has no open event to pair
+	switch {
+	case len(events) > 0 && events[0].Status == "closed":
+		// Already open when the lookback started
+		leading := openSession{Opened: since, Closed: time.Unix(events[0].Timestamp, 0)}
+		sessions = append([]openSession{leading}, sessions...)
+	case len(events) == 0:
+		if state, err := getDoorState(ctx, deviceID); err != nil {
+			fmt.Printf("Error getting door state: %v\n", err)
+		} else if state != nil && state.Status == "open" && state.LastOpenedTime > 0 {
+			sessions = append(sessions, openSession{Opened: time.Unix(state.LastOpenedTime, 0), Closed: current, StillOpen: true})
+		}
+	}
+	return sessions, nil
+}
+
+// overnightWindow returns the start and end of the most recent night to
+// have ended by now, in local time. Dates are built from the local calendar
+// so a DST change overnight doesn't shift either end.
+func overnightWindow(current time.Time) (time.Time, time.Time) {
+	local := current.In(localTimezone)
+	at := func(day time.Time, mins int) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), 0, mins, 0, 0, localTimezone)
+	}
+
+	end := at(local, overnightEnd)
+	if end.After(local) {
+		end = at(local.AddDate(0, 0, -1), overnightEnd)
+	}
+
+	start := at(end, overnightStart)
+	if overnightStart >= overnightEnd {
+		// Crosses midnight, so it started the evening before
+		start = at(end.AddDate(0, 0, -1), overnightStart)
+	}
+	return start, end
+}
+
+// overnightSessions keeps the sessions that overlap the night
+func overnightSessions(sessions []openSession, start, end time.Time) []openSession {
+	var overnight []openSession
+	for _, session := range sessions {
+		if session.Opened.Before(end) && session.Closed.After(start) {
+			overnight = append(overnight, session)
+		}
+	}
+	return overnight
+}
+
+// morningReportSummary describes a door's night, e.g. "Your garage door was
+// open from 1:10 to 1:25 AM."
+func morningReportSummary(deviceID string, sessions []openSession) string {
+	name := ownedName(deviceID)
+	if len(sessions) == 0 {
+		return fmt.Sprintf("Your %s stayed closed all night.", name)
+	}
+
+	var ranges []string
+	stillOpen := false
+	for _, session := range sessions {
+		if session.StillOpen {
+			ranges = append(ranges, "from "+clockTime(session.Opened))
+			stillOpen = true
+			continue
+		}
+		ranges = append(ranges, "from "+clockRange(session.Opened, session.Closed))
+	}
+
+	joined := ranges[len(ranges)-1]
+	if len(ranges) > 1 {
+		joined = strings.Join(ranges[:len(ranges)-1], ", ") + " and " + joined
+	}
+	summary := fmt.Sprintf("Your %s was open %s", name, joined)
+	if stillOpen {
+		summary += ", and it's still open"
+	}
+	return summary + "."
+}
+
+// clockTime formats a local time of day, e.g. "1:10 AM"
+func clockTime(t time.Time) string {
+	return t.In(localTimezone).Format("3:04 PM")
+}
+
+// clockRange formats two local times, sharing the AM/PM when they're on
+// the same half of the same day, e.g. "1:10 to 1:25 AM" or "11:50 PM to
+// 12:10 AM"
+func clockRange(from, to time.Time) string {
+	from, to = from.In(localTimezone), to.In(localTimezone)
+	if from.Format("2006-01-02 PM") == to.Format("2006-01-02 PM") {
+		return from.Format("3:04") + " to " + to.Format("3:04 PM")
+	}
+	return from.Format("3:04 PM") + " to " + to.Format("3:04 PM")
+}
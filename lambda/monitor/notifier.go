@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+// Notifier delivers one message to a topic. Every alert the monitor sends,
+// to the notification, fallback, urgent and recipient topics, goes through
+// notifier, so a recording one can stand in for SNS when checking which
+// alerts go out.
+type Notifier interface {
+	Publish(ctx context.Context, topicARN, subject, message string) error
+}
+
+// notifier is the monitor's Notifier
+var notifier Notifier = snsNotifier{}
+
+// snsNotifier publishes with the SNS client set up for the topic's region
+type snsNotifier struct{}
+
+func (snsNotifier) Publish(ctx context.Context, topicARN, subject, message string) error {
+	svc, err := topicClient(topicARN)
+	if err != nil {
+		return err
+	}
+	_, err = svc.PublishWithContext(ctx, &sns.PublishInput{
+		TopicArn: aws.String(topicARN),
+		Subject:  aws.String(subject),
+		Message:  aws.String(message),
+	})
+	return err
+}
+
+// topicClient returns the SNS client for a configured topic
+func topicClient(topicARN string) (*sns.SNS, error) {
+	switch {
+	case topicARN == notificationTopicARN && snsClient != nil:
+		return snsClient, nil
+	case topicARN == fallbackTopicARN && fallbackSNSClient != nil:
+		return fallbackSNSClient, nil
+	case topicARN == urgentTopicARN && urgentSNSClient != nil:
+		return urgentSNSClient, nil
+	}
+
+	region, err := topicRegion(topicARN)
+	if err != nil {
+		return nil, err
+	}
+	if svc, ok := recipientClients[region]; ok {
+		return svc, nil
+	}
+	return nil, fmt.Errorf("no SNS client for topic %s", topicARN)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// published is one message a recordingNotifier was asked to send
+type published struct {
+	Channel string // The topic ARN
+	Subject string
+	Message string
+}
+
+// recordingNotifier keeps every publish instead of sending it. Publishes to
+// a topic in fail return an error and aren't kept.
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []published
+	fail map[string]bool
+}
+
+func (n *recordingNotifier) Publish(ctx context.Context, topicARN, subject, message string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.fail[topicARN] {
+		return errors.New("publish failed")
+	}
+	n.sent = append(n.sent, published{Channel: topicARN, Subject: subject, Message: message})
+	return nil
+}
+
+// all returns what has been published so far, oldest first
+func (n *recordingNotifier) all() []published {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]published(nil), n.sent...)
+}
+
+// useRecordingNotifier swaps in a recordingNotifier for the length of the test
+func useRecordingNotifier(t *testing.T) *recordingNotifier {
+	t.Helper()
+	recorder := &recordingNotifier{fail: map[string]bool{}}
+	saved := notifier
+	notifier = recorder
+	t.Cleanup(func() { notifier = saved })
+	return recorder
+}
+
+func TestPublishNotificationFallsBack(t *testing.T) {
+	const fallback = "arn:aws:sns:us-west-2:123456789012:garage-door"
+	sent := useRecordingNotifier(t)
+	topic, secondary, enabled := notificationTopicARN, fallbackTopicARN, alertingEnabled
+	notificationTopicARN, fallbackTopicARN, alertingEnabled = testTopic, fallback, true
+	defer func() { notificationTopicARN, fallbackTopicARN, alertingEnabled = topic, secondary, enabled }()
+
+	if err := publishNotification(context.Background(), "subject", "message"); err != nil {
+		t.Fatalf("publishNotification: %v", err)
+	}
+	if alerts := sent.all(); len(alerts) != 1 || alerts[0].Channel != testTopic {
+		t.Fatalf("published %+v, want the primary topic only", alerts)
+	}
+
+	sent.fail[testTopic] = true
+	if err := publishNotification(context.Background(), "subject", "message"); err != nil {
+		t.Fatalf("publishNotification with the primary down: %v", err)
+	}
+	if alerts := sent.all(); len(alerts) != 2 || alerts[1].Channel != fallback {
+		t.Fatalf("published %+v, want the fallback topic", alerts)
+	}
+
+	sent.fail[fallback] = true
+	if err := publishNotification(context.Background(), "subject", "message"); err == nil {
+		t.Error("publishNotification succeeded with both topics down")
+	}
+}
+
+func TestRecipientsAlertedOnTheirOwnTopics(t *testing.T) {
+	sent := useRecordingNotifier(t)
+	saved, enabled := recipients, alertingEnabled
+	recipients = []Recipient{
+		{Name: "sam", TopicARN: "arn:aws:sns:us-east-1:123456789012:sam", ThresholdMinutes: 15},
+		{Name: "alex", TopicARN: "arn:aws:sns:us-east-1:123456789012:alex"},
+	}
+	alertingEnabled = true
+	defer func() { recipients, alertingEnabled = saved, enabled }()
+
+	state := &DoorState{DeviceID: "dev1", Status: "open", DurationOpenMins: 20}
+	if !notifyRecipients(context.Background(), state, 30, nil, severityBand{}) {
+		t.Fatal("nobody was alerted at 20 minutes")
+	}
+	if alerts := sent.all(); len(alerts) != 1 || alerts[0].Channel != recipients[0].TopicARN {
+		t.Fatalf("published %+v, want sam only", alerts)
+	}
+	if state.NotificationSent {
+		t.Error("NotificationSent set before everyone was alerted")
+	}
+
+	state.DurationOpenMins = 30
+	notifyRecipients(context.Background(), state, 30, nil, severityBand{})
+	if alerts := sent.all(); len(alerts) != 2 || alerts[1].Channel != recipients[1].TopicARN {
+		t.Fatalf("published %+v, want alex next", alerts)
+	}
+	if !state.NotificationSent {
+		t.Error("NotificationSent not set once everyone was alerted")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// obstructionVariable is the cloud variable the opener reports an
+// obstruction on, from OBSTRUCTION_VAR (default "obstructed"). Firmware that
+// doesn't have it is fine: the read fails, and after the first failure that
+// looks like a missing variable it isn't tried again on that device in this
+// container.
+var (
+	obstructionVariable  string
+	obstructionMissingMu sync.Mutex
+	obstructionMissing   = map[string]bool{} // By device ID
+)
+
+// doorObstructed reads the obstruction variable. Any error or unusable value
+// counts as no obstruction, so it never blocks a close by itself.
+func doorObstructed(ctx context.Context, deviceID string) bool {
+	obstructionMissingMu.Lock()
+	missing := obstructionMissing[deviceID]
+	obstructionMissingMu.Unlock()
+	if obstructionVariable == "" || missing {
+		return false
+	}
+
+	raw, err := getParticleVariable(ctx, deviceID, obstructionVariable)
+	if err != nil {
+		if strings.Contains(err.Error(), "status 404") {
+			fmt.Printf("%s not found - not checking for obstructions\n", obstructionVariable)
+			obstructionMissingMu.Lock()
+			obstructionMissing[deviceID] = true
+			obstructionMissingMu.Unlock()
+			return false
+		}
+		fmt.Printf("Error reading %s (ignored): %v\n", obstructionVariable, err)
+		return false
+	}
+
+	obstructed, ok := parseObstructed(raw)
+	if !ok {
+		fmt.Printf("Unusable %s value %s (ignored)\n", obstructionVariable, string(raw))
+		return false
+	}
+	if obstructed {
+		fmt.Println("Opener reports an obstruction")
+	}
+	return obstructed
+}
+
+// parseObstructed accepts a boolean, 0/1, or the same as a string
+func parseObstructed(raw json.RawMessage) (bool, bool) {
+	text := strings.TrimSpace(string(raw))
+	var quoted string
+	if err := json.Unmarshal(raw, &quoted); err == nil {
+		text = strings.TrimSpace(quoted)
+	}
+
+	switch strings.ToLower(text) {
+	case "true", "1", "yes", "obstructed":
+		return true, true
+	case "false", "0", "no", "clear", "":
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// notifyObstruction tells everyone the monitor won't close the door because
+// the opener reports an obstruction. It is sent once per open session.
+func notifyObstruction(ctx context.Context, state *DoorState, reason string) bool {
+	if state.ObstructionAlertSent {
+		fmt.Println("Obstruction already reported this open session")
+		return false
+	}
+
+	message := fmt.Sprintf(" GARAGE DOOR OBSTRUCTED\n\nI can't close your %s: the opener reports an obstruction. %s Please clear it and close the door by hand.\n\nTime: %s",
+		ownedName(state.DeviceID), reason, now().Format("2006-01-02 15:04:05 MST"))
+	if err := publishNotification(ctx, "Garage Door Can't Close - Obstruction Detected", message); err != nil {
+		fmt.Printf("Error sending obstruction notification: %v\n", err)
+		return false
+	}
+	state.ObstructionAlertSent = true
+	return true
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Motion deferral is opt-in: set MOTION_VAR to a cloud variable reporting
+// motion in the garage, and auto-close waits while there has been motion
+// within MOTION_WINDOW_MINUTES. After MOTION_HARD_LIMIT_MINUTES of deferring
+// it closes anyway, with a warning in the notification.
+var (
+	motionVariable  string
+	motionWindow    time.Duration
+	motionHardLimit time.Duration
+)
+
+// recentMotion reports whether the motion variable shows movement within
+// the window. It may be a boolean for motion right now, or the Unix time of
+// the last motion. Errors count as no motion, so a broken sensor never keeps
+// the door open.
+func recentMotion(ctx context.Context, deviceID string, current time.Time) bool {
+	raw, err := getParticleVariable(ctx, deviceID, motionVariable)
+	if err != nil {
+		fmt.Printf("Error reading %s - not deferring auto-close: %v\n", motionVariable, err)
+		return false
+	}
+
+	text := strings.TrimSpace(string(raw))
+	var quoted string
+	if err := json.Unmarshal(raw, &quoted); err == nil {
+		text = strings.TrimSpace(quoted)
+	}
+
+	switch strings.ToLower(text) {
+	case "true", "yes":
+		return true
+	case "false", "no", "":
+		return false
+	}
+
+	lastMotion, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		fmt.Printf("Unusable %s value %s - not deferring auto-close\n", motionVariable, string(raw))
+		return false
+	}
+	if lastMotion <= 1 {
+		// 0 and 1 are a plain flag
+		return lastMotion == 1
+	}
+	since := current.Sub(time.Unix(lastMotion, 0))
+	fmt.Printf("Last motion %s ago\n", since.Round(time.Second))
+	return since < motionWindow
+}
+
+// deferAutoClose decides whether recent motion should hold off auto-close
+// this run. The next check tries again. Once deferrals have gone on past
+// MOTION_HARD_LIMIT_MINUTES it lets the close go ahead and returns a warning
+// for the notification.
+func deferAutoClose(ctx context.Context, state *DoorState, current time.Time) (bool, string) {
+	if motionVariable == "" || !recentMotion(ctx, state.DeviceID, current) {
+		state.AutoCloseDeferredSince = 0
+		return false, ""
+	}
+
+	if state.AutoCloseDeferredSince == 0 {
+		state.AutoCloseDeferredSince = current.Unix()
+	}
+	deferred := current.Sub(time.Unix(state.AutoCloseDeferredSince, 0))
+	if deferred < motionHardLimit {
+		fmt.Printf("Recent motion - deferring auto-close (deferred for %s)\n", deferred.Round(time.Second))
+		return true, ""
+	}
+
+	fmt.Printf("Motion has deferred auto-close for %s - closing anyway\n", deferred.Round(time.Second))
+	return false, fmt.Sprintf("There has been movement in the garage for %d minutes, so I closed it anyway. Check that nobody was in the way.",
+		int64(deferred.Minutes()))
+}
+
+// notifyOpenWhileAway sends an urgent alert when the door is open while the
+// config item's away flag is set, without waiting for the threshold. It has
+// its own AwayAlertSent flag, so it neither stops nor is stopped by the
+// open-too-long alert, and is sent once per open session.
+func notifyOpenWhileAway(ctx context.Context, state *DoorState) bool {
+	if state.Status != "open" || state.AwayAlertSent || !flagOr(currentFlags(ctx).Away, false) {
+		return false
+	}
+
+	openedAt := time.Unix(state.LastOpenedTime, 0).In(localTimezone)
+	message := fmt.Sprintf(" GARAGE DOOR OPENED WHILE YOU WERE AWAY\n\nYour %s is open and no one is home. It opened at %s.\n\nIf you weren't expecting this, check on it now.",
+		ownedName(state.DeviceID), openedAt.Format("3:04 PM MST on Jan 2"))
+	if err := publishNotification(ctx, "URGENT: Garage Door Opened While You Were Away", message); err != nil {
+		fmt.Printf("Error sending away notification: %v\n", err)
+		return false
+	}
+
+	fmt.Println("Away notification sent")
+	state.AwayAlertSent = true
+	return true
+}
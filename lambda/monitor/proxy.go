@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// configureProxy routes Particle calls through PARTICLE_PROXY_URL when it is
+// set. Otherwise the standard HTTPS_PROXY, HTTP_PROXY and NO_PROXY variables
+// apply, as they do for any Go client on the default transport. Either way
+// the proxy in use, if any, is logged.
+func configureProxy(raw string) error {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if raw != "" {
+		proxyURL, err := url.Parse(raw)
+		if err != nil {
+			return fmt.Errorf("invalid PARTICLE_PROXY_URL: %w", err)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("PARTICLE_PROXY_URL must be an http, https or socks5 URL, got %q", proxyURL.Scheme)
+		}
+		if proxyURL.Host == "" {
+			return fmt.Errorf("PARTICLE_PROXY_URL has no host")
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	httpClient.Transport = transport
+
+	// Report what the Particle API will actually go through
+	req, err := http.NewRequest("GET", particleAPIBase, nil)
+	if err != nil {
+		return nil
+	}
+	if proxyURL, err := transport.Proxy(req); err != nil {
+		return fmt.Errorf("invalid proxy configuration: %w", err)
+	} else if proxyURL != nil {
+		fmt.Printf("Particle calls go through proxy %s\n", proxyURL.Redacted())
+	}
+	return nil
+}
+
+// parseAPIBase validates PARTICLE_API_BASE, which must be an https URL. Plain
+// http is only accepted for a loopback host, such as a local mock server.
+func parseAPIBase(raw string) (string, error) {
+	base, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid PARTICLE_API_BASE: %w", err)
+	}
+	if base.Host == "" {
+		return "", fmt.Errorf("PARTICLE_API_BASE %q has no host", raw)
+	}
+	if base.RawQuery != "" || base.Fragment != "" {
+		return "", fmt.Errorf("PARTICLE_API_BASE %q must not have a query or fragment", raw)
+	}
+
+	switch base.Scheme {
+	case "https":
+	case "http":
+		if ip := net.ParseIP(base.Hostname()); base.Hostname() != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return "", fmt.Errorf("PARTICLE_API_BASE must be https unless it is on localhost, got %q", raw)
+		}
+	default:
+		return "", fmt.Errorf("PARTICLE_API_BASE must be an https URL, got %q", raw)
+	}
+	return strings.TrimSuffix(base.String(), "/"), nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+// Recipient is one person alerted about the open door, with their own
+// threshold and SNS topic
+type Recipient struct {
+	Name             string `json:"name"`
+	TopicARN         string `json:"topicArn"`
+	ThresholdMinutes int    `json:"thresholdMinutes"` // Defaults to the door's threshold
+}
+
+// recipients is loaded from NOTIFICATION_RECIPIENTS. When it is empty the
+// open-door alert goes to NOTIFICATION_TOPIC_ARN once the door's threshold
+// passes.
+var recipients []Recipient
+
+// recipientClients holds an SNS client per region used by a recipient topic
+var recipientClients = map[string]*sns.SNS{}
+
+// loadRecipients parses NOTIFICATION_RECIPIENTS, a JSON list of recipients, e.g.
+// [{"name":"sam","topicArn":"arn:aws:sns:...:sam","thresholdMinutes":30}]
+func loadRecipients(raw string, sess *session.Session) ([]Recipient, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var loaded []Recipient
+	if err := json.Unmarshal([]byte(raw), &loaded); err != nil {
+		return nil, fmt.Errorf("error parsing NOTIFICATION_RECIPIENTS: %w", err)
+	}
+
+	seen := make(map[string]bool, len(loaded))
+	for i, recipient := range loaded {
+		name := strings.ToLower(strings.TrimSpace(recipient.Name))
+		if name == "" || seen[name] {
+			return nil, fmt.Errorf("NOTIFICATION_RECIPIENTS entry %d needs a unique name", i)
+		}
+		seen[name] = true
+		loaded[i].Name = name
+
+		region, err := topicRegion(recipient.TopicARN)
+		if err != nil {
+			return nil, fmt.Errorf("NOTIFICATION_RECIPIENTS entry %q: %w", name, err)
+		}
+		if _, ok := recipientClients[region]; !ok {
+			recipientClients[region] = sns.New(sess, aws.NewConfig().WithRegion(region))
+		}
+	}
+
+	return loaded, nil
+}
+
+// recipientThreshold is how long the door must be open before alerting r,
+// given the door's current threshold and the weather
+func recipientThreshold(r Recipient, doorThreshold int64, cold *coldReading) int64 {
+	if r.ThresholdMinutes > 0 {
+		return cold.capThreshold(int64(r.ThresholdMinutes))
+	}
+	return doorThreshold
+}
+
+// notifyRecipients alerts each recipient whose threshold has passed and who
+// hasn't been alerted this open session. NotificationSent is set once all of
+// them have been. Returns whether anyone was alerted.
+func notifyRecipients(ctx context.Context, state *DoorState, doorThreshold int64, cold *coldReading, severity severityBand) bool {
+	var due []Recipient
+	for _, recipient := range recipients {
+		if !state.RecipientsNotified[recipient.Name] && state.DurationOpenMins >= recipientThreshold(recipient, doorThreshold, cold) {
+			due = append(due, recipient)
+		}
+	}
+	if len(due) == 0 {
+		return false
+	}
+
+	// Everyone alerted in this run shares one close link
+	subject, message := openDoorAlert(state, cold, severity)
+
+	notified := false
+	for _, recipient := range due {
+		if err := publishToRecipient(ctx, recipient, subject, message); err != nil {
+			fmt.Printf("Error notifying %s: %v\n", recipient.Name, err)
+			continue
+		}
+		if state.RecipientsNotified == nil {
+			state.RecipientsNotified = make(map[string]bool)
+		}
+		state.RecipientsNotified[recipient.Name] = true
+		notified = true
+		fmt.Printf("Notified %s\n", recipient.Name)
+	}
+
+	state.NotificationSent = true
+	for _, recipient := range recipients {
+		if !state.RecipientsNotified[recipient.Name] {
+			state.NotificationSent = false
+		}
+	}
+	return notified
+}
+
+// publishToRecipients sends a message to every recipient, for alerts that
+// aren't tied to a threshold
+func publishToRecipients(ctx context.Context, subject, message string) error {
+	var failed []string
+	for _, recipient := range recipients {
+		if err := publishToRecipient(ctx, recipient, subject, message); err != nil {
+			fmt.Printf("Error notifying %s: %v\n", recipient.Name, err)
+			failed = append(failed, recipient.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not notify %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// publishToRecipient publishes to one recipient's topic
+func publishToRecipient(ctx context.Context, recipient Recipient, subject, message string) error {
+	return publishToTopic(ctx, recipient.TopicARN, subject, message)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ThresholdProfile overrides the alert threshold during a weekly time range,
+// e.g. a longer threshold at weekends
+type ThresholdProfile struct {
+	Name             string   `json:"name"`
+	Days             []string `json:"days"`  // "mon".."sun", or "weekdays"/"weekends"
+	Start            string   `json:"start"` // Local time "HH:MM", inclusive
+	End              string   `json:"end"`   // Local time "HH:MM", exclusive; "24:00" is midnight
+	ThresholdMinutes int      `json:"thresholdMinutes"`
+
+	days     map[time.Weekday]bool
+	startMin int
+	endMin   int
+}
+
+// thresholdSchedule is loaded from THRESHOLD_SCHEDULE. The first profile
+// covering the current local time sets the threshold; outside all of them
+// the door's own threshold applies.
+var thresholdSchedule []ThresholdProfile
+
+var weekdayNames = map[string][]time.Weekday{
+	"sun":      {time.Sunday},
+	"mon":      {time.Monday},
+	"tue":      {time.Tuesday},
+	"wed":      {time.Wednesday},
+	"thu":      {time.Thursday},
+	"fri":      {time.Friday},
+	"sat":      {time.Saturday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+// loadThresholdSchedule parses and validates THRESHOLD_SCHEDULE, a JSON list
+// of profiles, e.g.
+// [{"name":"weekend","days":["weekends"],"start":"00:00","end":"24:00","thresholdMinutes":480}]
+func loadThresholdSchedule(raw string) ([]ThresholdProfile, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var profiles []ThresholdProfile
+	if err := json.Unmarshal([]byte(raw), &profiles); err != nil {
+		return nil, fmt.Errorf("error parsing THRESHOLD_SCHEDULE: %w", err)
+	}
+
+	for i := range profiles {
+		profile := &profiles[i]
+		if profile.Name == "" {
+			profile.Name = fmt.Sprintf("profile %d", i+1)
+		}
+		if profile.ThresholdMinutes <= 0 {
+			return nil, fmt.Errorf("THRESHOLD_SCHEDULE %s: thresholdMinutes must be positive", profile.Name)
+		}
+
+		profile.days = make(map[time.Weekday]bool)
+		for _, day := range profile.Days {
+			weekdays, ok := weekdayNames[strings.ToLower(day)]
+			if !ok {
+				return nil, fmt.Errorf("THRESHOLD_SCHEDULE %s: unknown day %q", profile.Name, day)
+			}
+			for _, weekday := range weekdays {
+				profile.days[weekday] = true
+			}
+		}
+		if len(profile.days) == 0 {
+			return nil, fmt.Errorf("THRESHOLD_SCHEDULE %s: no days given", profile.Name)
+		}
+
+		var err error
+		if profile.startMin, err = parseClock(profile.Start); err != nil {
+			return nil, fmt.Errorf("THRESHOLD_SCHEDULE %s: start: %w", profile.Name, err)
+		}
+		if profile.endMin, err = parseClock(profile.End); err != nil {
+			return nil, fmt.Errorf("THRESHOLD_SCHEDULE %s: end: %w", profile.Name, err)
+		}
+		if profile.startMin == profile.endMin {
+			return nil, fmt.Errorf("THRESHOLD_SCHEDULE %s: start and end are the same", profile.Name)
+		}
+	}
+
+	return profiles, nil
+}
+
+// parseClock parses "HH:MM" into minutes after midnight, allowing "24:00"
+func parseClock(value string) (int, error) {
+	var hours, mins int
+	if _, err := fmt.Sscanf(value, "%d:%d", &hours, &mins); err != nil {
+		return 0, fmt.Errorf("%q is not HH:MM", value)
+	}
+	if hours < 0 || mins < 0 || mins > 59 || hours > 24 || (hours == 24 && mins != 0) {
+		return 0, fmt.Errorf("%q is not a time of day", value)
+	}
+	return hours*60 + mins, nil
+}
+
+// covers reports whether the profile applies at local time t. A range whose
+// end is before its start runs past midnight, and belongs to the day it
+// starts on.
+func (p ThresholdProfile) covers(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if p.startMin < p.endMin {
+		return p.days[t.Weekday()] && minute >= p.startMin && minute < p.endMin
+	}
+
+	yesterday := (t.Weekday() + 6) % 7
+	return (p.days[t.Weekday()] && minute >= p.startMin) || (p.days[yesterday] && minute < p.endMin)
+}
+
+// activeThresholdProfile returns the first profile covering t, if any
+func activeThresholdProfile(t time.Time) (ThresholdProfile, bool) {
+	local := t.In(localTimezone)
+	for _, profile := range thresholdSchedule {
+		if profile.covers(local) {
+			return profile, true
+		}
+	}
+	return ThresholdProfile{}, false
+}
+
+// alertThreshold is the door's alert threshold in minutes at time t, from
+// the active schedule profile or else the door's own setting
+func alertThreshold(state *DoorState, t time.Time) int64 {
+	if len(thresholdSchedule) == 0 {
+		return int64(state.AlertThresholdMins)
+	}
+
+	profile, ok := activeThresholdProfile(t)
+	if !ok {
+		fmt.Printf("No threshold profile active - using %d minutes\n", state.AlertThresholdMins)
+		return int64(state.AlertThresholdMins)
+	}
+	fmt.Printf("Threshold profile %q active - using %d minutes\n", profile.Name, profile.ThresholdMinutes)
+	return int64(profile.ThresholdMinutes)
+}
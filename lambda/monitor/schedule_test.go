@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata" // NOTIFICATION_TZ zones without the system's zone files
+)
+
+func TestAlertThresholdSchedule(t *testing.T) {
+	zone, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("loading NOTIFICATION_TZ: %v", err)
+	}
+	schedule, err := loadThresholdSchedule(`[
+		{"name":"weeknight","days":["weekdays"],"start":"22:00","end":"06:00","thresholdMinutes":240},
+		{"name":"weekend","days":["weekends"],"start":"00:00","end":"24:00","thresholdMinutes":480}
+	]`)
+	if err != nil {
+		t.Fatalf("loadThresholdSchedule: %v", err)
+	}
+
+	savedSchedule, savedZone := thresholdSchedule, localTimezone
+	thresholdSchedule, localTimezone = schedule, zone
+	defer func() { thresholdSchedule, localTimezone = savedSchedule, savedZone }()
+
+	// October 16, 2026 is a Friday
+	local := func(day, hour, min int) time.Time {
+		return time.Date(2026, 10, day, hour, min, 0, 0, zone).UTC()
+	}
+	tests := []struct {
+		name string
+		at   time.Time
+		want int64
+	}{
+		{"friday evening", local(16, 21, 59), 30},
+		// Already Saturday in UTC, but still Friday evening in NOTIFICATION_TZ
+		{"friday evening, saturday in UTC", local(16, 20, 0), 30},
+		{"friday night starts", local(16, 22, 0), 240},
+		{"friday night past midnight", local(17, 5, 59), 240},
+		{"saturday morning", local(17, 6, 0), 480},
+		{"sunday's last minute", local(18, 23, 59), 480},
+		// Sunday night isn't a weeknight, and the weekend is over
+		{"monday midnight", local(19, 0, 0), 30},
+		{"monday evening", local(19, 21, 59), 30},
+		{"monday night starts", local(19, 22, 0), 240},
+		{"monday night's last minute", local(20, 5, 59), 240},
+		{"tuesday morning", local(20, 6, 0), 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixClock(t, tt.at)
+			if got := alertThreshold(&DoorState{AlertThresholdMins: 30}, now()); got != tt.want {
+				t.Errorf("threshold at %s = %d, want %d", tt.at.In(zone).Format("Mon 15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadThresholdSchedule(t *testing.T) {
+	tests := []struct {
+		raw     string
+		wantErr string
+	}{
+		{`[{"days":["mon"],"start":"09:00","end":"17:00","thresholdMinutes":60}]`, ""},
+		{`[{"days":["sat"],"start":"00:00","end":"24:00","thresholdMinutes":60}]`, ""},
+		{`[{"days":["fri"],"start":"23:30","end":"00:30","thresholdMinutes":60}]`, ""},
+		{`[{"days":["Weekends"],"start":"00:00","end":"24:00","thresholdMinutes":60}]`, ""},
+		{`{"days":["mon"]}`, "error parsing"},
+		{`[{"days":["mon"],"start":"09:00","end":"17:00"}]`, "profile 1: thresholdMinutes must be positive"},
+		{`[{"name":"holiday","days":["someday"],"start":"09:00","end":"17:00","thresholdMinutes":60}]`, `holiday: unknown day "someday"`},
+		{`[{"days":[],"start":"09:00","end":"17:00","thresholdMinutes":60}]`, "no days given"},
+		{`[{"days":["mon"],"start":"9am","end":"17:00","thresholdMinutes":60}]`, "start:"},
+		{`[{"days":["mon"],"start":"09:00","end":"24:30","thresholdMinutes":60}]`, "end:"},
+		{`[{"days":["mon"],"start":"09:00","end":"09:60","thresholdMinutes":60}]`, "end:"},
+		{`[{"days":["mon"],"start":"00:00","end":"00:00","thresholdMinutes":60}]`, "start and end are the same"},
+	}
+
+	for _, tt := range tests {
+		_, err := loadThresholdSchedule(tt.raw)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("loadThresholdSchedule(%s): %v", tt.raw, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("loadThresholdSchedule(%s) = %v, want an error with %q", tt.raw, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// SelfTestCheck is the outcome of one self-test step
+type SelfTestCheck struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Skipped bool   `json:"skipped,omitempty"` // Not configured, so not checked
+	Detail  string `json:"detail,omitempty"`
+}
+
+// errSelfTestSkipped is returned by a check whose dependency isn't configured
+var errSelfTestSkipped = errors.New("not configured")
+
+// runSelfTest checks every dependency the monitor uses, for verifying a
+// deploy with {"mode":"selftest"}. It never presses the button. Checks are
+// independent, so a failure doesn't stop the rest from running.
+func runSelfTest(ctx context.Context, result *MonitorResult) {
+	checks := []struct {
+		name string
+		run  func(context.Context) (string, error)
+	}{
+		{"Particle connectivity", checkParticleConnected},
+		{"Status variable", checkStatusVariable},
+		{"DynamoDB read/write", checkDynamoReadWrite},
+		{"Notification topics", checkTopics},
+		{"SNS publish", checkSNSPublish},
+	}
+
+	for _, check := range checks {
+		detail, err := check.run(ctx)
+		outcome := SelfTestCheck{Name: check.name, Passed: err == nil, Detail: detail}
+		if errors.Is(err, errSelfTestSkipped) {
+			outcome.Passed, outcome.Skipped = true, true
+		}
+		if err != nil {
+			outcome.Detail = err.Error()
+		}
+		fmt.Printf("Self-test %s: passed=%t %s\n", outcome.Name, outcome.Passed, outcome.Detail)
+		result.Checks = append(result.Checks, outcome)
+	}
+
+	result.Summary = selfTestSummary(result.Checks)
+	for _, check := range result.Checks {
+		if !check.Passed {
+			result.Error = result.Summary
+			break
+		}
+	}
+}
+
+// selfTestSummary says "All systems operational" or names the first failure
+func selfTestSummary(checks []SelfTestCheck) string {
+	for _, check := range checks {
+		if !check.Passed {
+			return fmt.Sprintf("%s failed: %s", check.Name, check.Detail)
+		}
+	}
+	return "All systems operational"
+}
+
+// checkParticleConnected asks Particle whether the device is online
+func checkParticleConnected(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/devices/%s", particleAPIBase, primaryDevice()), nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", particleAccessToken))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("particle API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var device struct {
+		Name      string `json:"name"`
+		Connected bool   `json:"connected"`
+	}
+	if err := json.Unmarshal(body, &device); err != nil {
+		return "", fmt.Errorf("error unmarshaling response: %w", err)
+	}
+	if !device.Connected {
+		return "", fmt.Errorf("device %s is offline", device.Name)
+	}
+	return fmt.Sprintf("device %s is online", device.Name), nil
+}
+
+// checkStatusVariable reads the door status the way a check does
+func checkStatusVariable(ctx context.Context) (string, error) {
+	status, err := getDoorStatus(ctx, primaryDevice())
+	if err != nil {
+		return "", err
+	}
+	if status == "unknown" {
+		return "", fmt.Errorf("%s reports no usable status", statusVariable)
+	}
+	return fmt.Sprintf("door is %s", status), nil
+}
+
+// checkDynamoReadWrite writes, reads back and deletes a throwaway item in
+// the door state table
+func checkDynamoReadWrite(ctx context.Context) (string, error) {
+	key := stateKey(fmt.Sprintf("selftest-%d", time.Now().UnixNano()))
+
+	item := map[string]*dynamodb.AttributeValue{
+		"status":      {S: aws.String("selftest")},
+		"lastChecked": {N: aws.String(fmt.Sprintf("%d", now().Unix()))},
+		stateKeyName:  key[stateKeyName],
+	}
+	if _, err := dynamoClient.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(doorStateTable),
+		Item:      item,
+	}); err != nil {
+		return "", fmt.Errorf("error putting item to DynamoDB: %w", err)
+	}
+
+	// Remove the item even if the read fails
+	defer func() {
+		if _, err := dynamoClient.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(doorStateTable),
+			Key:       key,
+		}); err != nil {
+			fmt.Printf("Error deleting self-test item: %v\n", err)
+		}
+	}()
+
+	out, err := dynamoClient.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(doorStateTable),
+		Key:            key,
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error getting item from DynamoDB: %w", err)
+	}
+	if out.Item == nil {
+		return "", fmt.Errorf("item written to %s was not read back", doorStateTable)
+	}
+	return fmt.Sprintf("wrote and read back an item in %s", doorStateTable), nil
+}
+
+// checkTopics confirms each configured topic exists and is reachable
+func checkTopics(ctx context.Context) (string, error) {
+	if !alertingEnabled {
+		return "", errSelfTestSkipped
+	}
+	if err := verifyTopics(ctx); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d topic(s) reachable", len(configuredTopics())), nil
+}
+
+// checkSNSPublish sends a test message through the normal notification path
+func checkSNSPublish(ctx context.Context) (string, error) {
+	if !alertingEnabled {
+		return "", errSelfTestSkipped
+	}
+
+	message := fmt.Sprintf("This is a test message from the garage door monitor self-test. No action is needed.\n\nTime: %s",
+		now().Format("2006-01-02 15:04:05 MST"))
+	if err := publishNotification(ctx, "Garage Door Self-Test", message); err != nil {
+		return "", err
+	}
+	return "published a test notification", nil
+}
+
+// sendTestNotification sends a clearly marked test alert through the normal
+// notification path, for {"mode":"test_notification"}
+func sendTestNotification(ctx context.Context) error {
+	if !alertingEnabled {
+		return fmt.Errorf("no notification topic or recipients configured")
+	}
+
+	message := fmt.Sprintf("TEST: This is a test notification from your garage door. If you got this, alerts will reach you. No action is needed.\n\nTime: %s",
+		now().In(localTimezone).Format("2006-01-02 15:04:05 MST"))
+	return publishNotification(ctx, "Garage Door Test Notification", message)
+}
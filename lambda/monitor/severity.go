@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+// Severity is opt-in: set ALERT_SEVERITY_BANDS and each open-door alert is
+// labelled by how far past the threshold the door has been open, the label
+// goes in the subject and on the OpenDoorAlerts metric, and an alert that
+// reaches a higher band goes out again. Bands marked urgent also go to
+// URGENT_TOPIC_ARN, e.g. a topic with SMS subscriptions, while every alert
+// still goes to the usual topic.
+
+// severityBand is one level, starting MinutesPast minutes after the
+// threshold
+type severityBand struct {
+	Label       string `json:"label"`
+	MinutesPast int64  `json:"minutesPast"`
+	Urgent      bool   `json:"urgent"`
+}
+
+// severityBands is loaded from ALERT_SEVERITY_BANDS, lowest first
+var severityBands []severityBand
+
+var (
+	urgentTopicARN  string
+	urgentSNSClient *sns.SNS
+)
+
+// loadSeverityBands parses ALERT_SEVERITY_BANDS, a JSON list of bands, e.g.
+// [{"label":"low","minutesPast":0},{"label":"medium","minutesPast":60},{"label":"high","minutesPast":180,"urgent":true}]
+func loadSeverityBands(raw string) ([]severityBand, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var loaded []severityBand
+	if err := json.Unmarshal([]byte(raw), &loaded); err != nil {
+		return nil, fmt.Errorf("error parsing ALERT_SEVERITY_BANDS: %w", err)
+	}
+
+	seen := make(map[string]bool, len(loaded))
+	for i, band := range loaded {
+		label := strings.ToLower(strings.TrimSpace(band.Label))
+		if label == "" || seen[label] {
+			return nil, fmt.Errorf("ALERT_SEVERITY_BANDS entry %d needs a unique label", i)
+		}
+		if band.MinutesPast < 0 {
+			return nil, fmt.Errorf("ALERT_SEVERITY_BANDS entry %q starts before the threshold", label)
+		}
+		seen[label] = true
+		loaded[i].Label = label
+	}
+	sort.SliceStable(loaded, func(i, j int) bool { return loaded[i].MinutesPast < loaded[j].MinutesPast })
+
+	return loaded, nil
+}
+
+// alertSeverity returns the band for a door open durationMins against
+// threshold, and its rank, 0 for the lowest. Without bands it returns the
+// zero band and -1.
+func alertSeverity(durationMins, threshold int64) (severityBand, int) {
+	rank := -1
+	var current severityBand
+	for i, band := range severityBands {
+		if durationMins-threshold >= band.MinutesPast {
+			current, rank = band, i
+		}
+	}
+	if rank < 0 && len(severityBands) > 0 {
+		// Below the lowest band's start counts as the lowest band
+		current, rank = severityBands[0], 0
+	}
+	return current, rank
+}
+
+// severityRank is the rank of a stored label, -1 if it isn't a band
+func severityRank(label string) int {
+	for i, band := range severityBands {
+		if band.Label == label {
+			return i
+		}
+	}
+	return -1
+}
+
+// severityEscalated reports whether an alert already went out this open
+// session at a lower severity than the door has now reached
+func severityEscalated(state *DoorState, rank int) bool {
+	if state.AlertSeverity == "" || rank < 0 {
+		return false
+	}
+	return rank > severityRank(state.AlertSeverity)
+}
+
+// recordAlertSeverity notes the severity an alert went out at and, for an
+// urgent band, sends a short copy to URGENT_TOPIC_ARN
+func recordAlertSeverity(ctx context.Context, state *DoorState, band severityBand) {
+	if band.Label == "" {
+		return
+	}
+	fmt.Printf("Alert sent at %s severity\n", band.Label)
+	state.AlertSeverity = band.Label
+	emitMetrics(map[string]string{"Severity": band.Label},
+		metric{Name: "OpenDoorAlerts", Unit: "Count", Value: 1},
+	)
+
+	if !band.Urgent || urgentTopicARN == "" || !alertingEnabled {
+		return
+	}
+	// SMS ignores the subject and is billed by length, so keep it short
+	message := fmt.Sprintf("URGENT: Your %s has been open for %s.", ownedName(state.DeviceID), plainMinutes(state.DurationOpenMins))
+	if err := publishToTopic(ctx, urgentTopicARN, "URGENT: Garage Door Open", message); err != nil {
+		fmt.Printf("Error sending urgent notification: %v\n", err)
+		return
+	}
+	fmt.Println("Urgent notification sent")
+}
+
+// plainMinutes writes a duration as hours and minutes, e.g. "4 hours and 5 minutes"
+func plainMinutes(mins int64) string {
+	if hours := mins / 60; hours > 0 {
+		return fmt.Sprintf("%d hours and %d minutes", hours, mins%60)
+	}
+	return fmt.Sprintf("%d minutes", mins)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// stateKeyName is the door state table's partition key attribute, from
+// STATE_KEY_NAME. DoorState always marshals the device as deviceId, so items
+// are renamed on their way to and from a table that uses another name.
+var stateKeyName = "deviceId"
+
+// stateKey is the key of a device's item in the door state table
+func stateKey(deviceID string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		stateKeyName: {S: aws.String(deviceID)},
+	}
+}
+
+// marshalStateItem marshals a door state table item, storing its deviceId
+// under stateKeyName
+func marshalStateItem(in interface{}) (map[string]*dynamodb.AttributeValue, error) {
+	item, err := dynamodbattribute.MarshalMap(in)
+	if err != nil {
+		return nil, err
+	}
+	if stateKeyName != "deviceId" {
+		if id, ok := item["deviceId"]; ok {
+			item[stateKeyName] = id
+			delete(item, "deviceId")
+		}
+	}
+	return item, nil
+}
+
+// unmarshalStateItem is the reverse of marshalStateItem. The item itself is
+// left unchanged. An attribute that doesn't fit its field, e.g. a
+// hand-edited lastOpenedTime left as a string, is logged and dropped so the
+// rest of the state is still read. An open door whose lastOpenedTime was
+// dropped is taken as opened now, the same as a suspect open duration, since
+// an open time of 0 would leave it without a duration or an alert.
+func unmarshalStateItem(item map[string]*dynamodb.AttributeValue, out interface{}) error {
+	if stateKeyName != "deviceId" {
+		renamed := make(map[string]*dynamodb.AttributeValue, len(item))
+		for name, value := range item {
+			if name != stateKeyName {
+				renamed[name] = value
+			}
+		}
+		if id, ok := item[stateKeyName]; ok {
+			renamed["deviceId"] = id
+		}
+		item = renamed
+	}
+	if err := dynamodbattribute.UnmarshalMap(item, out); err == nil {
+		return nil
+	}
+
+	target := reflect.ValueOf(out).Elem()
+	usable := make(map[string]*dynamodb.AttributeValue, len(item))
+	for name, value := range item {
+		probe := reflect.New(target.Type()).Interface()
+		if err := dynamodbattribute.UnmarshalMap(map[string]*dynamodb.AttributeValue{name: value}, probe); err != nil {
+			fmt.Printf("WARNING: ignoring malformed %s attribute in door state: %v\n", name, err)
+			continue
+		}
+		usable[name] = value
+	}
+	// Start over, since the failed attempt may have filled in some fields
+	target.Set(reflect.Zero(target.Type()))
+	if err := dynamodbattribute.UnmarshalMap(usable, out); err != nil {
+		return err
+	}
+
+	_, hadOpened := item["lastOpenedTime"]
+	_, keptOpened := usable["lastOpenedTime"]
+	if state, ok := out.(*DoorState); ok && hadOpened && !keptOpened && state.Status == "open" {
+		state.LastOpenedTime = now().Unix()
+		fmt.Printf("WARNING: door is open without a usable lastOpenedTime - restarting the clock at %d\n", state.LastOpenedTime)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// TestCorruptedOpenTimeStillAlerts stores an open door whose lastOpenedTime
+// was hand-edited into a string. The door is timed from the first check that
+// reads it, and alerts once the threshold passes from there.
+func TestCorruptedOpenTimeStillAlerts(t *testing.T) {
+	status := "open"
+	sent, check := monitorDoor(t, &status)
+	first := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	_, err := dynamoClient.PutItemWithContext(context.Background(), &dynamodb.PutItemInput{
+		TableName: aws.String(doorStateTable),
+		Item: map[string]*dynamodb.AttributeValue{
+			"deviceId":       {S: aws.String("dev1")},
+			"status":         {S: aws.String("open")},
+			"lastOpenedTime": {S: aws.String("yesterday")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("storing the corrupted item: %v", err)
+	}
+
+	check(first)
+	state, err := getDoorState(context.Background(), "dev1")
+	if err != nil {
+		t.Fatalf("getDoorState: %v", err)
+	}
+	if state.LastOpenedTime != first.Unix() {
+		t.Fatalf("LastOpenedTime = %d, want the first check's time %d", state.LastOpenedTime, first.Unix())
+	}
+
+	check(first.Add(29 * time.Minute))
+	if alerts := sent.all(); len(alerts) != 0 {
+		t.Fatalf("alerted before the threshold: %+v", alerts)
+	}
+	check(first.Add(30 * time.Minute))
+	check(first.Add(35 * time.Minute))
+	if alerts := sent.all(); len(alerts) != 1 || !strings.Contains(alerts[0].Message, "open for 30 minutes") {
+		t.Errorf("alerts = %+v, want one at the threshold", alerts)
+	}
+}
+
+// TestStateKeyNameRoundTrip keeps door state in a table whose partition key
+// is pk, as STATE_KEY_NAME allows
+func TestStateKeyNameRoundTrip(t *testing.T) {
+	saved := stateKeyName
+	stateKeyName = "pk"
+	defer func() { stateKeyName = saved }()
+	db := fakeDoorState(t)
+
+	state := &DoorState{DeviceID: "dev1", Status: "open", LastOpenedTime: 1760000000, SchemaVersion: stateSchemaVersion, AlertThresholdMins: 30}
+
+	item, err := marshalStateItem(state)
+	if err != nil {
+		t.Fatalf("marshalStateItem: %v", err)
+	}
+	if _, ok := item["deviceId"]; ok || aws.StringValue(item["pk"].S) != "dev1" {
+		t.Errorf("item = %v, want the device under pk only", item)
+	}
+	if key := stateKey("dev1"); len(key) != 1 || aws.StringValue(key["pk"].S) != "dev1" {
+		t.Errorf("stateKey = %v, want pk", key)
+	}
+
+	var read DoorState
+	if err := unmarshalStateItem(item, &read); err != nil {
+		t.Fatalf("unmarshalStateItem: %v", err)
+	}
+	if !reflect.DeepEqual(read, *state) {
+		t.Errorf("read %+v, want %+v", read, *state)
+	}
+	if _, ok := item["pk"]; !ok {
+		t.Error("unmarshalStateItem changed the item")
+	}
+
+	// And through the table, which finds items by stateKey
+	if err := saveDoorState(context.Background(), state); err != nil {
+		t.Fatalf("saveDoorState: %v", err)
+	}
+	stored, err := getDoorState(context.Background(), "dev1")
+	if err != nil || stored == nil || !reflect.DeepEqual(*stored, *state) {
+		t.Errorf("getDoorState = %+v, %v; want %+v", stored, err, *state)
+	}
+	db.mu.Lock()
+	raw := string(db.items[doorStateTable+"/dev1"])
+	db.mu.Unlock()
+	if !strings.Contains(raw, `"pk":`) || strings.Contains(raw, `"deviceId":`) {
+		t.Errorf("stored item = %s, want the device under pk only", raw)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNormalizeDoorStatus(t *testing.T) {
+	saved, savedMap := openPositionMin, statusMap
+	statusMap = map[string]string{"1": "open"} // A mapped value is a status, never a position
+	defer func() { openPositionMin, statusMap = saved, savedMap }()
+
+	tests := []struct {
+		threshold int
+		raw       string
+		want      string
+	}{
+		{5, `"open"`, "open"},
+		{5, `"CLOSED"`, "closed"},
+		{5, `"ajar"`, "ajar"}, // Left for the caller to treat as unknown
+		{5, `"1"`, "open"},    // Through STATUS_MAP
+		{5, `42`, "open"},     // JSON number
+		{5, `"42"`, "open"},   // Quoted number
+		{5, `" 42 "`, "open"},
+		{5, `42.5`, "open"}, // Float
+		{5, `0`, "closed"},
+		{5, `100`, "open"},
+
+		// The threshold itself is still closed; anything above it is open
+		{5, `5`, "closed"},
+		{5, `5.0`, "closed"},
+		{5, `"5"`, "closed"},
+		{5, `5.01`, "open"},
+		{5, `6`, "open"},
+		{5, `4.99`, "closed"},
+
+		// With no threshold, any opening at all is open
+		{0, `0`, "closed"},
+		{0, `0.5`, "open"},
+		{0, `"2"`, "open"},
+		{0, `-1`, "closed"},
+	}
+
+	for _, tt := range tests {
+		openPositionMin = tt.threshold
+		if got := normalizeDoorStatus(json.RawMessage(tt.raw)); got != tt.want {
+			t.Errorf("normalizeDoorStatus(%s) with threshold %d = %q, want %q", tt.raw, tt.threshold, got, tt.want)
+		}
+	}
+}
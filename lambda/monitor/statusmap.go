@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// canonicalStatuses are the door statuses the rest of the code understands
+var canonicalStatuses = map[string]bool{"open": true, "closed": true, "moving": true, "unknown": true}
+
+// statusMap is loaded from STATUS_MAP. It translates the raw status values
+// a firmware reports, matched case-insensitively, into canonical statuses.
+var statusMap map[string]string
+
+// loadStatusMap parses STATUS_MAP, a JSON object of raw value to canonical
+// status, e.g. {"UP":"open","DOWN":"closed","1":"open","0":"closed"}
+func loadStatusMap(raw string) (map[string]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var byValue map[string]string
+	if err := json.Unmarshal([]byte(raw), &byValue); err != nil {
+		return nil, fmt.Errorf("error parsing STATUS_MAP: %w", err)
+	}
+
+	loaded := make(map[string]string, len(byValue))
+	for value, status := range byValue {
+		status = strings.ToLower(strings.TrimSpace(status))
+		if !canonicalStatuses[status] {
+			return nil, fmt.Errorf("STATUS_MAP maps %q to %q, which isn't open, closed, moving or unknown", value, status)
+		}
+		loaded[strings.ToLower(strings.TrimSpace(value))] = status
+	}
+	return loaded, nil
+}
+
+// mapStatus translates a raw status value through STATUS_MAP, then accepts
+// the canonical words in any case. Anything else is left for the caller,
+// e.g. to read as a position.
+func mapStatus(raw string) (string, bool) {
+	key := strings.ToLower(strings.TrimSpace(raw))
+	if status, ok := statusMap[key]; ok {
+		return status, true
+	}
+	if canonicalStatuses[key] {
+		return key, true
+	}
+	return "", false
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Cold-weather alerting is opt-in: set TEMPERATURE_VAR to the name of a
+// temperature cloud variable and, while the door is open and the reading is
+// below COLD_TEMPERATURE, the threshold drops to COLD_THRESHOLD_MINUTES.
+var (
+	temperatureVariable  string
+	coldTemperature      float64
+	coldThresholdMinutes int
+)
+
+// coldReading is a temperature below COLD_TEMPERATURE. A nil *coldReading
+// means it isn't cold, or the temperature couldn't be read.
+type coldReading struct {
+	Temperature float64
+}
+
+// coldConditions reads the temperature and reports whether it is cold.
+// A missing or unreadable variable is logged and treated as not cold, so
+// it never blocks the normal alert.
+func coldConditions(ctx context.Context, deviceID string) *coldReading {
+	if temperatureVariable == "" {
+		return nil
+	}
+
+	raw, err := getParticleVariable(ctx, deviceID, temperatureVariable)
+	if err != nil {
+		fmt.Printf("Error reading %s (ignored): %v\n", temperatureVariable, err)
+		return nil
+	}
+	temperature, err := parseTemperature(raw)
+	if err != nil {
+		fmt.Printf("Unusable %s value %s (ignored): %v\n", temperatureVariable, string(raw), err)
+		return nil
+	}
+
+	fmt.Printf("Temperature: %.1f\n", temperature)
+	if temperature >= coldTemperature {
+		return nil
+	}
+	fmt.Printf("Below %.1f - alert threshold capped at %d minutes\n", coldTemperature, coldThresholdMinutes)
+	return &coldReading{Temperature: temperature}
+}
+
+// parseTemperature accepts a bare number or a numeric string
+func parseTemperature(raw json.RawMessage) (float64, error) {
+	text := strings.TrimSpace(string(raw))
+	var quoted string
+	if err := json.Unmarshal(raw, &quoted); err == nil {
+		text = strings.TrimSpace(quoted)
+	}
+	return strconv.ParseFloat(text, 64)
+}
+
+// capThreshold lowers a threshold to COLD_THRESHOLD_MINUTES when it is cold
+func (c *coldReading) capThreshold(threshold int64) int64 {
+	if c == nil || threshold <= int64(coldThresholdMinutes) {
+		return threshold
+	}
+	return int64(coldThresholdMinutes)
+}
+
+// note is the line added to alerts sent because of the cold
+func (c *coldReading) note() string {
+	return fmt.Sprintf("It's %.0f degrees out.", c.Temperature)
+}
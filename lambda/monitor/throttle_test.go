@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// TestThrottledReadSkipsCheck throttles the door state table under a door
+// that has been open for an hour. The check must give up rather than carry
+// on from an empty state, which would write over the stored open time.
+func TestThrottledReadSkipsCheck(t *testing.T) {
+	status := "open"
+	sent, _ := monitorDoor(t, &status)
+	db := fakeDoorState(t) // In place of monitorDoor's, to throttle the table
+	current := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	fixClock(t, current)
+
+	opened := current.Add(-time.Hour).Unix()
+	_, err := dynamoClient.PutItemWithContext(context.Background(), &dynamodb.PutItemInput{
+		TableName: aws.String(doorStateTable),
+		Item: map[string]*dynamodb.AttributeValue{
+			"deviceId":       {S: aws.String("dev1")},
+			"status":         {S: aws.String("open")},
+			"lastOpenedTime": {N: aws.String(fmt.Sprint(opened))},
+		},
+	})
+	if err != nil {
+		t.Fatalf("seeding the door state: %v", err)
+	}
+
+	db.failTable(doorStateTable, "ProvisionedThroughputExceededException")
+	var result MonitorResult
+	if err := runStatusCheck(context.Background(), "dev1", &result); err != nil {
+		t.Fatalf("runStatusCheck: %v", err)
+	}
+	if result.Status != "open" {
+		t.Errorf("result status = %q, want the reading, open", result.Status)
+	}
+	if n := db.putCount(doorStateTable); n != 1 {
+		t.Errorf("door state writes = %d, want only the seeded item", n)
+	}
+	if alerts := sent.all(); len(alerts) != 0 {
+		t.Errorf("alerted without the stored state: %+v", alerts)
+	}
+
+	db.failTable(doorStateTable, "")
+	state, err := getDoorState(context.Background(), "dev1")
+	if err != nil || state == nil || state.LastOpenedTime != opened {
+		t.Errorf("stored state = %+v, %v; want the open time kept", state, err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+type invocationTimingKey struct{}
+
+// invocationTiming adds up how long one invocation waited on Particle and
+// DynamoDB, for its summary log line
+type invocationTiming struct {
+	mu       sync.Mutex
+	particle time.Duration
+	dynamo   time.Duration
+}
+
+// withInvocationTiming starts an invocation's timing
+func withInvocationTiming(ctx context.Context) context.Context {
+	return context.WithValue(ctx, invocationTimingKey{}, &invocationTiming{})
+}
+
+// invocationTimes returns the time spent on Particle and DynamoDB so far,
+// in milliseconds
+func invocationTimes(ctx context.Context) (particleMs, dynamoMs int64) {
+	timing, ok := ctx.Value(invocationTimingKey{}).(*invocationTiming)
+	if !ok {
+		return 0, 0
+	}
+
+	timing.mu.Lock()
+	defer timing.mu.Unlock()
+	return timing.particle.Milliseconds(), timing.dynamo.Milliseconds()
+}
+
+// chargeTime adds spent to one of the invocation's totals
+func chargeTime(ctx context.Context, spent time.Duration, particle bool) {
+	timing, ok := ctx.Value(invocationTimingKey{}).(*invocationTiming)
+	if !ok {
+		// Not started by a handler, e.g. during init
+		return
+	}
+
+	timing.mu.Lock()
+	defer timing.mu.Unlock()
+	if particle {
+		timing.particle += spent
+	} else {
+		timing.dynamo += spent
+	}
+}
+
+// timedTransport charges each Particle round trip to the invocation that
+// made it
+type timedTransport struct {
+	base http.RoundTripper
+}
+
+func (t timedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	chargeTime(req.Context(), time.Since(start), true)
+	return resp, err
+}
+
+// timeDynamoCalls charges each DynamoDB call, including its retries, to the
+// invocation that made it
+func timeDynamoCalls(c *client.Client) {
+	c.Handlers.Complete.PushBack(func(r *request.Request) {
+		chargeTime(r.Context(), time.Since(r.Time), false)
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+// A bad topic ARN would otherwise only show up as a failed publish once the
+// door has been open too long, so the topics are checked at startup. With
+// TOPIC_VALIDATION=strict a bad topic stops the function from starting; the
+// default, lenient, logs a warning and carries on. VERIFY_TOPICS=true also
+// asks SNS whether each topic exists and can be reached.
+
+var (
+	strictTopicValidation bool
+	verifyTopicsAtStartup bool
+)
+
+// topicVerifyTimeout bounds the GetTopicAttributes calls made during init
+const topicVerifyTimeout = 5 * time.Second
+
+var (
+	topicRegionPattern  = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+	topicAccountPattern = regexp.MustCompile(`^\d{12}$`)
+	topicNamePattern    = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}(\.fifo)?$`)
+)
+
+var topicPartitions = map[string]bool{"aws": true, "aws-cn": true, "aws-us-gov": true}
+
+// topicRegion extracts the region from an SNS topic ARN,
+// arn:<partition>:sns:<region>:<account>:<name>, checking each part
+func topicRegion(topicARN string) (string, error) {
+	parts := strings.Split(topicARN, ":")
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "sns" {
+		return "", fmt.Errorf("not an SNS topic ARN: %q", topicARN)
+	}
+	if !topicPartitions[parts[1]] {
+		return "", fmt.Errorf("unknown partition %q in %s", parts[1], topicARN)
+	}
+	if !topicRegionPattern.MatchString(parts[3]) {
+		return "", fmt.Errorf("bad region %q in %s", parts[3], topicARN)
+	}
+	if !topicAccountPattern.MatchString(parts[4]) {
+		return "", fmt.Errorf("bad account ID %q in %s", parts[4], topicARN)
+	}
+	if !topicNamePattern.MatchString(parts[5]) {
+		return "", fmt.Errorf("bad topic name %q in %s", parts[5], topicARN)
+	}
+	return parts[3], nil
+}
+
+// topicConfigError reports a bad notification topic setting, failing
+// startup in strict mode and logging a warning otherwise
+func topicConfigError(setting string, err error) {
+	if strictTopicValidation {
+		panic(fmt.Sprintf("invalid %s (TOPIC_VALIDATION=strict): %v", setting, err))
+	}
+	fmt.Printf("WARNING: ********** invalid %s: %v - alerts sent there will fail **********\n", setting, err)
+}
+
+// verifyTopic checks that a topic exists and this function can reach it
+func verifyTopic(ctx context.Context, svc *sns.SNS, topicARN string) error {
+	if _, err := svc.GetTopicAttributesWithContext(ctx, &sns.GetTopicAttributesInput{
+		TopicArn: aws.String(topicARN),
+	}); err != nil {
+		return fmt.Errorf("error getting attributes of %s: %w", topicARN, err)
+	}
+	return nil
+}
+
+// notificationTopic is one topic alerts can go to
+type notificationTopic struct {
+	setting  string // The setting it came from, for messages
+	topicARN string
+	svc      *sns.SNS
+}
+
+// configuredTopics lists every topic alerts can go to
+func configuredTopics() []notificationTopic {
+	var topics []notificationTopic
+	if notificationTopicARN != "" {
+		topics = append(topics, notificationTopic{"NOTIFICATION_TOPIC_ARN", notificationTopicARN, snsClient})
+	}
+	if fallbackTopicARN != "" {
+		topics = append(topics, notificationTopic{"NOTIFICATION_TOPIC_ARN_FALLBACK", fallbackTopicARN, fallbackSNSClient})
+	}
+	if urgentTopicARN != "" {
+		topics = append(topics, notificationTopic{"URGENT_TOPIC_ARN", urgentTopicARN, urgentSNSClient})
+	}
+	for _, recipient := range recipients {
+		region, _ := topicRegion(recipient.TopicARN)
+		topics = append(topics, notificationTopic{"NOTIFICATION_RECIPIENTS topic for " + recipient.Name, recipient.TopicARN, recipientClients[region]})
+	}
+	return topics
+}
+
+// verifyTopics confirms every configured topic with SNS
+func verifyTopics(ctx context.Context) error {
+	var failed []string
+	for _, topic := range configuredTopics() {
+		if err := verifyTopic(ctx, topic.svc, topic.topicARN); err != nil {
+			fmt.Printf("Error verifying %s: %v\n", topic.setting, err)
+			failed = append(failed, topic.setting)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not reach %s", strings.Join(failed, ", "))
+	}
+	return nil
+}